@@ -0,0 +1,123 @@
+// Package docker
+// Date: 2024/07/22 15:08:44
+// Author: Amu
+// Description:
+package docker
+
+import (
+	"context"
+	"io"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+// AttachOptions 连接容器标准输入输出时的参数
+type AttachOptions struct {
+	Stdin      bool   // 连接标准输入
+	Stdout     bool   // 连接标准输出
+	Stderr     bool   // 连接标准错误
+	Logs       bool   // 先回放容器已有的输出
+	DetachKeys string // 断开连接的按键序列, 如 ctrl-p,ctrl-q, 为空时使用 daemon 默认值
+}
+
+// AttachStream 与容器之间的双向数据流。
+// 非 TTY 容器的输出会被拆分到 Stdout 和 Stderr, 调用方需要同时读取两者, 否则会阻塞另一路输出;
+// TTY 容器的全部输出都在 Stdout 中, Stderr 直接返回 EOF
+type AttachStream struct {
+	Stdin  io.WriteCloser
+	Stdout io.Reader
+	Stderr io.Reader
+	TTY    bool
+
+	resp types.HijackedResponse
+}
+
+// Close 关闭与 daemon 的连接
+func (s *AttachStream) Close() error {
+	s.resp.Close()
+	return nil
+}
+
+// stdinWriter 写入劫持的连接, Close 时只关闭写端以通知容器输入结束
+type stdinWriter struct {
+	resp types.HijackedResponse
+}
+
+func (w *stdinWriter) Write(p []byte) (int, error) {
+	return w.resp.Conn.Write(p)
+}
+
+func (w *stdinWriter) Close() error {
+	return w.resp.CloseWrite()
+}
+
+// newAttachStream 将劫持的连接包装为 AttachStream, 非 TTY 时按 stdcopy 协议拆分输出
+func newAttachStream(resp types.HijackedResponse, tty bool) *AttachStream {
+	stream := &AttachStream{
+		Stdin: &stdinWriter{resp: resp},
+		TTY:   tty,
+		resp:  resp,
+	}
+	if mediaType, ok := resp.MediaType(); ok {
+		tty = mediaType != types.MediaTypeMultiplexedStream
+		stream.TTY = tty
+	}
+	if tty {
+		stream.Stdout = resp.Reader
+		stream.Stderr = eofReader{}
+		return stream
+	}
+
+	stdoutReader, stdoutWriter := io.Pipe()
+	stderrReader, stderrWriter := io.Pipe()
+	go func() {
+		_, err := stdcopy.StdCopy(stdoutWriter, stderrWriter, resp.Reader)
+		_ = stdoutWriter.CloseWithError(err)
+		_ = stderrWriter.CloseWithError(err)
+	}()
+	stream.Stdout = stdoutReader
+	stream.Stderr = stderrReader
+	return stream
+}
+
+type eofReader struct{}
+
+func (eofReader) Read([]byte) (int, error) {
+	return 0, io.EOF
+}
+
+func (m *Manager) AttachContainer(ctx context.Context, containerID string, opts AttachOptions) (*AttachStream, error) {
+	containerID, err := m.ResolveContainer(ctx, containerID)
+	if err != nil {
+		return nil, err
+	}
+	inspect, err := m.client.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := m.client.ContainerAttach(ctx, containerID, container.AttachOptions{
+		Stream:     true,
+		Stdin:      opts.Stdin,
+		Stdout:     opts.Stdout,
+		Stderr:     opts.Stderr,
+		DetachKeys: opts.DetachKeys,
+		Logs:       opts.Logs,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newAttachStream(resp, inspect.Config.Tty), nil
+}
+
+func (m *Manager) ResizeContainerTTY(ctx context.Context, containerID string, height, width uint) error {
+	containerID, err := m.ResolveContainer(ctx, containerID)
+	if err != nil {
+		return err
+	}
+	return m.client.ContainerResize(ctx, containerID, container.ResizeOptions{
+		Height: height,
+		Width:  width,
+	})
+}
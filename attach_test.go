@@ -0,0 +1,63 @@
+// Package docker
+// Date: 2024/07/22 15:09:12
+// Author: Amu
+// Description:
+package docker
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+func TestAttachContainer(t *testing.T) {
+	manager, _ := NewManager()
+	stream, err := manager.AttachContainer(context.Background(), "redis", AttachOptions{Stdout: true, Stderr: true, Logs: true})
+	if err != nil {
+		t.Error("attach container error: ", err)
+		return
+	}
+	defer stream.Close()
+	if err := manager.ResizeContainerTTY(context.Background(), "redis", 40, 120); err != nil {
+		t.Error("resize container tty error: ", err)
+	}
+}
+
+func TestAttachStreamDemux(t *testing.T) {
+	buf := new(bytes.Buffer)
+	_, _ = stdcopy.NewStdWriter(buf, stdcopy.Stdout).Write([]byte("out"))
+	_, _ = stdcopy.NewStdWriter(buf, stdcopy.Stderr).Write([]byte("err"))
+
+	client, server := net.Pipe()
+	defer server.Close()
+	stream := newAttachStream(types.HijackedResponse{Conn: client, Reader: bufio.NewReader(buf)}, false)
+	defer stream.Close()
+
+	stderr := make(chan []byte)
+	go func() {
+		b, _ := io.ReadAll(stream.Stderr)
+		stderr <- b
+	}()
+	stdout, err := io.ReadAll(stream.Stdout)
+	if err != nil {
+		t.Fatalf("read stdout error: %v", err)
+	}
+	if string(stdout) != "out" {
+		t.Errorf("unexpected stdout: %q", stdout)
+	}
+	if b := <-stderr; string(b) != "err" {
+		t.Errorf("unexpected stderr: %q", b)
+	}
+
+	go func() { _, _ = stream.Stdin.Write([]byte("ping")) }()
+	in := make([]byte, 4)
+	if _, err := io.ReadFull(server, in); err != nil || string(in) != "ping" {
+		t.Errorf("unexpected stdin: %q (%v)", in, err)
+	}
+}
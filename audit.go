@@ -0,0 +1,262 @@
+// Package docker
+// Date: 2024/08/15 10:18:36
+// Author: Amu
+// Description:
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AuditEvent 一次变更操作的审计记录
+type AuditEvent struct {
+	Time      time.Time      `json:"time"`             // 操作开始的时间
+	Operation string         `json:"operation"`        // 方法名, 如 CreateContainerWithSpec
+	Caller    string         `json:"caller,omitempty"` // 调用方身份, 由 WithCaller 写入 context
+	Args      map[string]any `json:"args,omitempty"`   // 参数, 环境变量中的敏感值已隐藏
+	Result    any            `json:"result,omitempty"` // 新建资源的 ID 等返回值
+	Error     string         `json:"error,omitempty"`  // 为空表示成功
+	Duration  time.Duration  `json:"duration"`         // 纳秒
+}
+
+// AuditSink 审计记录的输出, 会被并发调用; 写入失败不影响操作本身
+type AuditSink interface {
+	Audit(event AuditEvent) error
+}
+
+// AuditFunc 以回调函数作为 AuditSink
+type AuditFunc func(event AuditEvent)
+
+func (f AuditFunc) Audit(event AuditEvent) error {
+	f(event)
+	return nil
+}
+
+// AuditWriter 以 JSON Lines 格式将审计记录写入 io.Writer
+type AuditWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewAuditWriter(w io.Writer) *AuditWriter {
+	return &AuditWriter{w: w}
+}
+
+func (a *AuditWriter) Audit(event AuditEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	_, err = a.w.Write(append(data, '\n'))
+	return err
+}
+
+// AuditFile 以 JSON Lines 格式追加写入文件的 AuditSink, 使用完后需要 Close
+type AuditFile struct {
+	*AuditWriter
+	file *os.File
+}
+
+// OpenAuditFile 以追加方式打开审计文件, 文件不存在时以 0600 权限创建
+func OpenAuditFile(path string) (*AuditFile, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &AuditFile{AuditWriter: NewAuditWriter(file), file: file}, nil
+}
+
+func (a *AuditFile) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.file.Close()
+}
+
+// WithAuditSink 记录 Manager 的每次变更操作(创建、启停、删除、重命名、复制文件、拉取和标记镜像、网络变更等),
+// 可多次使用以输出到多个 sink
+func WithAuditSink(sinks ...AuditSink) Option {
+	return func(m *Manager) {
+		m.auditSinks = append(m.auditSinks, sinks...)
+	}
+}
+
+type callerKey struct{}
+
+// WithCaller 返回携带调用方身份的 context, 审计记录中的 Caller 取自这里
+func WithCaller(ctx context.Context, caller string) context.Context {
+	return context.WithValue(ctx, callerKey{}, caller)
+}
+
+// CallerFromContext 返回 WithCaller 写入的调用方身份, 没有时为空
+func CallerFromContext(ctx context.Context) string {
+	caller, _ := ctx.Value(callerKey{}).(string)
+	return caller
+}
+
+// auditArgs 审计记录中的参数
+type auditArgs map[string]any
+
+// auditCall 一次进行中的操作, 没有配置 sink 时为 nil
+type auditCall struct {
+	sinks []AuditSink
+	event AuditEvent
+	start time.Time
+}
+
+// audit 开始记录一次操作, 用法:
+//
+//	defer m.audit(ctx, "StartContainer", auditArgs{"container": containerID}).done(nil, &err)
+func (m *Manager) audit(ctx context.Context, operation string, args auditArgs) *auditCall {
+	if len(m.auditSinks) == 0 {
+		return nil
+	}
+	start := time.Now()
+	return &auditCall{
+		sinks: m.auditSinks,
+		event: AuditEvent{
+			Time:      start,
+			Operation: operation,
+			Caller:    CallerFromContext(ctx),
+			Args:      args,
+		},
+		start: start,
+	}
+}
+
+// done 在操作结束时输出记录, result 为指向返回值的指针, 没有返回值时为 nil
+func (c *auditCall) done(result any, err *error) {
+	if c == nil {
+		return
+	}
+	event := c.event
+	event.Duration = time.Since(c.start)
+	if err != nil && *err != nil {
+		event.Error = (*err).Error()
+	} else {
+		switch r := result.(type) {
+		case *string:
+			event.Result = *r
+		case *[]string:
+			event.Result = *r
+		}
+	}
+	for _, sink := range c.sinks {
+		_ = sink.Audit(event)
+	}
+}
+
+// sensitiveEnvKeys 环境变量名或命令行选项名包含其中任意一项(不区分大小写)时, 在审计记录中隐藏其值;
+// PASS 同时覆盖 PASSWORD、PASSWD 和 redis 的 requirepass、masterauth 等
+var sensitiveEnvKeys = []string{"PASS", "SECRET", "TOKEN", "KEY", "CREDENTIAL", "AUTH"}
+
+const redacted = "******"
+
+// redactEnv 返回隐藏了敏感值的环境变量副本
+func redactEnv(env []string) []string {
+	if env == nil {
+		return nil
+	}
+	result := make([]string, len(env))
+	for i, e := range env {
+		key, _, ok := strings.Cut(e, "=")
+		if ok && isSensitiveKey(key) {
+			e = key + "=" + redacted
+		}
+		result[i] = e
+	}
+	return result
+}
+
+func isSensitiveKey(key string) bool {
+	key = strings.ToUpper(key)
+	for _, s := range sensitiveEnvKeys {
+		if strings.Contains(key, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactCmd 返回隐藏了敏感参数的命令副本: 名称敏感的选项(如 --requirepass x、--password=x)和 KEY=value 参数的值
+// 被隐藏; 含空白的参数(如 sh -c 的脚本)按单词处理
+func redactCmd(cmd []string) []string {
+	if cmd == nil {
+		return nil
+	}
+	result := make([]string, len(cmd))
+	hideNext := false
+	for i, arg := range cmd {
+		if strings.ContainsAny(arg, " \t\n") {
+			result[i] = strings.Join(redactCmd(strings.Fields(arg)), " ")
+			hideNext = false
+			continue
+		}
+		switch {
+		case hideNext:
+			arg, hideNext = redacted, false
+		case strings.Contains(arg, "="):
+			key, _, _ := strings.Cut(arg, "=")
+			if isSensitiveKey(strings.TrimLeft(key, "-")) {
+				arg = key + "=" + redacted
+			}
+		case strings.HasPrefix(arg, "-"):
+			hideNext = isSensitiveKey(strings.TrimLeft(arg, "-"))
+		}
+		result[i] = arg
+	}
+	return result
+}
+
+// redactChanges 隐藏 Dockerfile 指令中 ENV 的敏感值, 支持 ENV KEY=value ... 和 ENV KEY value 两种形式
+func redactChanges(changes []string) []string {
+	if changes == nil {
+		return nil
+	}
+	result := make([]string, len(changes))
+	for i, change := range changes {
+		fields := strings.Fields(change)
+		if len(fields) >= 2 && strings.EqualFold(fields[0], "ENV") {
+			if strings.Contains(fields[1], "=") {
+				change = fields[0] + " " + strings.Join(redactEnv(fields[1:]), " ")
+			} else if isSensitiveKey(fields[1]) {
+				change = fields[0] + " " + fields[1] + " " + redacted
+			}
+		}
+		result[i] = change
+	}
+	return result
+}
+
+// auditSpec 返回隐藏了敏感环境变量和命令参数的 spec 副本
+func auditSpec(spec ContainerSpec) ContainerSpec {
+	spec.Env = redactEnv(spec.Env)
+	spec.Cmd = redactCmd(spec.Cmd)
+	return spec
+}
+
+func auditCommitOptions(opts CommitOptions) CommitOptions {
+	opts.Env = redactEnv(opts.Env)
+	opts.Cmd = redactCmd(opts.Cmd)
+	opts.Changes = redactChanges(opts.Changes)
+	return opts
+}
+
+func auditCloneOverrides(overrides CloneOverrides) CloneOverrides {
+	overrides.Env = redactEnv(overrides.Env)
+	overrides.Cmd = redactCmd(overrides.Cmd)
+	return overrides
+}
+
+func auditExecOptions(opts ExecOptions) ExecOptions {
+	opts.Env = redactEnv(opts.Env)
+	opts.Cmd = redactCmd(opts.Cmd)
+	return opts
+}
@@ -0,0 +1,183 @@
+// Package docker
+// Date: 2024/08/15 11:02:17
+// Author: Amu
+// Description:
+package docker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/client"
+)
+
+// newFakeDaemonManager 返回连接到 handler 的 Manager, 用于不依赖 daemon 的测试
+func newFakeDaemonManager(t *testing.T, handler http.HandlerFunc, opts ...Option) *Manager {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	cli, err := client.NewClientWithOpts(client.WithHost("tcp://"+strings.TrimPrefix(server.URL, "http://")), client.WithVersion("1.46"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &Manager{client: cli}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+func TestAuditTagImage(t *testing.T) {
+	var events []AuditEvent
+	m := newFakeDaemonManager(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/images/redis:7.0.5/tag") {
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"message":"No such image"}`))
+	}, WithAuditSink(AuditFunc(func(event AuditEvent) {
+		events = append(events, event)
+	})))
+
+	ctx := WithCaller(context.Background(), "alice")
+	if err := m.TagImage(ctx, "redis:7.0.5", "registry.local/redis:7.0.5"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.DeleteImage(ctx, "missing"); err == nil {
+		t.Fatal("expected error")
+	}
+	// 查询类方法不记录
+	if _, err := m.GetImageByID(ctx, "missing"); err == nil {
+		t.Fatal("expected error")
+	}
+
+	if len(events) != 2 {
+		t.Fatalf("events = %+v", events)
+	}
+	tag := events[0]
+	if tag.Operation != "TagImage" || tag.Caller != "alice" || tag.Error != "" || tag.Time.IsZero() || tag.Duration <= 0 {
+		t.Errorf("tag event = %+v", tag)
+	}
+	if !reflect.DeepEqual(tag.Args, map[string]any{"source": "redis:7.0.5", "target": "registry.local/redis:7.0.5"}) {
+		t.Errorf("tag args = %v", tag.Args)
+	}
+	if del := events[1]; del.Operation != "DeleteImage" || !strings.Contains(del.Error, "No such image") {
+		t.Errorf("delete event = %+v", del)
+	}
+}
+
+func TestAuditRedactsEnv(t *testing.T) {
+	var events []AuditEvent
+	m := newFakeDaemonManager(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}, WithAuditSink(AuditFunc(func(event AuditEvent) {
+		events = append(events, event)
+	})))
+
+	spec := ContainerSpec{
+		Name:  "db",
+		Image: "mysql:8",
+		Env:   []string{"MYSQL_ROOT_PASSWORD=hunter2", "api_key=abc", "TZ=Asia/Shanghai", "EMPTY"},
+	}
+	if _, err := m.CreateContainerWithSpec(context.Background(), spec); err == nil {
+		t.Fatal("expected error")
+	}
+	if len(events) != 1 {
+		t.Fatalf("events = %+v", events)
+	}
+	want := []string{"MYSQL_ROOT_PASSWORD=******", "api_key=******", "TZ=Asia/Shanghai", "EMPTY"}
+	if got := events[0].Args["spec"].(ContainerSpec).Env; !reflect.DeepEqual(got, want) {
+		t.Errorf("env = %v, want %v", got, want)
+	}
+	if spec.Env[0] != "MYSQL_ROOT_PASSWORD=hunter2" {
+		t.Errorf("caller's spec was modified: %v", spec.Env)
+	}
+}
+
+func TestAuditRedactsCmd(t *testing.T) {
+	cmd := []string{"redis-server", "--requirepass", "coreblox123", "--port", "6379", "--masterauth=abc", "TOKEN=xyz",
+		"sh -c 'mysqld --password hunter2'"}
+	want := []string{"redis-server", "--requirepass", redacted, "--port", "6379", "--masterauth=" + redacted, "TOKEN=" + redacted,
+		"sh -c 'mysqld --password " + redacted}
+	if got := redactCmd(cmd); !reflect.DeepEqual(got, want) {
+		t.Errorf("cmd = %q, want %q", got, want)
+	}
+	if cmd[2] != "coreblox123" {
+		t.Errorf("caller's cmd was modified: %v", cmd)
+	}
+
+	changes := []string{"ENV PASSWORD=hunter2 TZ=UTC", "env API_TOKEN abc", "ENV TZ UTC", "EXPOSE 6379"}
+	want = []string{"ENV PASSWORD=" + redacted + " TZ=UTC", "env API_TOKEN " + redacted, "ENV TZ UTC", "EXPOSE 6379"}
+	if got := redactChanges(changes); !reflect.DeepEqual(got, want) {
+		t.Errorf("changes = %q, want %q", got, want)
+	}
+	if opts := auditExecOptions(ExecOptions{Cmd: []string{"mysql", "-u", "root", "--password=x"}}); opts.Cmd[3] != "--password="+redacted {
+		t.Errorf("exec cmd = %q", opts.Cmd)
+	}
+}
+
+func TestAuditFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	file, err := OpenAuditFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	m := newFakeDaemonManager(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"NetworksDeleted":["old"]}`))
+	}, WithAuditSink(file, NewAuditWriter(&buf)))
+
+	for i := 0; i < 2; i++ {
+		if _, err := m.PruneNetworkWithOptions(context.Background(), PruneNetworkOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := file.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, buf.Bytes()) {
+		t.Errorf("file and writer differ:\n%s\n%s", data, buf.Bytes())
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("lines = %q", lines)
+	}
+	var event map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &event); err != nil {
+		t.Fatal(err)
+	}
+	if event["operation"] != "PruneNetworkWithOptions" || !reflect.DeepEqual(event["result"], []any{"old"}) {
+		t.Errorf("event = %v", event)
+	}
+	if _, ok := event["caller"]; ok {
+		t.Errorf("caller should be omitted: %v", event)
+	}
+}
+
+func TestAuditDisabled(t *testing.T) {
+	m := &Manager{cache: &resourceCache{}}
+	var err error = errors.New("boom")
+	// 没有配置 sink 时 audit 返回 nil, done 不做任何事; 缓存由 invalidate 单独失效
+	call := m.audit(context.Background(), "StartContainer", nil)
+	if call != nil {
+		t.Fatalf("call = %+v", call)
+	}
+	call.done(nil, &err)
+}
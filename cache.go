@@ -0,0 +1,234 @@
+// Package docker
+// Date: 2024/08/22 09:31:54
+// Author: Amu
+// Description:
+package docker
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/image"
+)
+
+// DefaultCacheMaxStale 缓存结果的默认最长保留时间
+const DefaultCacheMaxStale = 30 * time.Second
+
+// WithCache 缓存容器、镜像和网络的列表, ListContainer、ResolveContainer、GetNetworkByName、GetImageByName 等
+// 在缓存有效时不再请求 daemon。缓存在第一次读取时加载, 之后通过 daemon 的事件流在资源变化时失效,
+// 本 Manager 的修改操作结束后也会立即失效; 事件可能丢失, 因此加载超过 maxStale 的结果同样视为失效,
+// maxStale <= 0 时使用 DefaultCacheMaxStale。事件流断开期间不使用缓存, 下次读取时重新订阅。
+// 返回的列表与缓存共享 Labels 等字段, 调用方不应修改; 使用缓存的 Manager 不再使用时需要 Close
+func WithCache(maxStale time.Duration) Option {
+	return func(m *Manager) {
+		if maxStale <= 0 {
+			maxStale = DefaultCacheMaxStale
+		}
+		m.cache = &resourceCache{manager: m, maxStale: maxStale, now: time.Now}
+	}
+}
+
+// Close 停止缓存的事件订阅并关闭与 daemon 的连接
+func (m *Manager) Close() error {
+	m.cache.close()
+	return m.client.Close()
+}
+
+// invalidate 使 WithCache 的缓存失效, 修改容器、镜像或网络的方法都需要在结束时调用, 用法:
+//
+//	defer m.invalidate()
+func (m *Manager) invalidate() {
+	m.cache.invalidateAll()
+}
+
+// cacheEntry 一种资源的列表, 每次失效使 gen 加一, 加载期间失效时加载的结果不会被缓存
+type cacheEntry[T any] struct {
+	gen atomic.Uint64
+
+	mu        sync.Mutex
+	items     []T
+	loaded    bool
+	loadedAt  time.Time
+	loadedGen uint64
+}
+
+func (e *cacheEntry[T]) invalidate() {
+	e.gen.Add(1)
+}
+
+// get 返回缓存的列表, 缓存失效或超过 maxStale 时调用 load 重新加载; 同一时间只有一个调用方加载
+func (e *cacheEntry[T]) get(ctx context.Context, maxStale time.Duration, now func() time.Time, load func(context.Context) ([]T, error)) ([]T, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	gen := e.gen.Load()
+	if e.loaded && e.loadedGen == gen && now().Sub(e.loadedAt) < maxStale {
+		return slices.Clone(e.items), nil
+	}
+	start := now()
+	items, err := load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	e.items, e.loaded, e.loadedAt, e.loadedGen = items, true, start, gen
+	return slices.Clone(items), nil
+}
+
+// resourceCache 由事件流驱动失效的资源缓存, 方法在 nil 上调用时直接加载
+type resourceCache struct {
+	manager  *Manager
+	maxStale time.Duration
+	now      func() time.Time
+
+	containerRefs cacheEntry[types.Container] // 用于按名称查找容器 ID
+	containers    cacheEntry[ContainerSummary]
+	images        cacheEntry[image.Summary]
+	networks      cacheEntry[NetworkSummary]
+
+	mu     sync.Mutex
+	closed bool
+	ready  chan struct{} // 订阅建立后关闭, 为 nil 时没有订阅
+	stop   context.CancelFunc
+}
+
+func (c *resourceCache) containerRefList(ctx context.Context, load func(context.Context) ([]types.Container, error)) ([]types.Container, error) {
+	if c == nil || !c.subscribe(ctx) {
+		return load(ctx)
+	}
+	return c.containerRefs.get(ctx, c.maxStale, c.now, load)
+}
+
+func (c *resourceCache) containerList(ctx context.Context, load func(context.Context) ([]ContainerSummary, error)) ([]ContainerSummary, error) {
+	if c == nil || !c.subscribe(ctx) {
+		return load(ctx)
+	}
+	return c.containers.get(ctx, c.maxStale, c.now, load)
+}
+
+func (c *resourceCache) imageList(ctx context.Context, load func(context.Context) ([]image.Summary, error)) ([]image.Summary, error) {
+	if c == nil || !c.subscribe(ctx) {
+		return load(ctx)
+	}
+	return c.images.get(ctx, c.maxStale, c.now, load)
+}
+
+func (c *resourceCache) networkList(ctx context.Context, load func(context.Context) ([]NetworkSummary, error)) ([]NetworkSummary, error) {
+	if c == nil || !c.subscribe(ctx) {
+		return load(ctx)
+	}
+	return c.networks.get(ctx, c.maxStale, c.now, load)
+}
+
+func (c *resourceCache) invalidateAll() {
+	if c == nil {
+		return
+	}
+	c.containerRefs.invalidate()
+	c.containers.invalidate()
+	c.images.invalidate()
+	c.networks.invalidate()
+}
+
+// subscribe 确保事件流已订阅, 返回 false 时缓存不可用: Manager 已 Close 或等待订阅期间 ctx 结束
+func (c *resourceCache) subscribe(ctx context.Context) bool {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return false
+	}
+	if c.ready == nil {
+		watchCtx, cancel := context.WithCancel(context.Background())
+		c.ready, c.stop = make(chan struct{}), cancel
+		go c.watch(watchCtx, c.ready)
+	}
+	ready := c.ready
+	c.mu.Unlock()
+
+	select {
+	case <-ready:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// watch 订阅事件流直到出错或 ctx 取消; 出错后使全部缓存失效, 由下一次读取重新订阅
+func (c *resourceCache) watch(ctx context.Context, ready chan struct{}) {
+	messages, errs := c.manager.client.Events(ctx, events.ListOptions{
+		Filters: filters.NewArgs(
+			filters.Arg("type", string(events.ContainerEventType)),
+			filters.Arg("type", string(events.ImageEventType)),
+			filters.Arg("type", string(events.NetworkEventType)),
+		),
+	})
+	// Events 在请求发出后才返回, 订阅之前加载的结果可能已经过期
+	c.invalidateAll()
+	close(ready)
+
+	for {
+		select {
+		case msg := <-messages:
+			c.handle(msg)
+		case <-errs:
+			c.mu.Lock()
+			if c.ready == ready {
+				c.ready = nil
+			}
+			c.mu.Unlock()
+			c.invalidateAll()
+			return
+		}
+	}
+}
+
+// handle 按事件使对应的缓存失效
+func (c *resourceCache) handle(msg events.Message) {
+	switch msg.Type {
+	case events.ContainerEventType:
+		if ignoredContainerAction(msg.Action) {
+			return
+		}
+		c.containerRefs.invalidate()
+		c.containers.invalidate()
+	case events.ImageEventType:
+		c.images.invalidate()
+	case events.NetworkEventType:
+		c.networks.invalidate()
+		if msg.Action == events.ActionConnect || msg.Action == events.ActionDisconnect {
+			// 容器列表中含有容器所在的网络和 IP
+			c.containers.invalidate()
+		}
+	}
+}
+
+// ignoredContainerAction 不改变容器列表的事件, 如 exec 和 attach
+func ignoredContainerAction(action events.Action) bool {
+	if strings.HasPrefix(string(action), "exec_") {
+		return true
+	}
+	switch action {
+	case events.ActionAttach, events.ActionDetach, events.ActionResize, events.ActionTop, events.ActionCopy,
+		events.ActionArchivePath, events.ActionExtractToDir, events.ActionExport, events.ActionCommit:
+		return true
+	}
+	return false
+}
+
+func (c *resourceCache) close() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	if c.stop != nil {
+		c.stop()
+	}
+	c.ready = nil
+}
@@ -0,0 +1,189 @@
+// Package docker
+// Date: 2024/08/22 14:08:27
+// Author: Amu
+// Description:
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/events"
+)
+
+// cacheDaemon 模拟 daemon 的列表接口和事件流, 记录每个接口被请求的次数
+type cacheDaemon struct {
+	mu     sync.Mutex
+	hits   map[string]int
+	events chan events.Message
+	drop   chan struct{} // 关闭当前的事件流
+}
+
+func newCacheDaemon() *cacheDaemon {
+	return &cacheDaemon{hits: make(map[string]int), events: make(chan events.Message), drop: make(chan struct{}, 1)}
+}
+
+func (d *cacheDaemon) count(path string) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.hits[path]
+}
+
+func (d *cacheDaemon) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Path[strings.Index(r.URL.Path[1:], "/")+1:] // 去掉 /v1.46
+	d.mu.Lock()
+	d.hits[path]++
+	d.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	switch path {
+	case "/events":
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		encoder := json.NewEncoder(w)
+		for {
+			select {
+			case msg := <-d.events:
+				_ = encoder.Encode(msg)
+				w.(http.Flusher).Flush()
+			case <-d.drop:
+				return
+			case <-r.Context().Done():
+				return
+			}
+		}
+	case "/networks":
+		_, _ = w.Write([]byte(`[{"Id":"n1","Name":"probe","Driver":"bridge"}]`))
+	case "/images/json":
+		_, _ = w.Write([]byte(`[{"Id":"sha256:1","RepoTags":["redis:7.0.5"],"Created":1700000000,"Size":1000000}]`))
+	case "/containers/json":
+		_, _ = w.Write([]byte(`[{"Id":"c1","Names":["/redis"],"State":"exited"}]`))
+	case "/images/redis:7.0.5/tag":
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"message":"not found"}`))
+	}
+}
+
+// send 发送事件, 事件处理是异步的, 因此等待 path 被重新请求
+func (d *cacheDaemon) send(t *testing.T, msg events.Message, read func(), path string) {
+	t.Helper()
+	before := d.count(path)
+	d.events <- msg
+	deadline := time.Now().Add(5 * time.Second)
+	for d.count(path) == before {
+		if time.Now().After(deadline) {
+			t.Fatalf("%s was not reloaded after %s %s event", path, msg.Type, msg.Action)
+		}
+		time.Sleep(5 * time.Millisecond)
+		read()
+	}
+}
+
+func TestCacheLookups(t *testing.T) {
+	daemon := newCacheDaemon()
+	m := newFakeDaemonManager(t, daemon.ServeHTTP, WithCache(time.Hour))
+	t.Cleanup(func() { _ = m.Close() })
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if nt, err := m.GetNetworkByName(ctx, "probe"); err != nil || nt.ID != "n1" {
+			t.Fatalf("network = %+v, err = %v", nt, err)
+		}
+		if im, err := m.GetImageByName(ctx, "redis:7.0.5"); err != nil || im.ID != "sha256:1" || im.Tag != "7.0.5" {
+			t.Fatalf("image = %+v, err = %v", im, err)
+		}
+		if id, err := m.ResolveContainer(ctx, "redis"); err != nil || id != "c1" {
+			t.Fatalf("id = %q, err = %v", id, err)
+		}
+	}
+	if _, err := m.ListImage(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"/networks", "/images/json", "/containers/json", "/events"} {
+		if n := daemon.count(path); n != 1 {
+			t.Errorf("%s requested %d times", path, n)
+		}
+	}
+
+	// 与容器列表无关的事件不使缓存失效
+	daemon.events <- events.Message{Type: events.ContainerEventType, Action: "exec_start: sh"}
+	daemon.send(t, events.Message{Type: events.NetworkEventType, Action: events.ActionCreate}, func() {
+		_, _ = m.GetNetworkByName(ctx, "probe")
+	}, "/networks")
+	daemon.send(t, events.Message{Type: events.ContainerEventType, Action: events.ActionDestroy}, func() {
+		_, _ = m.ResolveContainer(ctx, "redis")
+	}, "/containers/json")
+	if n := daemon.count("/containers/json"); n != 2 {
+		t.Errorf("/containers/json requested %d times", n)
+	}
+	if n := daemon.count("/images/json"); n != 1 {
+		t.Errorf("/images/json requested %d times", n)
+	}
+
+	// 本 Manager 的修改操作结束后立即失效
+	if err := m.TagImage(ctx, "redis:7.0.5", "redis:latest"); err != nil {
+		t.Fatal(err)
+	}
+	_, _ = m.GetImageByName(ctx, "redis:7.0.5")
+	if n := daemon.count("/images/json"); n != 2 {
+		t.Errorf("/images/json requested %d times", n)
+	}
+}
+
+func TestCacheMaxStale(t *testing.T) {
+	daemon := newCacheDaemon()
+	m := newFakeDaemonManager(t, daemon.ServeHTTP, WithCache(time.Minute))
+	t.Cleanup(func() { _ = m.Close() })
+	now := time.Now()
+	m.cache.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	_, _ = m.ListNetwork(ctx)
+	now = now.Add(59 * time.Second)
+	_, _ = m.ListNetwork(ctx)
+	if n := daemon.count("/networks"); n != 1 {
+		t.Errorf("/networks requested %d times", n)
+	}
+	now = now.Add(time.Second)
+	_, _ = m.ListNetwork(ctx)
+	if n := daemon.count("/networks"); n != 2 {
+		t.Errorf("/networks requested %d times", n)
+	}
+}
+
+func TestCacheResubscribe(t *testing.T) {
+	daemon := newCacheDaemon()
+	m := newFakeDaemonManager(t, daemon.ServeHTTP, WithCache(time.Hour))
+	ctx := context.Background()
+
+	_, _ = m.ListNetwork(ctx)
+	daemon.drop <- struct{}{}
+	// 事件流断开后缓存失效, 下次读取时重新订阅并重新加载
+	deadline := time.Now().Add(5 * time.Second)
+	for daemon.count("/events") < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("events stream was not resubscribed")
+		}
+		time.Sleep(5 * time.Millisecond)
+		_, _ = m.ListNetwork(ctx)
+	}
+	if n := daemon.count("/networks"); n < 2 {
+		t.Errorf("/networks requested %d times", n)
+	}
+
+	// Close 后不再使用缓存
+	_ = m.Close()
+	before := daemon.count("/networks")
+	_, _ = m.ListNetwork(ctx)
+	_, _ = m.ListNetwork(ctx)
+	if n := daemon.count("/networks"); n != before+2 {
+		t.Errorf("/networks requested %d times after Close, want %d", n, before+2)
+	}
+}
@@ -0,0 +1,363 @@
+// Package docker
+// Date: 2024/08/07 14:22:05
+// Author: Amu
+// Description:
+package docker
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/go-connections/nat"
+)
+
+// CloneOverrides 复制容器时覆盖的配置, 零值表示沿用原容器的配置
+type CloneOverrides struct {
+	Image         string
+	Env           []string          // 形如 KEY=VALUE, 覆盖原容器中同名的变量
+	Labels        map[string]string // 与原容器的标签合并
+	Cmd           []string
+	Ports         []string // 不为 nil 时替换原容器的端口映射, 宿主机端口可写作 auto
+	Volumes       []string // 不为 nil 时替换原容器的卷挂载
+	RestartPolicy string
+	Memory        int64
+	CPUs          float64
+}
+
+// CloneContainer 以容器的当前配置创建一个名为 newName 的新容器, 新容器不会启动。
+// 原容器的静态 IP 不会被复制, 沿用的宿主机端口仍会做冲突检查, 原容器运行时需通过 overrides.Ports 更换端口
+func (m *Manager) CloneContainer(ctx context.Context, containerID, newName string, overrides CloneOverrides) (id string, err error) {
+	defer m.invalidate()
+	defer m.audit(ctx, "CloneContainer", auditArgs{"container": containerID, "name": newName, "overrides": auditCloneOverrides(overrides)}).done(&id, &err)
+	containerID, err = m.ResolveContainer(ctx, containerID)
+	if err != nil {
+		return "", err
+	}
+	exists, err := m.HasSameNameContainer(ctx, newName)
+	if err != nil {
+		return "", err
+	}
+	if exists {
+		return "", fmt.Errorf("container %s already exists", newName)
+	}
+	inspect, imageConfig, err := m.inspectForRecreate(ctx, containerID)
+	if err != nil {
+		return "", err
+	}
+	cfg := createConfigFromInspect(inspect, imageConfig, m.client.ClientVersion())
+
+	sourceName := strings.TrimPrefix(inspect.Name, "/")
+	if cfg.Config.Hostname == sourceName {
+		cfg.Config.Hostname = newName
+	}
+	for _, endpoints := range []map[string]*network.EndpointSettings{cfg.NetworkingConfig.EndpointsConfig, cfg.ExtraNetworks} {
+		for _, settings := range endpoints {
+			settings.IPAMConfig = nil
+			settings.Aliases = withoutValue(settings.Aliases, sourceName)
+		}
+	}
+
+	if err := applyCloneOverrides(cfg, overrides); err != nil {
+		return "", err
+	}
+
+	ports := overrides.Ports
+	if ports == nil {
+		ports = portSpecs(cfg.HostConfig.PortBindings)
+	}
+	if m.portAllocator != nil {
+		m.portAllocator.mu.Lock()
+		defer m.portAllocator.mu.Unlock()
+	}
+	mappings, err := m.PreparePorts(ctx, ports)
+	if err != nil {
+		return "", err
+	}
+	cfg.HostConfig.PortBindings = make(nat.PortMap)
+	for _, mapping := range mappings {
+		port, err := nat.NewPort(mapping.Proto, mapping.ContainerPort)
+		if err != nil {
+			return "", err
+		}
+		cfg.HostConfig.PortBindings[port] = append(cfg.HostConfig.PortBindings[port], nat.PortBinding{
+			HostIP:   mapping.IP,
+			HostPort: mapping.HostPort,
+		})
+		if cfg.Config.ExposedPorts == nil {
+			cfg.Config.ExposedPorts = make(nat.PortSet)
+		}
+		cfg.Config.ExposedPorts[port] = struct{}{}
+	}
+
+	return m.createFromConfig(ctx, cfg, newName)
+}
+
+func applyCloneOverrides(cfg *createConfig, overrides CloneOverrides) error {
+	if overrides.Image != "" {
+		cfg.Config.Image = overrides.Image
+	}
+	if len(overrides.Env) > 0 {
+		cfg.Config.Env = overrideEnv(cfg.Config.Env, overrides.Env)
+	}
+	if len(overrides.Labels) > 0 {
+		cfg.Config.Labels = mergeLabels(cfg.Config.Labels, overrides.Labels)
+	}
+	if overrides.Cmd != nil {
+		cfg.Config.Cmd = overrides.Cmd
+	}
+	if overrides.Volumes != nil {
+		binds, err := parseVolumes(overrides.Volumes)
+		if err != nil {
+			return err
+		}
+		cfg.HostConfig.Binds = binds
+	}
+	if overrides.RestartPolicy != "" {
+		restartPolicy, err := parseRestartPolicy(overrides.RestartPolicy)
+		if err != nil {
+			return err
+		}
+		cfg.HostConfig.RestartPolicy = restartPolicy
+	}
+	if overrides.Memory != 0 {
+		cfg.HostConfig.Memory = overrides.Memory
+	}
+	if overrides.CPUs != 0 {
+		cfg.HostConfig.NanoCPUs = int64(overrides.CPUs * 1e9)
+	}
+	return nil
+}
+
+// overrideEnv 按原有顺序替换同名变量, 新增的变量追加在末尾
+func overrideEnv(envs, overrides []string) []string {
+	values := envMap(overrides)
+	result := make([]string, 0, len(envs)+len(overrides))
+	for _, env := range envs {
+		key, _, _ := strings.Cut(env, "=")
+		if value, ok := values[key]; ok {
+			result = append(result, key+"="+value)
+			delete(values, key)
+			continue
+		}
+		result = append(result, env)
+	}
+	for _, env := range overrides {
+		key, _, _ := strings.Cut(env, "=")
+		if value, ok := values[key]; ok {
+			result = append(result, key+"="+value)
+			delete(values, key)
+		}
+	}
+	return result
+}
+
+func withoutValue(values []string, value string) []string {
+	var result []string
+	for _, v := range values {
+		if v != value {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// portSpecs 将端口绑定转换为 ContainerSpec.Ports 的格式
+func portSpecs(bindings nat.PortMap) []string {
+	var specs []string
+	for port, portBindings := range bindings {
+		if len(portBindings) == 0 {
+			specs = append(specs, string(port))
+			continue
+		}
+		for _, binding := range portBindings {
+			switch {
+			case binding.HostPort == "":
+				specs = append(specs, string(port))
+			case isUnspecifiedIP(binding.HostIP) && binding.HostIP != "::":
+				specs = append(specs, fmt.Sprintf("%s:%s", binding.HostPort, port))
+			default:
+				specs = append(specs, fmt.Sprintf("%s:%s", net.JoinHostPort(binding.HostIP, binding.HostPort), port))
+			}
+		}
+	}
+	sort.Strings(specs)
+	return specs
+}
+
+// ContainerToSpec 将容器的配置导出为 ContainerSpec, 可用于 CreateContainerWithSpec、Reconcile 或 RunCommand。
+// 与镜像默认值相同的环境变量、标签和命令不会被导出; ContainerSpec 没有的配置会被丢弃, 包括入口点(Entrypoint)、
+// 用户、工作目录、健康检查、HostConfig.Mounts(含匿名卷)以及特权、设备、日志等其余 HostConfig 字段,
+// 需要完整复制容器时使用 CloneContainer
+func (m *Manager) ContainerToSpec(ctx context.Context, containerID string) (*ContainerSpec, error) {
+	containerID, err := m.ResolveContainer(ctx, containerID)
+	if err != nil {
+		return nil, err
+	}
+	inspect, imageConfig, err := m.inspectForRecreate(ctx, containerID)
+	if err != nil {
+		return nil, err
+	}
+	cfg := createConfigFromInspect(inspect, imageConfig, m.client.ClientVersion())
+	return specFromCreateConfig(strings.TrimPrefix(inspect.Name, "/"), cfg), nil
+}
+
+func specFromCreateConfig(name string, cfg *createConfig) *ContainerSpec {
+	spec := &ContainerSpec{
+		Name:          name,
+		Image:         cfg.Config.Image,
+		Ports:         portSpecs(cfg.HostConfig.PortBindings),
+		Volumes:       cfg.HostConfig.Binds,
+		Env:           cfg.Config.Env,
+		Cmd:           cfg.Config.Cmd,
+		Labels:        cfg.Config.Labels,
+		RestartPolicy: formatRestartPolicy(cfg.HostConfig.RestartPolicy),
+		Memory:        cfg.HostConfig.Memory,
+		CPUs:          float64(cfg.HostConfig.NanoCPUs) / 1e9,
+		NoTty:         !cfg.Config.Tty,
+	}
+	if len(spec.Labels) == 0 {
+		spec.Labels = nil
+	}
+
+	primary := cfg.HostConfig.NetworkMode.NetworkName()
+	if primary == network.NetworkDefault {
+		primary = network.NetworkBridge
+	}
+	// spec 中的网络不区分创建时接入还是创建后连接, 主网络排在第一个
+	endpoints := make(map[string]*network.EndpointSettings)
+	for networkName, settings := range cfg.ExtraNetworks {
+		endpoints[networkName] = settings
+	}
+	for networkName, settings := range cfg.NetworkingConfig.EndpointsConfig {
+		endpoints[networkName] = settings
+	}
+	names := make([]string, 0, len(endpoints))
+	for networkName := range endpoints {
+		if networkName != primary {
+			names = append(names, networkName)
+		}
+	}
+	sort.Strings(names)
+	if _, ok := endpoints[primary]; ok {
+		names = append([]string{primary}, names...)
+	}
+	for _, networkName := range names {
+		settings := endpoints[networkName]
+		attachment := NetworkAttachment{
+			Network: networkName,
+			EndpointOptions: EndpointOptions{
+				Aliases: withoutValue(settings.Aliases, name),
+				Links:   settings.Links,
+			},
+		}
+		if settings.IPAMConfig != nil {
+			attachment.IPv4Address = settings.IPAMConfig.IPv4Address
+			attachment.IPv6Address = settings.IPAMConfig.IPv6Address
+		}
+		spec.Networks = append(spec.Networks, attachment)
+	}
+	return spec
+}
+
+// RunCommand 生成与 spec 等价的 docker run 命令行
+func (s *ContainerSpec) RunCommand() string {
+	args := []string{"docker", "run", "-d"}
+	if !s.NoTty {
+		args = append(args, "-t")
+	}
+	if s.Name != "" {
+		args = append(args, "--name", s.Name)
+	}
+	restartPolicy := s.RestartPolicy
+	if restartPolicy == "" {
+		restartPolicy = string(container.RestartPolicyAlways)
+	}
+	args = append(args, "--restart", restartPolicy)
+
+	if len(s.Networks) == 1 {
+		attachment := s.Networks[0]
+		args = append(args, "--network", attachment.Network)
+		for _, alias := range attachment.Aliases {
+			args = append(args, "--network-alias", alias)
+		}
+		if attachment.IPv4Address != "" {
+			args = append(args, "--ip", attachment.IPv4Address)
+		}
+		if attachment.IPv6Address != "" {
+			args = append(args, "--ip6", attachment.IPv6Address)
+		}
+		for _, link := range attachment.Links {
+			args = append(args, "--link", link)
+		}
+	} else {
+		// 接入多个网络时使用 --network 的高级语法
+		for _, attachment := range s.Networks {
+			fields := []string{"name=" + attachment.Network}
+			for _, alias := range attachment.Aliases {
+				fields = append(fields, "alias="+alias)
+			}
+			if attachment.IPv4Address != "" {
+				fields = append(fields, "ip="+attachment.IPv4Address)
+			}
+			if attachment.IPv6Address != "" {
+				fields = append(fields, "ip6="+attachment.IPv6Address)
+			}
+			args = append(args, "--network", strings.Join(fields, ","))
+		}
+	}
+
+	for _, port := range s.Ports {
+		args = append(args, "-p", port)
+	}
+	for _, volume := range s.Volumes {
+		args = append(args, "-v", volume)
+	}
+	for _, env := range s.Env {
+		args = append(args, "-e", env)
+	}
+	labels := make([]string, 0, len(s.Labels))
+	for k, v := range s.Labels {
+		labels = append(labels, k+"="+v)
+	}
+	sort.Strings(labels)
+	for _, label := range labels {
+		args = append(args, "--label", label)
+	}
+	if s.Memory > 0 {
+		args = append(args, "--memory", strconv.FormatInt(s.Memory, 10))
+	}
+	if s.CPUs > 0 {
+		args = append(args, "--cpus", strconv.FormatFloat(s.CPUs, 'f', -1, 64))
+	}
+	args = append(args, s.Image)
+	args = append(args, s.Cmd...)
+
+	for i := range args {
+		args[i] = shellQuote(args[i])
+	}
+	return strings.Join(args, " ")
+}
+
+// shellQuote 对包含特殊字符的参数加单引号
+func shellQuote(s string) string {
+	if s == "" {
+		return "''"
+	}
+	safe := true
+	for _, r := range s {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_./:=,@%+", r)) {
+			safe = false
+			break
+		}
+	}
+	if safe {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,130 @@
+// Package docker
+// Date: 2024/08/07 14:25:40
+// Author: Amu
+// Description:
+package docker
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/go-connections/nat"
+)
+
+func TestCloneContainer(t *testing.T) {
+	manager, _ := NewManager(WithPortAllocator(NewPortAllocator(0, 0, true)))
+	containerID, err := manager.CloneContainer(context.Background(), "redis", "redis-clone", CloneOverrides{
+		Ports: []string{"auto:6379/tcp"},
+		Env:   []string{"MODE=standalone"},
+	})
+	if err != nil {
+		t.Fatalf("clone container error: %v", err)
+	}
+	t.Logf("clone container id: %s", containerID)
+}
+
+func TestContainerToSpec(t *testing.T) {
+	manager, _ := NewManager()
+	spec, err := manager.ContainerToSpec(context.Background(), "redis")
+	if err != nil {
+		t.Fatalf("container to spec error: %v", err)
+	}
+	t.Log(spec.RunCommand())
+}
+
+func TestSpecFromCreateConfig(t *testing.T) {
+	cfg := &createConfig{
+		Config: &container.Config{
+			Image:  "redis:7.0.5",
+			Env:    []string{"MODE=cluster"},
+			Cmd:    []string{"redis-server", "--appendonly", "yes"},
+			Labels: map[string]string{},
+		},
+		HostConfig: &container.HostConfig{
+			NetworkMode:   "test",
+			Binds:         []string{"/data:/data:rw"},
+			RestartPolicy: container.RestartPolicy{Name: container.RestartPolicyOnFailure, MaximumRetryCount: 3},
+			Resources:     container.Resources{Memory: 256 << 20, NanoCPUs: 1500000000},
+			PortBindings: nat.PortMap{
+				"6379/tcp":  {{HostIP: "0.0.0.0", HostPort: "6379"}},
+				"16379/tcp": {{HostIP: "127.0.0.1", HostPort: "16379"}},
+			},
+		},
+		NetworkingConfig: &network.NetworkingConfig{EndpointsConfig: map[string]*network.EndpointSettings{
+			"test": {Aliases: []string{"cache", "redis"}, IPAMConfig: &network.EndpointIPAMConfig{IPv4Address: "172.20.0.10"}},
+		}},
+		ExtraNetworks: map[string]*network.EndpointSettings{"backend": {}},
+	}
+
+	spec := specFromCreateConfig("redis", cfg)
+	want := &ContainerSpec{
+		Name:  "redis",
+		Image: "redis:7.0.5",
+		Networks: []NetworkAttachment{
+			{Network: "test", EndpointOptions: EndpointOptions{Aliases: []string{"cache"}, IPv4Address: "172.20.0.10"}},
+			{Network: "backend"},
+		},
+		Ports:         []string{"127.0.0.1:16379:16379/tcp", "6379:6379/tcp"},
+		Volumes:       []string{"/data:/data:rw"},
+		Env:           []string{"MODE=cluster"},
+		Cmd:           []string{"redis-server", "--appendonly", "yes"},
+		RestartPolicy: "on-failure:3",
+		Memory:        256 << 20,
+		CPUs:          1.5,
+		NoTty:         true,
+	}
+	if !reflect.DeepEqual(spec, want) {
+		t.Fatalf("spec = %#v, want %#v", spec, want)
+	}
+
+	command := spec.RunCommand()
+	// 源容器没有分配伪终端, 不应输出 -t
+	wantCommand := "docker run -d --name redis --restart on-failure:3 --network name=test,alias=cache,ip=172.20.0.10 --network name=backend " +
+		"-p 127.0.0.1:16379:16379/tcp -p 6379:6379/tcp -v /data:/data:rw -e MODE=cluster --memory 268435456 --cpus 1.5 redis:7.0.5 redis-server --appendonly yes"
+	if command != wantCommand {
+		t.Errorf("command = %s\nwant      %s", command, wantCommand)
+	}
+}
+
+func TestRunCommandQuote(t *testing.T) {
+	spec := &ContainerSpec{
+		Name:     "web",
+		Image:    "nginx",
+		Networks: []NetworkAttachment{{Network: "test", EndpointOptions: EndpointOptions{Aliases: []string{"www"}}}},
+		Env:      []string{"GREETING=hello world", "QUOTE=it's"},
+		Labels:   map[string]string{ServerTypeLabel: WebServer},
+	}
+	want := "docker run -d -t --name web --restart always --network test --network-alias www " +
+		`-e 'GREETING=hello world' -e 'QUOTE=it'\''s' --label server.type=web nginx`
+	if command := spec.RunCommand(); command != want {
+		t.Errorf("command = %s\nwant      %s", command, want)
+	}
+}
+
+func TestOverrideEnv(t *testing.T) {
+	env := overrideEnv([]string{"A=1", "B=2", "C=3"}, []string{"D=4", "B=20"})
+	want := []string{"A=1", "B=20", "C=3", "D=4"}
+	if !reflect.DeepEqual(env, want) {
+		t.Errorf("env = %v, want %v", env, want)
+	}
+}
+
+func TestParseRestartPolicy(t *testing.T) {
+	policy, err := parseRestartPolicy("")
+	if err != nil || policy.Name != container.RestartPolicyAlways {
+		t.Errorf("default policy = %v, %v", policy, err)
+	}
+	policy, err = parseRestartPolicy("on-failure:5")
+	if err != nil || policy.Name != container.RestartPolicyOnFailure || policy.MaximumRetryCount != 5 {
+		t.Errorf("on-failure policy = %v, %v", policy, err)
+	}
+	if _, err := parseRestartPolicy("sometimes"); err == nil {
+		t.Error("invalid policy should fail")
+	}
+	if _, err := parseRestartPolicy("always:3"); err == nil {
+		t.Error("retry count is only valid for on-failure")
+	}
+}
@@ -0,0 +1,239 @@
+// Package main
+// Date: 2024/08/14 10:40:05
+// Author: Amu
+// Description:
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/amuluze/docker"
+	"github.com/docker/go-units"
+)
+
+func (a *app) ps(ctx context.Context, args []string) error {
+	fs := a.flagSet("ps")
+	filter := labelFilterFlags(fs)
+	format := formatFlags(fs)
+	rest, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 {
+		return usagef("unexpected argument %q", rest[0])
+	}
+
+	containers, err := a.manager.ListContainer(ctx)
+	if err != nil {
+		return err
+	}
+	result := make([]docker.ContainerSummary, 0, len(containers))
+	for _, c := range containers {
+		if filter.match(c.Labels) {
+			result = append(result, c)
+		}
+	}
+	return write(a.stdout, *format, result, containerTable(result))
+}
+
+func (a *app) create(ctx context.Context, args []string) error {
+	fs := a.flagSet("create")
+	spec := docker.ContainerSpec{Labels: map[string]string{}}
+	var networks, ports, volumes, env stringsFlag
+	var memory string
+	var probe bool
+	fs.StringVar(&spec.Name, "name", "", "container `name` (required)")
+	fs.Var(&networks, "network", "connect to `network` (repeatable, the first one is the primary network)")
+	fs.Var(&ports, "p", "publish a port, `[ip:]host:container[/proto]`, host may be auto (repeatable)")
+	fs.Var(&volumes, "v", "bind mount a volume, `host:container[:ro]` (repeatable)")
+	fs.Var(&env, "e", "set an environment variable `KEY=value` (repeatable)")
+	fs.Var(labelsFlag(spec.Labels), "label", "set a label `key=value` (repeatable)")
+	fs.StringVar(&spec.RestartPolicy, "restart", "", "restart `policy`: no, always, unless-stopped or on-failure[:max] (default always)")
+	fs.StringVar(&memory, "memory", "", "memory `limit`, e.g. 512m")
+	fs.Float64Var(&spec.CPUs, "cpus", 0, "number of `CPUs`")
+	fs.BoolVar(&probe, "probe", false, "mark the container as created by probe (label "+docker.CreatedByProbe+"=true)")
+	rest, err := parseUntilArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if spec.Name == "" {
+		return usagef("--name is required")
+	}
+	if len(rest) == 0 {
+		return usagef("image is required")
+	}
+	if memory != "" {
+		if spec.Memory, err = units.RAMInBytes(memory); err != nil {
+			return usagef("invalid memory limit %q", memory)
+		}
+	}
+	if probe {
+		spec.Labels[docker.CreatedByProbe] = "true"
+	}
+	spec.Image = rest[0]
+	spec.Cmd = rest[1:]
+	for _, name := range networks {
+		spec.Networks = append(spec.Networks, docker.NetworkAttachment{Network: name})
+	}
+	spec.Ports, spec.Volumes, spec.Env = ports, volumes, env
+
+	id, err := a.manager.CreateContainerWithSpec(ctx, spec)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(a.stdout, id)
+	return nil
+}
+
+// eachContainer 对每个容器执行 fn, 成功时输出参数, 失败时继续处理其余容器
+func (a *app) eachContainer(ctx context.Context, name string, args []string, fn func(ctx context.Context, containerID string) error) error {
+	rest, err := parse(a.flagSet(name), args)
+	if err != nil {
+		return err
+	}
+	return a.each(ctx, rest, fn)
+}
+
+func (a *app) each(ctx context.Context, containers []string, fn func(ctx context.Context, containerID string) error) error {
+	if len(containers) == 0 {
+		return usagef("at least one container is required")
+	}
+	var errs []error
+	for _, c := range containers {
+		if err := fn(ctx, c); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", c, err))
+			continue
+		}
+		fmt.Fprintln(a.stdout, c)
+	}
+	return errors.Join(errs...)
+}
+
+func (a *app) start(ctx context.Context, args []string) error {
+	return a.eachContainer(ctx, "start", args, a.manager.StartContainer)
+}
+
+func (a *app) stop(ctx context.Context, args []string) error {
+	return a.eachContainer(ctx, "stop", args, a.manager.StopContainer)
+}
+
+func (a *app) restart(ctx context.Context, args []string) error {
+	return a.eachContainer(ctx, "restart", args, a.manager.RestartContainer)
+}
+
+// rm 指定了标签条件时, 只删除满足条件的容器, 避免误删不是由 probe 管理的容器
+func (a *app) rm(ctx context.Context, args []string) error {
+	fs := a.flagSet("rm")
+	filter := labelFilterFlags(fs)
+	rest, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if filter.empty() {
+		return a.each(ctx, rest, a.manager.DeleteContainer)
+	}
+
+	containers, err := a.manager.ListContainer(ctx)
+	if err != nil {
+		return err
+	}
+	labels := make(map[string]map[string]string, len(containers))
+	for _, c := range containers {
+		labels[c.ID] = c.Labels
+	}
+	return a.each(ctx, rest, func(ctx context.Context, containerID string) error {
+		id, err := a.manager.ResolveContainer(ctx, containerID)
+		if err != nil {
+			return err
+		}
+		if !filter.match(labels[id]) {
+			return errors.New("container does not match the label filter, not removed")
+		}
+		return a.manager.DeleteContainer(ctx, id)
+	})
+}
+
+func (a *app) logs(ctx context.Context, args []string) error {
+	fs := a.flagSet("logs")
+	var opts docker.LogsOptions
+	fs.BoolVar(&opts.Follow, "f", false, "follow log output")
+	fs.BoolVar(&opts.Follow, "follow", false, "follow log output")
+	fs.StringVar(&opts.Tail, "tail", "all", "number of `lines` to show from the end of the logs")
+	fs.StringVar(&opts.Since, "since", "", "show logs since `time`, a timestamp or a duration like 10m")
+	fs.StringVar(&opts.Until, "until", "", "show logs before `time`, a timestamp or a duration like 10m")
+	fs.BoolVar(&opts.Timestamps, "t", false, "show timestamps")
+	fs.BoolVar(&opts.Timestamps, "timestamps", false, "show timestamps")
+	rest, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 1 {
+		return usagef("exactly one container is required")
+	}
+
+	logs, err := a.manager.ContainerLogsWithOptions(ctx, rest[0], opts)
+	if err != nil {
+		return err
+	}
+	defer logs.Close()
+	if _, err := io.Copy(a.stdout, logs); err != nil && ctx.Err() == nil {
+		return err
+	}
+	return nil
+}
+
+// stats 默认对每个容器采样一次; --stream 时持续输出一个容器的采样, 直到中断
+func (a *app) stats(ctx context.Context, args []string) error {
+	fs := a.flagSet("stats")
+	format := formatFlags(fs)
+	var stream bool
+	fs.BoolVar(&stream, "stream", false, "stream samples of a single container until interrupted")
+	rest, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) == 0 {
+		return usagef("at least one container is required")
+	}
+
+	if !stream {
+		stats := make([]docker.ContainerStats, 0, len(rest))
+		for _, c := range rest {
+			s, err := a.manager.GetContainerStats(ctx, c)
+			if err != nil {
+				return fmt.Errorf("%s: %w", c, err)
+			}
+			stats = append(stats, *s)
+		}
+		return write(a.stdout, *format, stats, statsTable(stats))
+	}
+
+	if len(rest) != 1 {
+		return usagef("--stream accepts exactly one container")
+	}
+	// 表格每次采样输出一行, JSON 每次采样输出一行, YAML 以文档分隔符分隔
+	tw := tabwriter.NewWriter(a.stdout, 12, 4, 3, ' ', 0)
+	if *format == formatTable {
+		fmt.Fprintln(tw, strings.Join(statsHeader, "\t"))
+	}
+	err = a.manager.StreamContainerStats(ctx, rest[0], func(s *docker.ContainerStats) error {
+		switch *format {
+		case formatJSON:
+			return writeJSONLine(a.stdout, s)
+		case formatYAML:
+			fmt.Fprintln(a.stdout, "---")
+			return write(a.stdout, formatYAML, s, table{})
+		}
+		fmt.Fprintln(tw, strings.Join(statsRow(*s), "\t"))
+		return tw.Flush()
+	})
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
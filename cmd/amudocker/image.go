@@ -0,0 +1,110 @@
+// Package main
+// Date: 2024/08/14 11:05:33
+// Author: Amu
+// Description:
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/amuluze/docker"
+)
+
+func (a *app) images(ctx context.Context, args []string) error {
+	fs := a.flagSet("images")
+	format := formatFlags(fs)
+	rest, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	// 可选的参数为仓库名, 与 docker images REPOSITORY 一致
+	var repository string
+	switch len(rest) {
+	case 0:
+	case 1:
+		repository = rest[0]
+	default:
+		return usagef("at most one repository is allowed")
+	}
+
+	images, err := a.manager.ListImage(ctx)
+	if err != nil {
+		return err
+	}
+	result := make([]docker.ImageSummary, 0, len(images))
+	for _, im := range images {
+		if repository == "" || im.Name == repository {
+			result = append(result, im)
+		}
+	}
+	return write(a.stdout, *format, result, imageTable(result))
+}
+
+func (a *app) pull(ctx context.Context, args []string) error {
+	rest, err := parse(a.flagSet("pull"), args)
+	if err != nil {
+		return err
+	}
+	if len(rest) == 0 {
+		return usagef("at least one image is required")
+	}
+	var errs []error
+	for _, name := range rest {
+		if err := a.manager.PullImage(ctx, name); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			continue
+		}
+		fmt.Fprintln(a.stdout, name)
+	}
+	return errors.Join(errs...)
+}
+
+func (a *app) tag(ctx context.Context, args []string) error {
+	rest, err := parse(a.flagSet("tag"), args)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 2 {
+		return usagef("source and target are required")
+	}
+	return a.manager.TagImage(ctx, rest[0], rest[1])
+}
+
+func (a *app) save(ctx context.Context, args []string) error {
+	fs := a.flagSet("save")
+	var output string
+	fs.StringVar(&output, "o", "", "write to `file` (required)")
+	fs.StringVar(&output, "output", "", "write to `file` (required)")
+	rest, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if output == "" {
+		return usagef("-o is required")
+	}
+	if len(rest) == 0 {
+		return usagef("at least one image is required")
+	}
+	return a.manager.ExportImage(ctx, rest, output)
+}
+
+func (a *app) load(ctx context.Context, args []string) error {
+	fs := a.flagSet("load")
+	var input string
+	fs.StringVar(&input, "i", "", "read from tar archive `file` (required)")
+	fs.StringVar(&input, "input", "", "read from tar archive `file` (required)")
+	rest, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if input == "" {
+		return usagef("-i is required")
+	}
+	if len(rest) > 0 {
+		return usagef("unexpected argument %q", strings.Join(rest, " "))
+	}
+	return a.manager.ImportImage(ctx, input)
+}
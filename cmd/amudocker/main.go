@@ -0,0 +1,254 @@
+// Package main
+// Date: 2024/08/14 09:30:12
+// Author: Amu
+// Description: amudocker 命令行工具, 以子命令的形式提供 IManager 的功能
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+
+	"github.com/amuluze/docker"
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	manager, err := docker.NewManager()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "amudocker:", err)
+		os.Exit(1)
+	}
+	a := &app{manager: manager, stdout: os.Stdout, stderr: os.Stderr}
+	os.Exit(a.run(ctx, os.Args[1:]))
+}
+
+// app 命令行的运行环境, 测试时替换 manager 和输出
+type app struct {
+	manager docker.IManager
+	stdout  io.Writer
+	stderr  io.Writer
+}
+
+type command struct {
+	name    string
+	args    string // 用法中的参数说明
+	summary string
+	run     func(ctx context.Context, args []string) error
+}
+
+// usageError 参数错误, 退出码为 2; reported 为 true 时 flag 包已经输出了错误和用法
+type usageError struct {
+	message  string
+	reported bool
+}
+
+func (e *usageError) Error() string {
+	return e.message
+}
+
+func usagef(format string, args ...any) error {
+	return &usageError{message: fmt.Sprintf(format, args...)}
+}
+
+func (a *app) commands() []command {
+	return []command{
+		{"ps", "[options]", "List containers", a.ps},
+		{"create", "[options] IMAGE [COMMAND] [ARG...]", "Create a container", a.create},
+		{"start", "CONTAINER...", "Start containers", a.start},
+		{"stop", "CONTAINER...", "Stop containers", a.stop},
+		{"restart", "CONTAINER...", "Restart containers", a.restart},
+		{"rm", "[options] CONTAINER...", "Remove containers", a.rm},
+		{"logs", "[options] CONTAINER", "Print the logs of a container", a.logs},
+		{"stats", "[options] CONTAINER...", "Show resource usage of containers", a.stats},
+		{"images", "[options]", "List images", a.images},
+		{"pull", "IMAGE...", "Pull images", a.pull},
+		{"tag", "SOURCE TARGET", "Tag an image", a.tag},
+		{"save", "-o FILE IMAGE...", "Save images to a tar archive", a.save},
+		{"load", "-i FILE", "Load images from a tar archive", a.load},
+		{"networks", "[options]", "List networks", a.networks},
+		{"join", "[options] CONTAINER NETWORK", "Connect a container to a network", a.join},
+		{"leave", "CONTAINER NETWORK", "Disconnect a container from a network", a.leave},
+	}
+}
+
+// run 执行一条命令并返回退出码
+func (a *app) run(ctx context.Context, args []string) int {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		a.usage()
+		if len(args) == 0 {
+			return 2
+		}
+		return 0
+	}
+	for _, cmd := range a.commands() {
+		if cmd.name != args[0] {
+			continue
+		}
+		err := cmd.run(ctx, args[1:])
+		var ue *usageError
+		switch {
+		case err == nil:
+			return 0
+		case errors.Is(err, flag.ErrHelp):
+			return 0
+		case errors.As(err, &ue):
+			if ue.reported {
+				return 2
+			}
+			fmt.Fprintf(a.stderr, "amudocker %s: %s\nUsage: amudocker %s %s\n", cmd.name, ue.message, cmd.name, cmd.args)
+			return 2
+		default:
+			fmt.Fprintf(a.stderr, "amudocker %s: %v\n", cmd.name, err)
+			return 1
+		}
+	}
+	fmt.Fprintf(a.stderr, "amudocker: unknown command %q\n", args[0])
+	a.usage()
+	return 2
+}
+
+func (a *app) usage() {
+	fmt.Fprintln(a.stderr, "Usage: amudocker COMMAND [options] [ARG...]")
+	fmt.Fprintln(a.stderr, "\nCommands:")
+	tw := tabwriter.NewWriter(a.stderr, 0, 4, 2, ' ', 0)
+	for _, cmd := range a.commands() {
+		fmt.Fprintf(tw, "  %s\t%s\n", cmd.name, cmd.summary)
+	}
+	_ = tw.Flush()
+	fmt.Fprintln(a.stderr, "\nRun 'amudocker COMMAND -h' for the options of a command.")
+}
+
+// flagSet 创建子命令的参数集, 解析错误由 run 统一输出
+func (a *app) flagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(a.stderr)
+	for _, cmd := range a.commands() {
+		if cmd.name != name {
+			continue
+		}
+		cmd := cmd
+		fs.Usage = func() {
+			fmt.Fprintf(a.stderr, "Usage: amudocker %s %s\n\n%s\n", cmd.name, cmd.args, cmd.summary)
+			if hasFlags(fs) {
+				fmt.Fprintln(a.stderr, "\nOptions:")
+				fs.PrintDefaults()
+			}
+		}
+		break
+	}
+	return fs
+}
+
+func hasFlags(fs *flag.FlagSet) bool {
+	n := 0
+	fs.VisitAll(func(*flag.Flag) { n++ })
+	return n > 0
+}
+
+// parse 解析参数, 选项可以出现在位置参数之后; -- 之后的内容全部作为位置参数
+func parse(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, parseError(err)
+		}
+		rest := fs.Args()
+		if consumed := len(args) - len(rest); consumed > 0 && args[consumed-1] == "--" {
+			return append(positional, rest...), nil
+		}
+		if len(rest) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+}
+
+// parseUntilArgs 解析参数, 选项只能出现在第一个位置参数之前, 之后的内容全部作为位置参数,
+// 与 docker run 一致, 用于 IMAGE 之后是容器命令的子命令
+func parseUntilArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	if err := fs.Parse(args); err != nil {
+		return nil, parseError(err)
+	}
+	return fs.Args(), nil
+}
+
+func parseError(err error) error {
+	if errors.Is(err, flag.ErrHelp) {
+		return err
+	}
+	return &usageError{message: err.Error(), reported: true}
+}
+
+// stringsFlag 可重复出现的字符串参数
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringsFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// labelsFlag 形如 key=value 的标签, 可重复出现
+type labelsFlag map[string]string
+
+func (l labelsFlag) String() string {
+	pairs := make([]string, 0, len(l))
+	for _, k := range sortedKeys(l) {
+		pairs = append(pairs, k+"="+l[k])
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (l labelsFlag) Set(value string) error {
+	key, v, _ := strings.Cut(value, "=")
+	if key == "" {
+		return fmt.Errorf("invalid label %q", value)
+	}
+	l[key] = v
+	return nil
+}
+
+// labelFilter 过滤列表的标签条件, 与 REST 接口的 label 查询参数含义相同:
+// key 只要求标签存在, key=value 要求值相等; --probe 只保留由 probe 创建的资源
+type labelFilter struct {
+	labels labelsFlag
+	probe  bool
+}
+
+func labelFilterFlags(fs *flag.FlagSet) *labelFilter {
+	f := &labelFilter{labels: labelsFlag{}}
+	fs.Var(f.labels, "label", "filter by label `key[=value]` (repeatable)")
+	fs.BoolVar(&f.probe, "probe", false, "only resources created by probe (label "+docker.CreatedByProbe+"=true)")
+	return f
+}
+
+func (f *labelFilter) empty() bool {
+	return len(f.labels) == 0 && !f.probe
+}
+
+func (f *labelFilter) match(labels map[string]string) bool {
+	if f.probe && labels[docker.CreatedByProbe] != "true" {
+		return false
+	}
+	for k, v := range f.labels {
+		actual, ok := labels[k]
+		if !ok || (v != "" && actual != v) {
+			return false
+		}
+	}
+	return true
+}
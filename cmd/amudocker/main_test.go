@@ -0,0 +1,238 @@
+// Package main
+// Date: 2024/08/14 14:20:51
+// Author: Amu
+// Description:
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/amuluze/docker"
+	goyaml "gopkg.in/yaml.v3"
+)
+
+// fakeManager 只实现测试用到的方法, 其余方法调用时会 panic
+type fakeManager struct {
+	docker.IManager
+	containers []docker.ContainerSummary
+	images     []docker.ImageSummary
+	networks   []docker.NetworkSummary
+	created    *docker.ContainerSpec
+	deleted    []string
+}
+
+func (f *fakeManager) ListContainer(context.Context) ([]docker.ContainerSummary, error) {
+	return f.containers, nil
+}
+
+func (f *fakeManager) ListImage(context.Context) ([]docker.ImageSummary, error) {
+	return f.images, nil
+}
+
+func (f *fakeManager) ListNetwork(context.Context) ([]docker.NetworkSummary, error) {
+	return f.networks, nil
+}
+
+func (f *fakeManager) CreateContainerWithSpec(_ context.Context, spec docker.ContainerSpec) (string, error) {
+	f.created = &spec
+	return "c0ffee", nil
+}
+
+func (f *fakeManager) ResolveContainer(_ context.Context, ref string) (string, error) {
+	for _, c := range f.containers {
+		if c.ID == ref || c.Name == ref {
+			return c.ID, nil
+		}
+	}
+	return "", fmt.Errorf("container %s: %w", ref, docker.ErrNotFound)
+}
+
+func (f *fakeManager) DeleteContainer(_ context.Context, id string) error {
+	f.deleted = append(f.deleted, id)
+	return nil
+}
+
+func newFakeManager() *fakeManager {
+	return &fakeManager{
+		containers: []docker.ContainerSummary{
+			{ID: "1111111111111111", Name: "redis", Image: "redis:7.0.5", State: "running",
+				Labels: map[string]string{docker.CreatedByProbe: "true", docker.ServerTypeLabel: docker.DatabaseServer}},
+			{ID: "2222222222222222", Name: "nginx", Image: "nginx:latest", State: "exited",
+				Labels: map[string]string{docker.ServerTypeLabel: docker.WebServer}},
+		},
+		images: []docker.ImageSummary{
+			{ID: "sha256:abcdef0123456789", Name: "redis", Tag: "7.0.5", Size: "117.05MB"},
+			{ID: "sha256:9876543210fedcba", Name: "nginx", Tag: "latest", Size: "187.69MB"},
+		},
+		networks: []docker.NetworkSummary{
+			{ID: "3333333333333333", Name: "probe", Driver: "bridge", Scope: "local",
+				SubNet:     []docker.SubNetworkConfig{{Subnet: "172.20.0.0/16", Gateway: "172.20.0.1"}},
+				Containers: map[string]string{"1111111111111111": "172.20.0.2"},
+				Labels:     map[string]string{docker.CreatedByProbe: "true"}},
+			{ID: "4444444444444444", Name: "bridge", Driver: "bridge", Scope: "local"},
+		},
+	}
+}
+
+func runApp(t *testing.T, manager docker.IManager, args ...string) (int, string, string) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	a := &app{manager: manager, stdout: &stdout, stderr: &stderr}
+	code := a.run(context.Background(), args)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestPsLabelFilter(t *testing.T) {
+	code, stdout, stderr := runApp(t, newFakeManager(), "ps", "--probe", "-o", "json")
+	if code != 0 {
+		t.Fatalf("exit code = %d, stderr: %s", code, stderr)
+	}
+	var containers []docker.ContainerSummary
+	if err := json.Unmarshal([]byte(stdout), &containers); err != nil {
+		t.Fatal(err)
+	}
+	if len(containers) != 1 || containers[0].Name != "redis" {
+		t.Errorf("containers = %+v", containers)
+	}
+
+	code, stdout, _ = runApp(t, newFakeManager(), "ps", "--label", docker.ServerTypeLabel+"="+docker.WebServer)
+	if code != 0 {
+		t.Fatalf("exit code = %d", code)
+	}
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "CONTAINER ID") || !strings.HasPrefix(lines[1], "222222222222 ") {
+		t.Errorf("table:\n%s", stdout)
+	}
+	if strings.Contains(lines[1], "2222222222222222") {
+		t.Errorf("table should show short IDs:\n%s", stdout)
+	}
+}
+
+func TestImagesYAML(t *testing.T) {
+	code, stdout, stderr := runApp(t, newFakeManager(), "images", "redis", "--output", "yaml")
+	if code != 0 {
+		t.Fatalf("exit code = %d, stderr: %s", code, stderr)
+	}
+	var images []docker.ImageSummary
+	if err := goyaml.Unmarshal([]byte(stdout), &images); err != nil {
+		t.Fatal(err)
+	}
+	if len(images) != 1 || images[0].Tag != "7.0.5" {
+		t.Errorf("images = %+v", images)
+	}
+}
+
+func TestNetworksTable(t *testing.T) {
+	code, stdout, _ := runApp(t, newFakeManager(), "networks", "--probe")
+	if code != 0 {
+		t.Fatalf("exit code = %d", code)
+	}
+	want := []string{"333333333333", "probe", "172.20.0.0/16", "172.20.0.1", "1"}
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("table:\n%s", stdout)
+	}
+	for _, field := range want {
+		if !strings.Contains(lines[1], field) {
+			t.Errorf("row %q does not contain %q", lines[1], field)
+		}
+	}
+}
+
+func TestCreate(t *testing.T) {
+	manager := newFakeManager()
+	code, stdout, stderr := runApp(t, manager, "create", "--name", "web", "-p", "8080:80", "--network", "probe",
+		"-e", "A=1", "--memory", "512m", "--probe", "--restart", "on-failure:3", "nginx:latest", "nginx", "-g", "daemon off;")
+	if code != 0 {
+		t.Fatalf("exit code = %d, stderr: %s", code, stderr)
+	}
+	if stdout != "c0ffee\n" {
+		t.Errorf("stdout = %q", stdout)
+	}
+	want := docker.ContainerSpec{
+		Name:          "web",
+		Image:         "nginx:latest",
+		Networks:      []docker.NetworkAttachment{{Network: "probe"}},
+		Ports:         []string{"8080:80"},
+		Env:           []string{"A=1"},
+		Cmd:           []string{"nginx", "-g", "daemon off;"},
+		Labels:        map[string]string{docker.CreatedByProbe: "true"},
+		RestartPolicy: "on-failure:3",
+		Memory:        512 * 1024 * 1024,
+	}
+	if !reflect.DeepEqual(manager.created, &want) {
+		t.Errorf("spec = %+v, want %+v", manager.created, want)
+	}
+}
+
+func TestCreateCommandFlags(t *testing.T) {
+	// IMAGE 之后的选项属于容器的命令
+	for _, args := range [][]string{
+		{"create", "--name", "x", "alpine", "sh", "-c", "echo hi"},
+		{"create", "--name", "x", "--", "alpine", "sh", "-c", "echo hi"},
+	} {
+		manager := newFakeManager()
+		if code, _, stderr := runApp(t, manager, args...); code != 0 {
+			t.Fatalf("%v: exit code = %d, stderr: %s", args, code, stderr)
+		}
+		if manager.created.Image != "alpine" || !reflect.DeepEqual(manager.created.Cmd, []string{"sh", "-c", "echo hi"}) {
+			t.Errorf("%v: spec = %+v", args, manager.created)
+		}
+	}
+	manager := newFakeManager()
+	if code, _, _ := runApp(t, manager, "create", "--name", "x", "alpine", "ls", "-p"); code != 0 || len(manager.created.Ports) != 0 {
+		t.Errorf("exit code = %d, spec = %+v", code, manager.created)
+	}
+}
+
+func TestRmLabelFilter(t *testing.T) {
+	manager := newFakeManager()
+	code, stdout, stderr := runApp(t, manager, "rm", "--probe", "redis", "nginx")
+	if code != 1 {
+		t.Errorf("exit code = %d, want 1", code)
+	}
+	if !reflect.DeepEqual(manager.deleted, []string{"1111111111111111"}) {
+		t.Errorf("deleted = %v", manager.deleted)
+	}
+	if stdout != "redis\n" || !strings.Contains(stderr, "nginx: container does not match the label filter") {
+		t.Errorf("stdout = %q, stderr = %q", stdout, stderr)
+	}
+}
+
+func TestUsageErrors(t *testing.T) {
+	tests := [][]string{
+		nil,
+		{"unknown"},
+		{"ps", "-o", "xml"},
+		{"create", "nginx"},
+		{"tag", "redis"},
+		{"start"},
+	}
+	for _, args := range tests {
+		if code, _, _ := runApp(t, newFakeManager(), args...); code != 2 {
+			t.Errorf("%v: exit code = %d, want 2", args, code)
+		}
+	}
+	if code, _, stderr := runApp(t, newFakeManager(), "ps", "-h"); code != 0 || !strings.Contains(stderr, "Usage: amudocker ps") {
+		t.Errorf("ps -h: exit code = %d, stderr = %q", code, stderr)
+	}
+}
+
+func TestParse(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	follow := fs.Bool("f", false, "")
+	rest, err := parse(fs, []string{"redis", "-f", "extra", "--", "-x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !*follow || !reflect.DeepEqual(rest, []string{"redis", "extra", "-x"}) {
+		t.Errorf("follow = %v, rest = %v", *follow, rest)
+	}
+}
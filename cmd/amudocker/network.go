@@ -0,0 +1,66 @@
+// Package main
+// Date: 2024/08/14 11:26:18
+// Author: Amu
+// Description:
+package main
+
+import (
+	"context"
+
+	"github.com/amuluze/docker"
+)
+
+func (a *app) networks(ctx context.Context, args []string) error {
+	fs := a.flagSet("networks")
+	filter := labelFilterFlags(fs)
+	format := formatFlags(fs)
+	rest, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 {
+		return usagef("unexpected argument %q", rest[0])
+	}
+
+	networks, err := a.manager.ListNetwork(ctx)
+	if err != nil {
+		return err
+	}
+	result := make([]docker.NetworkSummary, 0, len(networks))
+	for _, n := range networks {
+		if filter.match(n.Labels) {
+			result = append(result, n)
+		}
+	}
+	return write(a.stdout, *format, result, networkTable(result))
+}
+
+func (a *app) join(ctx context.Context, args []string) error {
+	fs := a.flagSet("join")
+	var opts docker.EndpointOptions
+	var aliases, links stringsFlag
+	fs.Var(&aliases, "alias", "network-scoped `alias` (repeatable)")
+	fs.Var(&links, "link", "link to another container, `container:alias` (repeatable)")
+	fs.StringVar(&opts.IPv4Address, "ip", "", "IPv4 `address`")
+	fs.StringVar(&opts.IPv6Address, "ip6", "", "IPv6 `address`")
+	rest, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 2 {
+		return usagef("container and network are required")
+	}
+	opts.Aliases, opts.Links = aliases, links
+	return a.manager.JoinNetworkWithOptions(ctx, rest[0], rest[1], opts)
+}
+
+func (a *app) leave(ctx context.Context, args []string) error {
+	rest, err := parse(a.flagSet("leave"), args)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 2 {
+		return usagef("container and network are required")
+	}
+	return a.manager.LeaveNetwork(ctx, rest[0], rest[1])
+}
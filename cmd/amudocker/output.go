@@ -0,0 +1,161 @@
+// Package main
+// Date: 2024/08/14 10:12:40
+// Author: Amu
+// Description:
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/amuluze/docker"
+	"github.com/docker/go-units"
+	goyaml "gopkg.in/yaml.v3"
+)
+
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+	formatYAML  = "yaml"
+)
+
+// formatFlag 输出格式, 只接受 table json yaml
+type formatFlag string
+
+func (f *formatFlag) String() string {
+	return string(*f)
+}
+
+func (f *formatFlag) Set(value string) error {
+	switch value {
+	case formatTable, formatJSON, formatYAML:
+		*f = formatFlag(value)
+		return nil
+	}
+	return fmt.Errorf("unknown format %q, must be one of table, json, yaml", value)
+}
+
+func formatFlags(fs *flag.FlagSet) *formatFlag {
+	f := formatFlag(formatTable)
+	fs.Var(&f, "o", "output `format`: table, json or yaml")
+	fs.Var(&f, "output", "output `format`: table, json or yaml")
+	return &f
+}
+
+// table 表格形式的输出
+type table struct {
+	header []string
+	rows   [][]string
+}
+
+// write 按格式输出 v; 格式为 table 时输出 t
+func write(w io.Writer, format formatFlag, v any, t table) error {
+	switch format {
+	case formatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(v)
+	case formatYAML:
+		encoder := goyaml.NewEncoder(w)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(v); err != nil {
+			return err
+		}
+		return encoder.Close()
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 3, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(t.header, "\t"))
+	for _, row := range t.rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+// writeJSONLine 输出一行 JSON, 用于流式输出
+func writeJSONLine(w io.Writer, v any) error {
+	return json.NewEncoder(w).Encode(v)
+}
+
+// shortID 与 docker CLI 一致, 表格中只显示 ID 的前 12 位
+func shortID(id string) string {
+	id = strings.TrimPrefix(id, "sha256:")
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
+
+func containerTable(containers []docker.ContainerSummary) table {
+	t := table{header: []string{"CONTAINER ID", "NAME", "IMAGE", "STATE", "NETWORK", "IP", "PORTS", "CREATED"}}
+	for _, c := range containers {
+		t.rows = append(t.rows, []string{
+			shortID(c.ID), c.Name, c.Image, c.State, c.Network, c.IP, strings.Join(c.Ports, ","), c.Created,
+		})
+	}
+	return t
+}
+
+func imageTable(images []docker.ImageSummary) table {
+	t := table{header: []string{"REPOSITORY", "TAG", "IMAGE ID", "CREATED", "SIZE"}}
+	for _, im := range images {
+		t.rows = append(t.rows, []string{im.Name, im.Tag, shortID(im.ID), im.Created, im.Size})
+	}
+	return t
+}
+
+func networkTable(networks []docker.NetworkSummary) table {
+	t := table{header: []string{"NETWORK ID", "NAME", "DRIVER", "SCOPE", "SUBNET", "GATEWAY", "CONTAINERS"}}
+	for _, n := range networks {
+		var subnets, gateways []string
+		for _, sub := range n.SubNet {
+			subnets = append(subnets, sub.Subnet)
+			if sub.Gateway != "" {
+				gateways = append(gateways, sub.Gateway)
+			}
+		}
+		t.rows = append(t.rows, []string{
+			shortID(n.ID), n.Name, n.Driver, n.Scope,
+			strings.Join(subnets, ","), strings.Join(gateways, ","), strconv.Itoa(len(n.Containers)),
+		})
+	}
+	return t
+}
+
+var statsHeader = []string{"CONTAINER ID", "NAME", "CPU %", "MEM USAGE / LIMIT", "MEM %", "NET I/O", "BLOCK I/O", "PIDS"}
+
+func statsRow(s docker.ContainerStats) []string {
+	return []string{
+		shortID(s.ID),
+		s.Name,
+		fmt.Sprintf("%.2f%%", s.CPUPercent),
+		units.BytesSize(float64(s.MemoryUsage)) + " / " + units.BytesSize(float64(s.MemoryLimit)),
+		fmt.Sprintf("%.2f%%", s.MemoryPercent),
+		units.HumanSizeWithPrecision(float64(s.NetworkRxBytes), 3) + " / " + units.HumanSizeWithPrecision(float64(s.NetworkTxBytes), 3),
+		units.HumanSizeWithPrecision(float64(s.BlockReadBytes), 3) + " / " + units.HumanSizeWithPrecision(float64(s.BlockWriteBytes), 3),
+		strconv.FormatUint(s.PIDs, 10),
+	}
+}
+
+func statsTable(stats []docker.ContainerStats) table {
+	t := table{header: statsHeader}
+	for _, s := range stats {
+		t.rows = append(t.rows, statsRow(s))
+	}
+	return t
+}
+
+// sortedKeys 返回 map 的有序键, 用于输出稳定的结果
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,311 @@
+// Package docker
+// Date: 2024/08/08 10:36:21
+// Author: Amu
+// Description:
+package docker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/network"
+	goyaml "gopkg.in/yaml.v3"
+)
+
+const composeVersion = "3.8"
+
+// composeLabelPrefix compose 自身写入的标签, 生成时忽略
+const composeLabelPrefix = "com.docker.compose."
+
+type composeFile struct {
+	Version  string                    `yaml:"version"`
+	Services map[string]composeService `yaml:"services"`
+	Networks map[string]composeNetwork `yaml:"networks,omitempty"`
+	Volumes  map[string]composeVolume  `yaml:"volumes,omitempty"`
+}
+
+type composeService struct {
+	Image         string                           `yaml:"image"`
+	ContainerName string                           `yaml:"container_name"`
+	Hostname      string                           `yaml:"hostname,omitempty"`
+	Entrypoint    []string                         `yaml:"entrypoint,omitempty"`
+	Command       []string                         `yaml:"command,omitempty"`
+	WorkingDir    string                           `yaml:"working_dir,omitempty"`
+	User          string                           `yaml:"user,omitempty"`
+	Tty           bool                             `yaml:"tty,omitempty"`
+	StdinOpen     bool                             `yaml:"stdin_open,omitempty"`
+	Restart       string                           `yaml:"restart,omitempty"`
+	Environment   []string                         `yaml:"environment,omitempty"`
+	Labels        map[string]string                `yaml:"labels,omitempty"`
+	Ports         []string                         `yaml:"ports,omitempty"`
+	Volumes       []string                         `yaml:"volumes,omitempty"`
+	NetworkMode   string                           `yaml:"network_mode,omitempty"`
+	Networks      map[string]composeServiceNetwork `yaml:"networks,omitempty"`
+	Healthcheck   *composeHealthcheck              `yaml:"healthcheck,omitempty"`
+	Deploy        *composeDeploy                   `yaml:"deploy,omitempty"`
+}
+
+type composeServiceNetwork struct {
+	Aliases     []string `yaml:"aliases,omitempty"`
+	IPv4Address string   `yaml:"ipv4_address,omitempty"`
+	IPv6Address string   `yaml:"ipv6_address,omitempty"`
+}
+
+type composeHealthcheck struct {
+	Test        []string `yaml:"test,omitempty"`
+	Interval    string   `yaml:"interval,omitempty"`
+	Timeout     string   `yaml:"timeout,omitempty"`
+	StartPeriod string   `yaml:"start_period,omitempty"`
+	Retries     int      `yaml:"retries,omitempty"`
+	Disable     bool     `yaml:"disable,omitempty"`
+}
+
+type composeDeploy struct {
+	Resources composeResources `yaml:"resources"`
+}
+
+type composeResources struct {
+	Limits composeLimits `yaml:"limits"`
+}
+
+type composeLimits struct {
+	CPUs   string `yaml:"cpus,omitempty"`
+	Memory string `yaml:"memory,omitempty"`
+}
+
+// composeNetwork 容器接入的网络均已存在, 标记为 external, compose 不会再创建或删除它们。
+// external 网络不能再声明 driver、ipam 等配置
+type composeNetwork struct {
+	Name     string `yaml:"name"`
+	External bool   `yaml:"external"`
+}
+
+type composeVolume struct {
+	Name string `yaml:"name"`
+}
+
+// composeSource 生成 compose 文件所需的容器信息
+type composeSource struct {
+	inspect     types.ContainerJSON
+	imageConfig *container.Config
+}
+
+// GenerateCompose 读取容器的配置, 生成 compose v3 格式的 YAML, containerIDs 为空时包含全部容器。
+// 已有的网络标记为 external, 卷(含匿名卷)通过 name 保留原有名称, 与镜像默认值相同的配置不会写入
+func (m *Manager) GenerateCompose(ctx context.Context, containerIDs []string) ([]byte, error) {
+	if len(containerIDs) == 0 {
+		containers, err := m.client.ContainerList(ctx, container.ListOptions{All: true})
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range containers {
+			containerIDs = append(containerIDs, c.ID)
+		}
+	}
+
+	var sources []composeSource
+	for _, id := range containerIDs {
+		containerID, err := m.ResolveContainer(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		inspect, imageConfig, err := m.inspectForRecreate(ctx, containerID)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, composeSource{inspect: inspect, imageConfig: imageConfig})
+	}
+
+	file, err := buildCompose(sources)
+	if err != nil {
+		return nil, err
+	}
+	buf := new(bytes.Buffer)
+	encoder := goyaml.NewEncoder(buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(file); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func isPredefinedNetwork(name string) bool {
+	return name == network.NetworkBridge || name == network.NetworkHost || name == network.NetworkNone
+}
+
+func buildCompose(sources []composeSource) (*composeFile, error) {
+	file := &composeFile{
+		Version:  composeVersion,
+		Services: make(map[string]composeService),
+		Networks: make(map[string]composeNetwork),
+		Volumes:  make(map[string]composeVolume),
+	}
+	for _, source := range sources {
+		name := strings.TrimPrefix(source.inspect.Name, "/")
+		serviceName := composeServiceName(name)
+		if _, ok := file.Services[serviceName]; ok {
+			return nil, fmt.Errorf("duplicate compose service name %s for container %s", serviceName, name)
+		}
+
+		// compose 在创建容器时接入全部网络, 按 API 1.44 转换即可
+		cfg := createConfigFromInspect(source.inspect, source.imageConfig, "1.44")
+		service := composeService{
+			Image:         cfg.Config.Image,
+			ContainerName: name,
+			Hostname:      cfg.Config.Hostname,
+			Entrypoint:    cfg.Config.Entrypoint,
+			Command:       cfg.Config.Cmd,
+			WorkingDir:    cfg.Config.WorkingDir,
+			User:          cfg.Config.User,
+			Tty:           cfg.Config.Tty,
+			StdinOpen:     cfg.Config.OpenStdin,
+			Environment:   cfg.Config.Env,
+			Ports:         portSpecs(cfg.HostConfig.PortBindings),
+			Healthcheck:   composeHealthcheckFrom(cfg.Config.Healthcheck, source.imageConfig),
+		}
+		if policy := formatRestartPolicy(cfg.HostConfig.RestartPolicy); policy != "" && policy != string(container.RestartPolicyDisabled) {
+			service.Restart = policy
+		}
+		for k, v := range cfg.Config.Labels {
+			if strings.HasPrefix(k, composeLabelPrefix) {
+				continue
+			}
+			if service.Labels == nil {
+				service.Labels = make(map[string]string)
+			}
+			service.Labels[k] = v
+		}
+		if cfg.HostConfig.Memory > 0 || cfg.HostConfig.NanoCPUs > 0 {
+			service.Deploy = &composeDeploy{}
+			if cfg.HostConfig.NanoCPUs > 0 {
+				service.Deploy.Resources.Limits.CPUs = strconv.FormatFloat(float64(cfg.HostConfig.NanoCPUs)/1e9, 'f', -1, 64)
+			}
+			if cfg.HostConfig.Memory > 0 {
+				service.Deploy.Resources.Limits.Memory = strconv.FormatInt(cfg.HostConfig.Memory, 10)
+			}
+		}
+
+		service.Volumes = composeVolumes(cfg.HostConfig.Binds, source.inspect.Mounts)
+		for _, volume := range service.Volumes {
+			// 来源不是绝对路径时为命名卷
+			if name, _, _ := strings.Cut(volume, ":"); !filepath.IsAbs(name) {
+				file.Volumes[name] = composeVolume{Name: name}
+			}
+		}
+
+		mode := cfg.HostConfig.NetworkMode
+		switch {
+		case mode.IsDefault():
+			service.NetworkMode = network.NetworkBridge
+		case mode.IsBridge() || mode.IsHost() || mode.IsNone() || mode.IsContainer():
+			service.NetworkMode = string(mode)
+		default:
+			service.Networks = make(map[string]composeServiceNetwork)
+			for networkName, settings := range cfg.NetworkingConfig.EndpointsConfig {
+				if isPredefinedNetwork(networkName) {
+					continue
+				}
+				attachment := composeServiceNetwork{Aliases: withoutValue(settings.Aliases, name)}
+				if settings.IPAMConfig != nil {
+					attachment.IPv4Address = settings.IPAMConfig.IPv4Address
+					attachment.IPv6Address = settings.IPAMConfig.IPv6Address
+				}
+				service.Networks[networkName] = attachment
+				file.Networks[networkName] = composeNetwork{Name: networkName, External: true}
+			}
+		}
+		file.Services[serviceName] = service
+	}
+	return file, nil
+}
+
+// composeServiceName 将容器名称转换为合法的 compose 服务名
+func composeServiceName(name string) string {
+	b := new(strings.Builder)
+	for i, r := range strings.ToLower(name) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case i > 0 && (r == '_' || r == '.' || r == '-'):
+			b.WriteRune(r)
+		default:
+			b.WriteRune('_')
+		}
+	}
+	return b.String()
+}
+
+// composeHealthcheckFrom 转换容器的健康检查, 与镜像中定义的相同时不写入
+func composeHealthcheckFrom(health *container.HealthConfig, imageConfig *container.Config) *composeHealthcheck {
+	if health == nil {
+		return nil
+	}
+	if imageConfig != nil && reflect.DeepEqual(health, imageConfig.Healthcheck) {
+		return nil
+	}
+	if len(health.Test) > 0 && health.Test[0] == "NONE" {
+		return &composeHealthcheck{Disable: true}
+	}
+	formatDuration := func(d time.Duration) string {
+		if d == 0 {
+			return ""
+		}
+		return d.String()
+	}
+	return &composeHealthcheck{
+		Test:        health.Test,
+		Interval:    formatDuration(health.Interval),
+		Timeout:     formatDuration(health.Timeout),
+		StartPeriod: formatDuration(health.StartPeriod),
+		Retries:     health.Retries,
+	}
+}
+
+// composeVolumes 生成服务的 volumes。Binds 原样保留, 其余挂载(HostConfig.Mounts、镜像 VOLUME 和 -v /data
+// 产生的匿名卷)按 inspect 的 Mounts 以短格式写入, 匿名卷使用卷名, 重新部署时沿用原有数据; tmpfs 等其它类型忽略
+func composeVolumes(binds []string, mounts []types.MountPoint) []string {
+	var volumes []string
+	covered := make(map[string]bool)
+	for _, bind := range binds {
+		if parts := strings.Split(bind, ":"); len(parts) >= 2 {
+			covered[path.Clean(parts[1])] = true
+		}
+	}
+	for _, mp := range mounts {
+		if covered[path.Clean(mp.Destination)] {
+			continue
+		}
+		var source string
+		switch {
+		case mp.Type == mount.TypeVolume && mp.Name != "":
+			source = mp.Name
+		case mp.Type == mount.TypeBind:
+			source = mp.Source
+		default:
+			continue
+		}
+		volume := source + ":" + mp.Destination
+		if !mp.RW {
+			volume += ":ro"
+		}
+		volumes = append(volumes, volume)
+	}
+	// inspect 返回的 Mounts 没有固定顺序
+	sort.Strings(volumes)
+	return append(slices.Clone(binds), volumes...)
+}
@@ -0,0 +1,141 @@
+// Package docker
+// Date: 2024/08/08 10:40:05
+// Author: Amu
+// Description:
+package docker
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/go-connections/nat"
+	goyaml "gopkg.in/yaml.v3"
+)
+
+func TestGenerateCompose(t *testing.T) {
+	manager, _ := NewManager()
+	data, err := manager.GenerateCompose(context.Background(), []string{"redis"})
+	if err != nil {
+		t.Fatalf("generate compose error: %v", err)
+	}
+	t.Log(string(data))
+}
+
+func TestBuildCompose(t *testing.T) {
+	health := &container.HealthConfig{Test: []string{"CMD", "redis-cli", "ping"}, Interval: 30 * time.Second, Retries: 3}
+	sources := []composeSource{
+		{
+			inspect: types.ContainerJSON{
+				ContainerJSONBase: &types.ContainerJSONBase{
+					ID:   "5c28bf6e16be0123456789",
+					Name: "/Redis",
+					HostConfig: &container.HostConfig{
+						NetworkMode:   "test",
+						Binds:         []string{"/data:/data:rw", "redis-data:/var/lib/redis:rw"},
+						RestartPolicy: container.RestartPolicy{Name: container.RestartPolicyAlways},
+						PortBindings:  nat.PortMap{"6379/tcp": {{HostIP: "0.0.0.0", HostPort: "6379"}}},
+						Resources:     container.Resources{Memory: 256 << 20},
+					},
+				},
+				Config: &container.Config{
+					Hostname:    "redis",
+					Image:       "redis:7.0.5",
+					Tty:         true,
+					Env:         []string{"PATH=/usr/bin", "MODE=cluster"},
+					Cmd:         []string{"redis-server"},
+					Healthcheck: health,
+					Labels:      map[string]string{ServerTypeLabel: DatabaseServer, "com.docker.compose.project": "old"},
+				},
+				Mounts: []types.MountPoint{
+					{Type: mount.TypeBind, Source: "/data", Destination: "/data", RW: true},
+					{Type: mount.TypeVolume, Name: "redis-data", Destination: "/var/lib/redis", RW: true},
+					{Type: mount.TypeVolume, Name: "f1e2d3c4b5a6", Destination: "/cache", RW: true},
+					{Type: mount.TypeBind, Source: "/srv/redis.conf", Destination: "/etc/redis.conf"},
+					{Type: mount.TypeTmpfs, Destination: "/tmp", RW: true},
+				},
+				NetworkSettings: &types.NetworkSettings{Networks: map[string]*network.EndpointSettings{
+					"test": {Aliases: []string{"cache", "5c28bf6e16be"}, IPAMConfig: &network.EndpointIPAMConfig{IPv4Address: "172.20.0.10"}},
+				}},
+			},
+			imageConfig: &container.Config{Env: []string{"PATH=/usr/bin"}, Cmd: []string{"redis-server"}},
+		},
+		{
+			inspect: types.ContainerJSON{
+				ContainerJSONBase: &types.ContainerJSONBase{
+					Name:       "/web",
+					HostConfig: &container.HostConfig{NetworkMode: "host", RestartPolicy: container.RestartPolicy{Name: container.RestartPolicyDisabled}},
+				},
+				Config: &container.Config{Image: "nginx", Healthcheck: health},
+			},
+			imageConfig: &container.Config{Healthcheck: health},
+		},
+	}
+
+	file, err := buildCompose(sources)
+	if err != nil {
+		t.Fatalf("build compose error: %v", err)
+	}
+	redis, ok := file.Services["redis"]
+	if !ok {
+		t.Fatalf("service redis not found: %v", file.Services)
+	}
+	if !reflect.DeepEqual(redis.Environment, []string{"MODE=cluster"}) || redis.Command != nil {
+		t.Errorf("image defaults should be stripped: %v %v", redis.Environment, redis.Command)
+	}
+	if _, ok := redis.Labels["com.docker.compose.project"]; ok || redis.Labels[ServerTypeLabel] != DatabaseServer {
+		t.Errorf("unexpected labels: %v", redis.Labels)
+	}
+	if redis.Restart != "always" || redis.Hostname != "redis" || !reflect.DeepEqual(redis.Ports, []string{"6379:6379/tcp"}) {
+		t.Errorf("unexpected service: %#v", redis)
+	}
+	if redis.Networks["test"].IPv4Address != "172.20.0.10" || !reflect.DeepEqual(redis.Networks["test"].Aliases, []string{"cache"}) {
+		t.Errorf("unexpected network attachment: %#v", redis.Networks)
+	}
+	if redis.Healthcheck == nil || redis.Healthcheck.Interval != "30s" || redis.Healthcheck.Retries != 3 {
+		t.Errorf("unexpected healthcheck: %#v", redis.Healthcheck)
+	}
+	if redis.Deploy == nil || redis.Deploy.Resources.Limits.Memory != "268435456" {
+		t.Errorf("unexpected deploy: %#v", redis.Deploy)
+	}
+	wantVolumes := []string{"/data:/data:rw", "redis-data:/var/lib/redis:rw", "/srv/redis.conf:/etc/redis.conf:ro", "f1e2d3c4b5a6:/cache"}
+	if !reflect.DeepEqual(redis.Volumes, wantVolumes) {
+		t.Errorf("unexpected service volumes: %v", redis.Volumes)
+	}
+	if _, ok := file.Volumes["f1e2d3c4b5a6"]; !ok || len(file.Volumes) != 2 {
+		t.Errorf("unexpected volumes: %v", file.Volumes)
+	}
+	if nt := file.Networks["test"]; nt.Name != "test" || !nt.External {
+		t.Errorf("unexpected network: %#v", nt)
+	}
+
+	web := file.Services["web"]
+	if web.NetworkMode != "host" || web.Restart != "" || web.Healthcheck != nil {
+		t.Errorf("unexpected service: %#v", web)
+	}
+
+	data, err := goyaml.Marshal(file)
+	if err != nil {
+		t.Fatalf("marshal compose error: %v", err)
+	}
+	var decoded composeFile
+	if err := goyaml.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("unmarshal compose error: %v", err)
+	}
+	if !reflect.DeepEqual(&decoded, file) {
+		t.Errorf("compose file does not round trip:\n%s", data)
+	}
+}
+
+func TestComposeServiceName(t *testing.T) {
+	for name, want := range map[string]string{"Redis": "redis", "web_1": "web_1", "_tmp": "_tmp", "a b": "a_b", "app.v2": "app.v2"} {
+		if got := composeServiceName(name); got != want {
+			t.Errorf("composeServiceName(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
@@ -6,7 +6,10 @@ package docker
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"sort"
 	"strconv"
 
 	"github.com/docker/docker/api/types/network"
@@ -16,7 +19,11 @@ import (
 	"strings"
 	"time"
 
+	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/versions"
+	"github.com/docker/docker/errdefs"
+	"github.com/docker/docker/pkg/stdcopy"
 	"github.com/docker/go-connections/nat"
 	"github.com/docker/libcompose/yaml"
 	"github.com/tidwall/gjson"
@@ -38,6 +45,65 @@ type ContainerSummary struct {
 	Labels       map[string]string `json:"labels"`
 }
 
+// CommitOptions 将容器提交为镜像时的参数
+type CommitOptions struct {
+	Repository string            // 镜像仓库名, 如 redis
+	Tag        string            // 镜像标签, 为空时为 latest
+	Author     string            // 作者
+	Message    string            // 提交说明
+	Cmd        []string          // 覆盖镜像的 CMD
+	Env        []string          // 追加的环境变量, 形如 KEY=value
+	Labels     map[string]string // 追加的标签
+	Changes    []string          // 其它 Dockerfile 指令, 如 EXPOSE 80
+	Pause      bool              // 提交期间暂停容器
+}
+
+type ChangeKind string
+
+const (
+	ChangeModified ChangeKind = "modified"
+	ChangeAdded    ChangeKind = "added"
+	ChangeDeleted  ChangeKind = "deleted"
+)
+
+// ContainerChange 容器文件系统相对于镜像的一处变更
+type ContainerChange struct {
+	Path string     `json:"path"`
+	Kind ChangeKind `json:"kind"`
+}
+
+// ContainerProcess 容器内的一个进程, Fields 保存 ps 输出的全部列
+type ContainerProcess struct {
+	PID     string            `json:"pid"`
+	PPID    string            `json:"ppid"`
+	User    string            `json:"user"`
+	Command string            `json:"command"`
+	Fields  map[string]string `json:"fields"`
+}
+
+// ContainerSpec 创建容器的参数
+type ContainerSpec struct {
+	Name     string              `json:"name"`
+	Image    string              `json:"image"`
+	Networks []NetworkAttachment `json:"networks"` // 第一个网络作为 NetworkMode, 每个网络只连接一次
+	Ports    []string            `json:"ports"`    // 形如 8080:80/tcp, 宿主机端口为 auto 时自动分配
+	Volumes  []string            `json:"volumes"`  // 形如 /host:/container:ro
+	Env      []string            `json:"env"`
+	Cmd      []string            `json:"cmd"`
+	Labels   map[string]string   `json:"labels"`
+
+	RestartPolicy string  `json:"restart_policy"` // 形如 always、unless-stopped、on-failure:3, 为空时为 always
+	Memory        int64   `json:"memory"`         // 内存限制(字节), 为 0 时不限制
+	CPUs          float64 `json:"cpus"`           // CPU 限制(核数), 为 0 时不限制
+	NoTty         bool    `json:"no_tty"`         // 不分配伪终端, 默认分配
+}
+
+// NetworkAttachment 容器要接入的网络及其端点配置
+type NetworkAttachment struct {
+	Network string `json:"network"` // 网络名称
+	EndpointOptions
+}
+
 type PortMapping struct {
 	Proto         string
 	IP            string
@@ -53,6 +119,10 @@ func (m *Manager) getUptime(ctx context.Context, containerID string) string {
 }
 
 func (m *Manager) ListContainer(ctx context.Context) ([]ContainerSummary, error) {
+	return m.cache.containerList(ctx, m.listContainer)
+}
+
+func (m *Manager) listContainer(ctx context.Context) ([]ContainerSummary, error) {
 	containers, err := m.client.ContainerList(ctx, container.ListOptions{All: true})
 	if err != nil {
 		return nil, err
@@ -120,12 +190,13 @@ func (m *Manager) ListContainer(ctx context.Context) ([]ContainerSummary, error)
 }
 
 func (m *Manager) HasSameNameContainer(ctx context.Context, containerName string) (bool, error) {
-	containers, err := m.client.ContainerList(ctx, container.ListOptions{All: true})
+	containers, err := m.listContainerRefs(ctx)
 	if err != nil {
 		return false, err
 	}
+	containerName = strings.TrimPrefix(containerName, "/")
 	for _, c := range containers {
-		if strings.Trim(c.Names[0], "/") == containerName {
+		if containerHasName(c, containerName) {
 			return true, nil
 		}
 	}
@@ -133,50 +204,91 @@ func (m *Manager) HasSameNameContainer(ctx context.Context, containerName string
 }
 
 func (m *Manager) CreateContainer(ctx context.Context, containerName, imageName, networkName string, ports []string, vols []string, envs []string, commands []string, labels map[string]string) (string, error) {
+	return m.CreateContainerWithSpec(ctx, ContainerSpec{
+		Name:     containerName,
+		Image:    imageName,
+		Networks: []NetworkAttachment{{Network: networkName}},
+		Ports:    ports,
+		Volumes:  vols,
+		Env:      envs,
+		Cmd:      commands,
+		Labels:   labels,
+	})
+}
+
+// CreateContainerWithSpec 创建容器并将其接入 spec.Networks 中的每个网络各一次,
+// 第一个网络作为容器的 NetworkMode
+func (m *Manager) CreateContainerWithSpec(ctx context.Context, spec ContainerSpec) (id string, err error) {
+	defer m.invalidate()
+	defer m.audit(ctx, "CreateContainerWithSpec", auditArgs{"spec": auditSpec(spec)}).done(&id, &err)
 	config := &container.Config{}
-	config.Hostname = containerName
-	config.Image = imageName
-	config.Labels = labels
-	config.Tty = true
-	config.Env = envs
-	if commands != nil {
-		config.Cmd = commands
+	config.Hostname = spec.Name
+	config.Image = spec.Image
+	config.Labels = spec.Labels
+	config.Tty = !spec.NoTty
+	config.Env = spec.Env
+	if spec.Cmd != nil {
+		config.Cmd = spec.Cmd
 	}
 
 	hostConfig := &container.HostConfig{}
-	hostConfig.RestartPolicy = container.RestartPolicy{Name: "always"}
-	hostConfig.PortBindings = make(nat.PortMap)
-
-	nt, err := m.GetNetworkByName(ctx, networkName)
+	restartPolicy, err := parseRestartPolicy(spec.RestartPolicy)
 	if err != nil {
-		return "", err
+		return "", invalidArgument(err)
 	}
-	hostConfig.NetworkMode = container.NetworkMode(networkName)
+	hostConfig.RestartPolicy = restartPolicy
+	hostConfig.Memory = spec.Memory
+	hostConfig.NanoCPUs = int64(spec.CPUs * 1e9)
+	hostConfig.PortBindings = make(nat.PortMap)
+
 	networkConfig := &network.NetworkingConfig{}
 	networkConfig.EndpointsConfig = make(map[string]*network.EndpointSettings)
-	networkConfig.EndpointsConfig[networkName] = &network.EndpointSettings{
-		NetworkID: nt.ID,
+	type pendingEndpoint struct {
+		networkID string
+		settings  *network.EndpointSettings
 	}
-
-	for _, port := range ports {
-		portsMapping, err := nat.ParsePortSpec(port)
+	var deferred []pendingEndpoint
+	for i, attachment := range spec.Networks {
+		nt, err := m.GetNetworkByName(ctx, attachment.Network)
 		if err != nil {
 			return "", err
 		}
-		for _, portMapping := range portsMapping {
-			port, err := nat.NewPort(portMapping.Port.Proto(), portMapping.Port.Port())
-			if err != nil {
-				return "", err
-			}
-			hostIP := portMapping.Binding.HostIP
-			if hostIP == "" {
-				hostIP = "0.0.0.0"
-			}
-			hostConfig.PortBindings[port] = append(hostConfig.PortBindings[port], nat.PortBinding{
-				HostIP:   hostIP,
-				HostPort: portMapping.Binding.HostPort,
-			})
+		if _, ok := networkConfig.EndpointsConfig[nt.Name]; ok {
+			return "", invalidArgument(fmt.Errorf("network %s is attached more than once", nt.Name))
+		}
+		settings, err := endpointSettings(attachment.EndpointOptions)
+		if err != nil {
+			return "", invalidArgument(err)
 		}
+		settings.NetworkID = nt.ID
+		if i == 0 {
+			hostConfig.NetworkMode = container.NetworkMode(nt.Name)
+		} else if versions.LessThan(m.client.ClientVersion(), "1.44") {
+			// API 1.44 之前创建时只能指定一个网络, 其余网络在创建后连接
+			deferred = append(deferred, pendingEndpoint{networkID: nt.ID, settings: settings})
+			continue
+		}
+		networkConfig.EndpointsConfig[nt.Name] = settings
+	}
+
+	if m.portAllocator != nil {
+		// 检查端口与创建容器之间持有锁, 避免并发创建的容器分配到同一个端口
+		m.portAllocator.mu.Lock()
+		defer m.portAllocator.mu.Unlock()
+	}
+	mappings, err := m.PreparePorts(ctx, spec.Ports)
+	if err != nil {
+		return "", err
+	}
+	for _, mapping := range mappings {
+		port, err := nat.NewPort(mapping.Proto, mapping.ContainerPort)
+		if err != nil {
+			return "", err
+		}
+		hostConfig.PortBindings[port] = append(hostConfig.PortBindings[port], nat.PortBinding{
+			HostIP:   mapping.IP,
+			HostPort: mapping.HostPort,
+		})
 	}
 
 	config.ExposedPorts = make(nat.PortSet)
@@ -184,50 +296,115 @@ func (m *Manager) CreateContainer(ctx context.Context, containerName, imageName,
 		config.ExposedPorts[port] = struct{}{}
 	}
 
+	binds, err := parseVolumes(spec.Volumes)
+	if err != nil {
+		return "", err
+	}
+	hostConfig.Binds = binds
+
+	createResponse, err := m.client.ContainerCreate(ctx, config, hostConfig, networkConfig, nil, spec.Name)
+	if err != nil {
+		return "", err
+	}
+	for _, w := range createResponse.Warnings {
+		fmt.Printf("Container Create Warning: %s\n", w)
+	}
+	for _, endpoint := range deferred {
+		if err := m.client.NetworkConnect(ctx, endpoint.networkID, createResponse.ID, endpoint.settings); err != nil {
+			_ = m.client.ContainerRemove(ctx, createResponse.ID, container.RemoveOptions{Force: true})
+			return "", err
+		}
+	}
+
+	return createResponse.ID, nil
+}
+
+// parseRestartPolicy 解析 docker run --restart 格式的重启策略
+func parseRestartPolicy(policy string) (container.RestartPolicy, error) {
+	if policy == "" {
+		return container.RestartPolicy{Name: container.RestartPolicyAlways}, nil
+	}
+	name, count, hasCount := strings.Cut(policy, ":")
+	restartPolicy := container.RestartPolicy{Name: container.RestartPolicyMode(name)}
+	if hasCount {
+		retries, err := strconv.Atoi(count)
+		if err != nil {
+			return container.RestartPolicy{}, fmt.Errorf("invalid restart policy %q: %w", policy, err)
+		}
+		restartPolicy.MaximumRetryCount = retries
+	}
+	if err := container.ValidateRestartPolicy(restartPolicy); err != nil {
+		return container.RestartPolicy{}, err
+	}
+	return restartPolicy, nil
+}
+
+func formatRestartPolicy(policy container.RestartPolicy) string {
+	if policy.MaximumRetryCount > 0 {
+		return fmt.Sprintf("%s:%d", policy.Name, policy.MaximumRetryCount)
+	}
+	return string(policy.Name)
+}
+
+// parseVolumes 将 compose 格式的卷声明转换为 source:destination:mode 形式的 Binds
+func parseVolumes(vols []string) ([]string, error) {
+	var binds []string
 	for _, vol := range vols {
 		vol := "- " + vol
 		volumes := &yaml.Volumes{}
 
 		err := goyaml.Unmarshal([]byte(vol), volumes)
 		if err != nil {
-			return "", err
+			return nil, err
 		}
 		for _, volume := range volumes.Volumes {
 			if volume.AccessMode != "ro" {
 				volume.AccessMode = "rw"
 			}
 			volString := fmt.Sprintf("%s:%s:%s", volume.Source, volume.Destination, volume.AccessMode)
-			hostConfig.Binds = append(hostConfig.Binds, volString)
+			binds = append(binds, volString)
 		}
 	}
+	return binds, nil
+}
 
-	createResponse, err := m.client.ContainerCreate(ctx, config, hostConfig, nil, nil, containerName)
+func (m *Manager) StartContainer(ctx context.Context, containerID string) (err error) {
+	defer m.invalidate()
+	defer m.audit(ctx, "StartContainer", auditArgs{"container": containerID}).done(nil, &err)
+	containerID, err = m.ResolveContainer(ctx, containerID)
 	if err != nil {
-		return "", err
-	}
-	for _, w := range createResponse.Warnings {
-		fmt.Printf("Container Create Warning: %s\n", w)
-	}
-	if err := m.client.NetworkConnect(ctx, nt.ID, createResponse.ID, nil); err != nil {
-		return "", err
+		return err
 	}
-
-	return createResponse.ID, nil
-}
-
-func (m *Manager) StartContainer(ctx context.Context, containerID string) error {
 	return m.client.ContainerStart(ctx, containerID, container.StartOptions{})
 }
 
-func (m *Manager) StopContainer(ctx context.Context, containerID string) error {
+func (m *Manager) StopContainer(ctx context.Context, containerID string) (err error) {
+	defer m.invalidate()
+	defer m.audit(ctx, "StopContainer", auditArgs{"container": containerID}).done(nil, &err)
+	containerID, err = m.ResolveContainer(ctx, containerID)
+	if err != nil {
+		return err
+	}
 	return m.client.ContainerStop(ctx, containerID, container.StopOptions{})
 }
 
-func (m *Manager) RestartContainer(ctx context.Context, containerID string) error {
+func (m *Manager) RestartContainer(ctx context.Context, containerID string) (err error) {
+	defer m.invalidate()
+	defer m.audit(ctx, "RestartContainer", auditArgs{"container": containerID}).done(nil, &err)
+	containerID, err = m.ResolveContainer(ctx, containerID)
+	if err != nil {
+		return err
+	}
 	return m.client.ContainerRestart(ctx, containerID, container.StopOptions{})
 }
 
-func (m *Manager) DeleteContainer(ctx context.Context, containerID string) error {
+func (m *Manager) DeleteContainer(ctx context.Context, containerID string) (err error) {
+	defer m.invalidate()
+	defer m.audit(ctx, "DeleteContainer", auditArgs{"container": containerID}).done(nil, &err)
+	containerID, err = m.ResolveContainer(ctx, containerID)
+	if err != nil {
+		return err
+	}
 	return m.client.ContainerRemove(ctx, containerID, container.RemoveOptions{
 		Force:         true,
 		RemoveLinks:   false,
@@ -235,15 +412,11 @@ func (m *Manager) DeleteContainer(ctx context.Context, containerID string) error
 	})
 }
 
-func (m *Manager) CopyFileToContainer(ctx context.Context, containerID string, srcFile, dstFile string) error {
-	file, err := os.Open(srcFile)
+func (m *Manager) GetContainerMem(ctx context.Context, containerID string) (float64, float64, float64, error) {
+	containerID, err := m.ResolveContainer(ctx, containerID)
 	if err != nil {
-		return err
+		return 0.0, 0.0, 0.0, err
 	}
-	return m.client.CopyToContainer(ctx, containerID, dstFile, file, container.CopyToContainerOptions{})
-}
-
-func (m *Manager) GetContainerMem(ctx context.Context, containerID string) (float64, float64, float64, error) {
 	stats, err := m.client.ContainerStats(ctx, containerID, false)
 	if err != nil {
 		return 0.0, 0.0, 0.0, err
@@ -259,6 +432,10 @@ func (m *Manager) GetContainerMem(ctx context.Context, containerID string) (floa
 }
 
 func (m *Manager) GetContainerCpu(ctx context.Context, containerID string) (float64, error) {
+	containerID, err := m.ResolveContainer(ctx, containerID)
+	if err != nil {
+		return 0.0, err
+	}
 	stats, err := m.client.ContainerStats(ctx, containerID, false)
 	if err != nil {
 		return 0.0, err
@@ -274,20 +451,98 @@ func (m *Manager) GetContainerCpu(ctx context.Context, containerID string) (floa
 	return cpuPercent, nil
 }
 
+// GetContainerIDByContainerName 与 ResolveContainer 相同, 没有匹配的容器时返回 ErrNotFound
 func (m *Manager) GetContainerIDByContainerName(ctx context.Context, containerName string) (string, error) {
-	containers, err := m.client.ContainerList(ctx, container.ListOptions{All: true})
+	return m.ResolveContainer(ctx, containerName)
+}
+
+// containerHasName 判断容器是否使用 name 作为名称, name 不带前导 "/"
+func containerHasName(ct types.Container, name string) bool {
+	for _, n := range ct.Names {
+		if strings.TrimPrefix(n, "/") == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ResolveContainer 将完整 ID、ID 前缀或容器名称(可带前导 "/")解析为完整的容器 ID。
+// 完整的 64 位 ID 只查询该容器, 不列出全部容器
+func (m *Manager) ResolveContainer(ctx context.Context, containerIDOrName string) (string, error) {
+	if strings.TrimPrefix(containerIDOrName, "/") == "" {
+		return "", fmt.Errorf("container %q: %w", containerIDOrName, ErrNotFound)
+	}
+	if isFullContainerID(containerIDOrName) {
+		inspect, err := m.client.ContainerInspect(ctx, containerIDOrName)
+		if errdefs.IsNotFound(err) {
+			return "", fmt.Errorf("container %q: %w", containerIDOrName, ErrNotFound)
+		}
+		if err != nil {
+			return "", err
+		}
+		return inspect.ID, nil
+	}
+	containers, err := m.listContainerRefs(ctx)
 	if err != nil {
 		return "", err
 	}
+	return resolveContainerID(containers, containerIDOrName)
+}
+
+// isFullContainerID 判断 ref 是否为 64 位小写十六进制的完整容器 ID
+func isFullContainerID(ref string) bool {
+	if len(ref) != 64 {
+		return false
+	}
+	for _, c := range ref {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// listContainerRefs 列出全部容器用于按名称或 ID 前缀查找, 启用缓存时使用缓存
+func (m *Manager) listContainerRefs(ctx context.Context) ([]types.Container, error) {
+	return m.cache.containerRefList(ctx, func(ctx context.Context) ([]types.Container, error) {
+		return m.client.ContainerList(ctx, container.ListOptions{All: true})
+	})
+}
+
+// resolveContainerID 的匹配优先级与 docker CLI 一致: 完整 ID > 名称 > ID 前缀
+func resolveContainerID(containers []types.Container, containerIDOrName string) (string, error) {
+	ref := strings.TrimPrefix(containerIDOrName, "/")
 	for _, ct := range containers {
-		if ct.Names[0] == containerName {
+		if ct.ID == ref {
 			return ct.ID, nil
 		}
 	}
-	return "", nil
+	for _, ct := range containers {
+		if containerHasName(ct, ref) {
+			return ct.ID, nil
+		}
+	}
+	var matches []string
+	for _, ct := range containers {
+		if strings.HasPrefix(ct.ID, ref) {
+			matches = append(matches, ct.ID)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("container %q: %w", containerIDOrName, ErrNotFound)
+	case 1:
+		return matches[0], nil
+	default:
+		return "", fmt.Errorf("container id prefix %q matches %d containers: %w", containerIDOrName, len(matches), ErrAmbiguous)
+	}
 }
 
 func (m *Manager) ContainerLogs(ctx context.Context, containerID string) (io.ReadCloser, error) {
+	containerID, err := m.ResolveContainer(ctx, containerID)
+	if err != nil {
+		return nil, err
+	}
 	reader, err := m.client.ContainerLogs(ctx, containerID, container.LogsOptions{
 		ShowStdout: true,
 		ShowStderr: true,
@@ -298,14 +553,242 @@ func (m *Manager) ContainerLogs(ctx context.Context, containerID string) (io.Rea
 	return reader, err
 }
 
-func (m *Manager) RenameContainer(ctx context.Context, containerID, newName string) error {
+// LogsOptions 读取容器日志的参数
+type LogsOptions struct {
+	Follow     bool   // 持续输出新日志
+	Tail       string // 从末尾开始输出的行数, 为空时输出全部
+	Since      string // 起始时间, 时间戳或相对时间如 10m
+	Until      string // 截止时间
+	Timestamps bool   // 每行前加时间戳
+}
+
+// ContainerLogsWithOptions 读取容器日志, 非 TTY 容器的标准输出和标准错误按原有顺序合并为一个流
+func (m *Manager) ContainerLogsWithOptions(ctx context.Context, containerID string, opts LogsOptions) (io.ReadCloser, error) {
+	containerID, err := m.ResolveContainer(ctx, containerID)
+	if err != nil {
+		return nil, err
+	}
+	inspect, err := m.client.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return nil, err
+	}
+	tail := opts.Tail
+	if tail == "" {
+		tail = "all"
+	}
+	reader, err := m.client.ContainerLogs(ctx, containerID, container.LogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Follow:     opts.Follow,
+		Tail:       tail,
+		Since:      opts.Since,
+		Until:      opts.Until,
+		Timestamps: opts.Timestamps,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if inspect.Config != nil && inspect.Config.Tty {
+		return reader, nil
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		_, err := stdcopy.StdCopy(pw, pw, reader)
+		_ = pw.CloseWithError(err)
+	}()
+	return &demuxReader{PipeReader: pr, src: reader}, nil
+}
+
+// demuxReader 关闭时同时关闭底层的日志流, 使拆分协程退出
+type demuxReader struct {
+	*io.PipeReader
+	src io.Closer
+}
+
+func (r *demuxReader) Close() error {
+	_ = r.PipeReader.Close()
+	return r.src.Close()
+}
+
+func (m *Manager) RenameContainer(ctx context.Context, containerID, newName string) (err error) {
+	defer m.invalidate()
+	defer m.audit(ctx, "RenameContainer", auditArgs{"container": containerID, "name": newName}).done(nil, &err)
+	containerID, err = m.ResolveContainer(ctx, containerID)
+	if err != nil {
+		return err
+	}
 	return m.client.ContainerRename(ctx, containerID, newName)
 }
 
 func (m *Manager) ContainerExists(ctx context.Context, containerID string) (bool, error) {
-	_, err := m.client.ContainerInspect(ctx, containerID)
+	_, err := m.ResolveContainer(ctx, containerID)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
 	if err != nil {
 		return false, err
 	}
 	return true, nil
 }
+
+// commitChanges 将 CommitOptions 中的配置变更转换为 Dockerfile 指令
+func commitChanges(opts CommitOptions) ([]string, error) {
+	var changes []string
+	if opts.Cmd != nil {
+		cmd, err := json.Marshal(opts.Cmd)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, "CMD "+string(cmd))
+	}
+	for _, env := range opts.Env {
+		key, value, ok := strings.Cut(env, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid env %q", env)
+		}
+		changes = append(changes, fmt.Sprintf("ENV %s=%s", key, strconv.Quote(value)))
+	}
+	keys := make([]string, 0, len(opts.Labels))
+	for key := range opts.Labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		changes = append(changes, fmt.Sprintf("LABEL %s=%s", strconv.Quote(key), strconv.Quote(opts.Labels[key])))
+	}
+	return append(changes, opts.Changes...), nil
+}
+
+func (m *Manager) CommitContainer(ctx context.Context, containerID string, opts CommitOptions) (id string, err error) {
+	defer m.invalidate()
+	defer m.audit(ctx, "CommitContainer", auditArgs{"container": containerID, "options": auditCommitOptions(opts)}).done(&id, &err)
+	containerID, err = m.ResolveContainer(ctx, containerID)
+	if err != nil {
+		return "", err
+	}
+	changes, err := commitChanges(opts)
+	if err != nil {
+		return "", err
+	}
+	var reference string
+	if opts.Repository != "" {
+		reference = opts.Repository
+		if opts.Tag != "" {
+			reference += ":" + opts.Tag
+		}
+	}
+	resp, err := m.client.ContainerCommit(ctx, containerID, container.CommitOptions{
+		Reference: reference,
+		Comment:   opts.Message,
+		Author:    opts.Author,
+		Changes:   changes,
+		Pause:     opts.Pause,
+	})
+	if err != nil {
+		return "", err
+	}
+	return resp.ID, nil
+}
+
+func (m *Manager) ExportContainer(ctx context.Context, containerID string, targetFile string) error {
+	containerID, err := m.ResolveContainer(ctx, containerID)
+	if err != nil {
+		return err
+	}
+	resp, err := m.client.ContainerExport(ctx, containerID)
+	if err != nil {
+		return err
+	}
+	defer func(resp io.ReadCloser) {
+		err := resp.Close()
+		if err != nil {
+			return
+		}
+	}(resp)
+	outputFile, err := os.Create(targetFile)
+	if err != nil {
+		return err
+	}
+	defer func(outputFile *os.File) {
+		err := outputFile.Close()
+		if err != nil {
+			return
+		}
+	}(outputFile)
+
+	_, err = io.Copy(outputFile, resp)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (m *Manager) ContainerChanges(ctx context.Context, containerID string) ([]ContainerChange, error) {
+	containerID, err := m.ResolveContainer(ctx, containerID)
+	if err != nil {
+		return nil, err
+	}
+	diffs, err := m.client.ContainerDiff(ctx, containerID)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make([]ContainerChange, 0, len(diffs))
+	for _, diff := range diffs {
+		var kind ChangeKind
+		switch diff.Kind {
+		case container.ChangeAdd:
+			kind = ChangeAdded
+		case container.ChangeDelete:
+			kind = ChangeDeleted
+		default:
+			kind = ChangeModified
+		}
+		changes = append(changes, ContainerChange{Path: diff.Path, Kind: kind})
+	}
+	return changes, nil
+}
+
+func (m *Manager) ContainerProcesses(ctx context.Context, containerID string, psArgs string) ([]ContainerProcess, error) {
+	containerID, err := m.ResolveContainer(ctx, containerID)
+	if err != nil {
+		return nil, err
+	}
+	var args []string
+	if psArgs != "" {
+		args = []string{psArgs}
+	}
+	top, err := m.client.ContainerTop(ctx, containerID, args)
+	if err != nil {
+		return nil, err
+	}
+	return parseProcesses(top.Titles, top.Processes), nil
+}
+
+// parseProcesses 按照 ps 的列名解析进程表, 兼容 ps -ef 与 ps aux 等不同格式
+func parseProcesses(titles []string, rows [][]string) []ContainerProcess {
+	processes := make([]ContainerProcess, 0, len(rows))
+	for _, row := range rows {
+		p := ContainerProcess{Fields: make(map[string]string, len(titles))}
+		for i, title := range titles {
+			if i >= len(row) {
+				break
+			}
+			value := row[i]
+			p.Fields[title] = value
+			switch strings.ToUpper(title) {
+			case "PID":
+				p.PID = value
+			case "PPID":
+				p.PPID = value
+			case "UID", "USER":
+				p.User = value
+			case "CMD", "COMMAND", "ARGS":
+				p.Command = value
+			}
+		}
+		processes = append(processes, p)
+	}
+	return processes
+}
@@ -6,7 +6,13 @@ package docker
 
 import (
 	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
 	"testing"
+
+	"github.com/docker/docker/api/types"
 )
 
 func TestListContainer(t *testing.T) {
@@ -95,3 +101,207 @@ func TestContainerExists(t *testing.T) {
 	}
 	t.Log(exists)
 }
+
+func TestCommitContainer(t *testing.T) {
+	manager, _ := NewManager()
+	imageID, err := manager.CommitContainer(context.Background(), "5c28bf6e16be", CommitOptions{
+		Repository: "redis-snapshot",
+		Tag:        "v1",
+		Author:     "amu",
+		Message:    "snapshot",
+		Labels:     map[string]string{CreatedByProbe: "true"},
+		Pause:      true,
+	})
+	if err != nil {
+		t.Error("commit container error: ", err)
+	}
+	t.Logf("image id: %s", imageID)
+}
+
+func TestCommitChanges(t *testing.T) {
+	changes, err := commitChanges(CommitOptions{
+		Cmd:     []string{"redis-server", "--appendonly", "yes"},
+		Env:     []string{"MODE=a b"},
+		Labels:  map[string]string{ServerTypeLabel: DatabaseServer},
+		Changes: []string{"EXPOSE 6379"},
+	})
+	if err != nil {
+		t.Fatalf("commit changes error: %v", err)
+	}
+	expected := []string{
+		`CMD ["redis-server","--appendonly","yes"]`,
+		`ENV MODE="a b"`,
+		`LABEL "server.type"="database"`,
+		`EXPOSE 6379`,
+	}
+	if strings.Join(changes, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("unexpected changes: %#v", changes)
+	}
+	if _, err := commitChanges(CommitOptions{Env: []string{"INVALID"}}); err == nil {
+		t.Error("expected invalid env error")
+	}
+}
+
+func TestExportContainer(t *testing.T) {
+	manager, _ := NewManager()
+	err := manager.ExportContainer(context.Background(), "5c28bf6e16be", "/Users/amu/Desktop/redis.tar")
+	t.Log("export container error: ", err)
+}
+
+func TestContainerChanges(t *testing.T) {
+	manager, _ := NewManager()
+	changes, err := manager.ContainerChanges(context.Background(), "redis")
+	if err != nil {
+		t.Error("container changes error: ", err)
+	}
+	for _, c := range changes {
+		t.Logf("%s %s", c.Kind, c.Path)
+	}
+}
+
+func TestContainerProcesses(t *testing.T) {
+	manager, _ := NewManager()
+	processes, err := manager.ContainerProcesses(context.Background(), "redis", "aux")
+	if err != nil {
+		t.Error("container processes error: ", err)
+	}
+	for _, p := range processes {
+		t.Logf("process: %#v", p)
+	}
+}
+
+func TestParseProcesses(t *testing.T) {
+	processes := parseProcesses(
+		[]string{"UID", "PID", "PPID", "C", "STIME", "TTY", "TIME", "CMD"},
+		[][]string{{"999", "1234", "1200", "0", "10:00", "?", "00:00:01", "redis-server *:6379"}},
+	)
+	if len(processes) != 1 {
+		t.Fatalf("expected 1 process, got %d", len(processes))
+	}
+	p := processes[0]
+	if p.PID != "1234" || p.PPID != "1200" || p.User != "999" || p.Command != "redis-server *:6379" {
+		t.Errorf("unexpected process: %#v", p)
+	}
+	if p.Fields["STIME"] != "10:00" {
+		t.Errorf("unexpected fields: %#v", p.Fields)
+	}
+}
+
+func TestResolveContainer(t *testing.T) {
+	manager, _ := NewManager()
+	containerID, err := manager.ResolveContainer(context.Background(), "redis")
+	if err != nil {
+		t.Error("resolve container error: ", err)
+	}
+	t.Logf("container id: %s", containerID)
+}
+
+func TestResolveContainerID(t *testing.T) {
+	containers := []types.Container{
+		{ID: "5c28bf6e16be0000", Names: []string{"/redis"}},
+		{ID: "5c28aa000000ffff", Names: []string{"/nginx"}},
+		{ID: "eedaf881e6c80000", Names: []string{"/5c28bf"}},
+	}
+	cases := []struct {
+		ref      string
+		expected string
+		err      error
+	}{
+		{ref: "5c28bf6e16be0000", expected: "5c28bf6e16be0000"},
+		{ref: "redis", expected: "5c28bf6e16be0000"},
+		{ref: "/nginx", expected: "5c28aa000000ffff"},
+		{ref: "5c28bf", expected: "eedaf881e6c80000"},
+		{ref: "eed", expected: "eedaf881e6c80000"},
+		{ref: "5c28", err: ErrAmbiguous},
+		{ref: "mysql", err: ErrNotFound},
+	}
+	for _, c := range cases {
+		id, err := resolveContainerID(containers, c.ref)
+		if c.err != nil {
+			if !errors.Is(err, c.err) {
+				t.Errorf("resolve %s: expected %v, got %v", c.ref, c.err, err)
+			}
+			continue
+		}
+		if err != nil || id != c.expected {
+			t.Errorf("resolve %s: expected %s, got %s (%v)", c.ref, c.expected, id, err)
+		}
+	}
+}
+
+func TestCreateContainerWithSpec(t *testing.T) {
+	manager, _ := NewManager()
+	cid, err := manager.CreateContainerWithSpec(context.Background(), ContainerSpec{
+		Name:  "redis-multi",
+		Image: "redis:7.0.5",
+		Networks: []NetworkAttachment{
+			{Network: "test", EndpointOptions: EndpointOptions{Aliases: []string{"cache"}}},
+			{Network: "test-v6"},
+		},
+		Labels: map[string]string{CreatedByProbe: "true", ServerTypeLabel: DatabaseServer},
+	})
+	if err != nil {
+		t.Error("create container error: ", err)
+	}
+	t.Logf("container id: %#v", cid)
+}
+
+// fullIDDaemon 模拟只有 ids 中容器的 daemon, 记录请求的路径
+func fullIDDaemon(ids []string, requests *[]string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		path := r.URL.Path[strings.Index(r.URL.Path[1:], "/")+1:]
+		*requests = append(*requests, path)
+		w.Header().Set("Content-Type", "application/json")
+		if path == "/containers/json" {
+			_, _ = w.Write([]byte(`[{"Id":"5c28bf6e16be0000","Names":["/redis"]}]`))
+			return
+		}
+		for _, id := range ids {
+			if path == "/containers/"+id+"/json" {
+				_, _ = w.Write([]byte(`{"Id":"` + id + `","Name":"/redis"}`))
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"message":"No such container"}`))
+	}
+}
+
+func TestResolveFullContainerID(t *testing.T) {
+	var requests []string
+	fullID, missingID := strings.Repeat("ab", 32), strings.Repeat("cd", 32)
+	m := newFakeDaemonManager(t, fullIDDaemon([]string{fullID}, &requests))
+	ctx := context.Background()
+
+	// 完整 ID 只查询该容器, 不列出全部容器
+	if id, err := m.ResolveContainer(ctx, fullID); err != nil || id != fullID || !reflect.DeepEqual(requests, []string{"/containers/" + fullID + "/json"}) {
+		t.Errorf("id = %q, err = %v, requests = %v", id, err, requests)
+	}
+	if _, err := m.ResolveContainer(ctx, missingID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("err = %v", err)
+	}
+	if exists, err := m.ContainerExists(ctx, missingID); exists || err != nil {
+		t.Errorf("exists = %v, err = %v", exists, err)
+	}
+	if _, err := m.GetContainerStats(ctx, missingID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("err = %v", err)
+	}
+	if _, err := m.GetContainerIDByContainerName(context.Background(), "mysql"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("err = %v", err)
+	}
+	if id, err := m.GetContainerIDByContainerName(context.Background(), "/redis"); err != nil || id != "5c28bf6e16be0000" {
+		t.Errorf("id = %q, err = %v", id, err)
+	}
+
+	// 完整 ID 只在真正有该容器的主机上找到
+	var otherRequests []string
+	p, err := NewPool(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = p.Add("a", m, nil)
+	_ = p.Add("b", newFakeDaemonManager(t, fullIDDaemon(nil, &otherRequests)), nil)
+	if host, id, err := p.LocateContainer(ctx, fullID); host != "a" || id != fullID || err != nil {
+		t.Errorf("host = %q, id = %q, err = %v", host, id, err)
+	}
+}
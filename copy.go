@@ -0,0 +1,480 @@
+// Package docker
+// Date: 2024/07/18 10:21:37
+// Author: Amu
+// Description:
+package docker
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/errdefs"
+)
+
+// CopyOptions 控制拷贝进容器时 tar 条目的属主和权限
+type CopyOptions struct {
+	PreserveOwner             bool        // 保留本地文件的 uid/gid，否则使用 UID/GID
+	UID                       int         // PreserveOwner 为 false 时条目的属主
+	GID                       int         // PreserveOwner 为 false 时条目的属组
+	Mode                      fs.FileMode // 非零时覆盖普通文件的权限位
+	CopyUIDGID                bool        // 由 daemon 将条目属主改为容器内的用户
+	AllowOverwriteDirWithFile bool        // 允许用文件覆盖同名目录
+}
+
+// ContainerPathStat 容器内路径的状态信息
+type ContainerPathStat struct {
+	Name       string      `json:"name"`
+	Size       int64       `json:"size"`
+	Mode       fs.FileMode `json:"mode"`
+	Mtime      time.Time   `json:"mtime"`
+	LinkTarget string      `json:"link_target"`
+}
+
+func (m *Manager) StatContainerPath(ctx context.Context, containerID, containerPath string) (*ContainerPathStat, error) {
+	containerID, err := m.ResolveContainer(ctx, containerID)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := m.client.ContainerStatPath(ctx, containerID, containerPath)
+	if err != nil {
+		return nil, err
+	}
+	return &ContainerPathStat{
+		Name:       stat.Name,
+		Size:       stat.Size,
+		Mode:       stat.Mode,
+		Mtime:      stat.Mtime,
+		LinkTarget: stat.LinkTarget,
+	}, nil
+}
+
+// resolveCopyTarget 按照 docker cp 的语义计算解包目录和归档内的根条目名：
+// dstPath 为已存在的目录时拷贝到其下并保留源名称，否则视为目标文件路径
+func (m *Manager) resolveCopyTarget(ctx context.Context, containerID, srcName, dstPath string) (string, string, error) {
+	stat, err := m.client.ContainerStatPath(ctx, containerID, dstPath)
+	if err == nil && stat.Mode.IsDir() {
+		return dstPath, srcName, nil
+	}
+	if err != nil && !errdefs.IsNotFound(err) {
+		return "", "", err
+	}
+	if strings.HasSuffix(dstPath, "/") {
+		return "", "", fmt.Errorf("destination directory %s does not exist", dstPath)
+	}
+	return path.Dir(dstPath), path.Base(dstPath), nil
+}
+
+func (m *Manager) CopyToContainer(ctx context.Context, containerID, srcPath, dstPath string, opts CopyOptions) (err error) {
+	defer m.audit(ctx, "CopyToContainer", auditArgs{"container": containerID, "src": srcPath, "dst": dstPath, "options": opts}).done(nil, &err)
+	containerID, err = m.ResolveContainer(ctx, containerID)
+	if err != nil {
+		return err
+	}
+	info, err := os.Lstat(srcPath)
+	if err != nil {
+		return err
+	}
+	dstDir, name, err := m.resolveCopyTarget(ctx, containerID, info.Name(), dstPath)
+	if err != nil {
+		return err
+	}
+
+	reader, writer := io.Pipe()
+	go func() {
+		err := tarPath(writer, srcPath, name, opts)
+		_ = writer.CloseWithError(err)
+	}()
+	defer func(reader *io.PipeReader) {
+		err := reader.Close()
+		if err != nil {
+			return
+		}
+	}(reader)
+
+	return m.client.CopyToContainer(ctx, containerID, dstDir, reader, container.CopyToContainerOptions{
+		AllowOverwriteDirWithFile: opts.AllowOverwriteDirWithFile,
+		CopyUIDGID:                opts.CopyUIDGID,
+	})
+}
+
+// CopyReaderToContainer 将 r 中的内容作为单个文件写入容器的 dstPath
+func (m *Manager) CopyReaderToContainer(ctx context.Context, containerID, dstPath string, r io.Reader, opts CopyOptions) (err error) {
+	defer m.audit(ctx, "CopyReaderToContainer", auditArgs{"container": containerID, "dst": dstPath, "options": opts}).done(nil, &err)
+	containerID, err = m.ResolveContainer(ctx, containerID)
+	if err != nil {
+		return err
+	}
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	dstDir, name, err := m.resolveCopyTarget(ctx, containerID, path.Base(dstPath), dstPath)
+	if err != nil {
+		return err
+	}
+
+	mode := opts.Mode
+	if mode == 0 {
+		mode = 0644
+	}
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+	hdr := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     int64(len(content)),
+		Mode:     int64(mode.Perm()),
+		ModTime:  time.Now(),
+		Uid:      opts.UID,
+		Gid:      opts.GID,
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if _, err := tw.Write(content); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+
+	return m.client.CopyToContainer(ctx, containerID, dstDir, buf, container.CopyToContainerOptions{
+		AllowOverwriteDirWithFile: opts.AllowOverwriteDirWithFile,
+		CopyUIDGID:                opts.CopyUIDGID,
+	})
+}
+
+// CopyFSToContainer 将 fsys 的全部内容拷贝到容器内已存在的目录 dstDir 下
+func (m *Manager) CopyFSToContainer(ctx context.Context, containerID string, fsys fs.FS, dstDir string, opts CopyOptions) (err error) {
+	defer m.audit(ctx, "CopyFSToContainer", auditArgs{"container": containerID, "dst": dstDir, "options": opts}).done(nil, &err)
+	containerID, err = m.ResolveContainer(ctx, containerID)
+	if err != nil {
+		return err
+	}
+	reader, writer := io.Pipe()
+	go func() {
+		err := tarFS(writer, fsys, opts)
+		_ = writer.CloseWithError(err)
+	}()
+	defer func(reader *io.PipeReader) {
+		err := reader.Close()
+		if err != nil {
+			return
+		}
+	}(reader)
+
+	return m.client.CopyToContainer(ctx, containerID, dstDir, reader, container.CopyToContainerOptions{
+		AllowOverwriteDirWithFile: opts.AllowOverwriteDirWithFile,
+		CopyUIDGID:                opts.CopyUIDGID,
+	})
+}
+
+// CopyFromContainer 将容器内的 srcPath 拷贝到本地 dstPath，dstPath 为已存在的目录时拷贝到其下
+func (m *Manager) CopyFromContainer(ctx context.Context, containerID, srcPath, dstPath string) error {
+	containerID, err := m.ResolveContainer(ctx, containerID)
+	if err != nil {
+		return err
+	}
+	reader, stat, err := m.client.CopyFromContainer(ctx, containerID, srcPath)
+	if err != nil {
+		return err
+	}
+	defer func(reader io.ReadCloser) {
+		err := reader.Close()
+		if err != nil {
+			return
+		}
+	}(reader)
+
+	dstDir, name := filepath.Dir(dstPath), filepath.Base(dstPath)
+	if info, err := os.Stat(dstPath); err == nil && info.IsDir() {
+		dstDir, name = dstPath, stat.Name
+	}
+	return untar(reader, dstDir, stat.Name, name)
+}
+
+// ReadFileFromContainer 读取容器内单个普通文件的内容
+func (m *Manager) ReadFileFromContainer(ctx context.Context, containerID, srcPath string) ([]byte, error) {
+	containerID, err := m.ResolveContainer(ctx, containerID)
+	if err != nil {
+		return nil, err
+	}
+	reader, stat, err := m.client.CopyFromContainer(ctx, containerID, srcPath)
+	if err != nil {
+		return nil, err
+	}
+	defer func(reader io.ReadCloser) {
+		err := reader.Close()
+		if err != nil {
+			return
+		}
+	}(reader)
+	if !stat.Mode.IsRegular() {
+		return nil, fmt.Errorf("%s is not a regular file", srcPath)
+	}
+
+	tr := tar.NewReader(reader)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("%s not found in archive", srcPath)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			return io.ReadAll(tr)
+		}
+	}
+}
+
+func (m *Manager) CopyFileToContainer(ctx context.Context, containerID string, srcFile, dstFile string) error {
+	return m.CopyToContainer(ctx, containerID, srcFile, dstFile, CopyOptions{})
+}
+
+// applyCopyOptions 根据 CopyOptions 调整 tar 条目的属主和权限
+func applyCopyOptions(hdr *tar.Header, opts CopyOptions) {
+	if !opts.PreserveOwner {
+		hdr.Uid, hdr.Gid = opts.UID, opts.GID
+		hdr.Uname, hdr.Gname = "", ""
+	}
+	if opts.Mode != 0 && hdr.Typeflag == tar.TypeReg {
+		hdr.Mode = int64(opts.Mode.Perm())
+	}
+}
+
+// tarPath 将本地文件或目录树以 name 为根条目写入 tar 流
+func tarPath(w io.Writer, srcPath, name string, opts CopyOptions) error {
+	tw := tar.NewWriter(w)
+	err := filepath.Walk(srcPath, func(file string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(srcPath, file)
+		if err != nil {
+			return err
+		}
+
+		var link string
+		if info.Mode()&fs.ModeSymlink != 0 {
+			if link, err = os.Readlink(file); err != nil {
+				return err
+			}
+		}
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = path.Join(name, filepath.ToSlash(rel))
+		if info.IsDir() {
+			hdr.Name += "/"
+		}
+		applyCopyOptions(hdr, opts)
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer func(f *os.File) {
+			err := f.Close()
+			if err != nil {
+				return
+			}
+		}(f)
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// tarFS 将 fs.FS 的内容写入 tar 流，条目名相对于 fsys 的根
+func tarFS(w io.Writer, fsys fs.FS, opts CopyOptions) error {
+	tw := tar.NewWriter(w)
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if name == "." {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && !info.Mode().IsRegular() {
+			return nil
+		}
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = name
+		if info.IsDir() {
+			hdr.Name += "/"
+		}
+		applyCopyOptions(hdr, opts)
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		f, err := fsys.Open(name)
+		if err != nil {
+			return err
+		}
+		defer func(f fs.File) {
+			err := f.Close()
+			if err != nil {
+				return
+			}
+		}(f)
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// untar 将 tar 流解包到 dstDir，根条目 srcName 被重命名为 dstName。
+// tar 流来自容器, 不可信: 每个条目的父目录按符号链接解析后必须位于 dstDir 内,
+// 符号链接不能指向绝对路径或 dstDir 之外, 以免后续条目经由链接写到宿主机的其它位置
+func untar(r io.Reader, dstDir, srcName, dstName string) error {
+	root, err := filepath.EvalSymlinks(dstDir)
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		name := path.Clean(hdr.Name)
+		if name == srcName {
+			name = dstName
+		} else if strings.HasPrefix(name, srcName+"/") {
+			name = dstName + strings.TrimPrefix(name, srcName)
+		}
+		target := filepath.Join(root, filepath.FromSlash(name))
+		if !withinDir(root, target) || target == root {
+			return fmt.Errorf("invalid archive entry %q", hdr.Name)
+		}
+		parent, err := resolveInDir(root, filepath.Dir(target))
+		if err != nil {
+			return fmt.Errorf("invalid archive entry %q: %w", hdr.Name, err)
+		}
+		target = filepath.Join(parent, filepath.Base(target))
+
+		mode := fs.FileMode(hdr.Mode).Perm()
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if info, err := os.Lstat(target); err == nil && info.Mode()&fs.ModeSymlink != 0 {
+				if err := os.Remove(target); err != nil {
+					return err
+				}
+			}
+			if err := os.MkdirAll(target, mode); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(parent, 0755); err != nil {
+				return err
+			}
+			// 已存在的同名符号链接会被 OpenFile 跟随, 先删除
+			if info, err := os.Lstat(target); err == nil && info.Mode()&fs.ModeSymlink != 0 {
+				if err := os.Remove(target); err != nil {
+					return err
+				}
+			}
+			if err := writeFile(target, tr, mode); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			link := filepath.FromSlash(hdr.Linkname)
+			if filepath.IsAbs(link) || !withinDir(root, filepath.Join(parent, link)) {
+				return fmt.Errorf("invalid archive entry %q: link target %q escapes destination", hdr.Name, hdr.Linkname)
+			}
+			if err := os.MkdirAll(parent, 0755); err != nil {
+				return err
+			}
+			if err := os.Remove(target); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+			if err := os.Symlink(hdr.Linkname, target); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// withinDir 判断 p 是否为 root 或位于 root 之内, 两者都应是 Clean 后的路径
+func withinDir(root, p string) bool {
+	return p == root || strings.HasPrefix(p, root+string(os.PathSeparator))
+}
+
+// resolveInDir 解析 dir 中已存在部分的符号链接, 解析结果不在 root 内时返回错误;
+// 不存在的部分之后由 MkdirAll 创建为普通目录
+func resolveInDir(root, dir string) (string, error) {
+	existing, missing := dir, ""
+	for {
+		if _, err := os.Lstat(existing); err == nil {
+			break
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+		missing = filepath.Join(filepath.Base(existing), missing)
+		existing = filepath.Dir(existing)
+	}
+	resolved, err := filepath.EvalSymlinks(existing)
+	if err != nil {
+		return "", err
+	}
+	resolved = filepath.Join(resolved, missing)
+	if !withinDir(root, resolved) {
+		return "", fmt.Errorf("path %s resolves outside destination", dir)
+	}
+	return resolved, nil
+}
+
+func writeFile(target string, r io.Reader, mode fs.FileMode) error {
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	defer func(f *os.File) {
+		err := f.Close()
+		if err != nil {
+			return
+		}
+	}(f)
+	_, err = io.Copy(f, r)
+	return err
+}
@@ -0,0 +1,154 @@
+// Package docker
+// Date: 2024/07/18 10:22:05
+// Author: Amu
+// Description:
+package docker
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestCopyToContainer(t *testing.T) {
+	manager, _ := NewManager()
+	err := manager.CopyToContainer(context.Background(), "5c28bf6e16be", "/Users/amu/Desktop/conf", "/etc/", CopyOptions{})
+	if err != nil {
+		t.Error("copy to container error: ", err)
+	}
+}
+
+func TestCopyFromContainer(t *testing.T) {
+	manager, _ := NewManager()
+	err := manager.CopyFromContainer(context.Background(), "5c28bf6e16be", "/etc/hosts", t.TempDir())
+	if err != nil {
+		t.Error("copy from container error: ", err)
+	}
+}
+
+func TestTarPathRoundTrip(t *testing.T) {
+	src := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(src, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "sub", "a.txt"), []byte("hello"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := tarPath(buf, src, "conf", CopyOptions{}); err != nil {
+		t.Fatalf("tar path error: %v", err)
+	}
+	dst := t.TempDir()
+	if err := untar(buf, dst, "conf", "renamed"); err != nil {
+		t.Fatalf("untar error: %v", err)
+	}
+
+	target := filepath.Join(dst, "renamed", "sub", "a.txt")
+	content, err := os.ReadFile(target)
+	if err != nil {
+		t.Fatalf("read extracted file error: %v", err)
+	}
+	if string(content) != "hello" {
+		t.Errorf("unexpected content: %q", content)
+	}
+	info, _ := os.Stat(target)
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("mode not preserved: %v", info.Mode())
+	}
+}
+
+func TestTarFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"app/config.yaml": {Data: []byte("port: 80"), Mode: 0644},
+	}
+	buf := new(bytes.Buffer)
+	if err := tarFS(buf, fsys, CopyOptions{Mode: 0600}); err != nil {
+		t.Fatalf("tar fs error: %v", err)
+	}
+	dst := t.TempDir()
+	if err := untar(buf, dst, "app", "app"); err != nil {
+		t.Fatalf("untar error: %v", err)
+	}
+	info, err := os.Stat(filepath.Join(dst, "app", "config.yaml"))
+	if err != nil {
+		t.Fatalf("stat extracted file error: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("mode override not applied: %v", info.Mode())
+	}
+}
+
+func TestUntarRejectsTraversal(t *testing.T) {
+	fsys := fstest.MapFS{"evil": {Data: []byte("x"), Mode: 0644}}
+	buf := new(bytes.Buffer)
+	if err := tarFS(buf, fsys, CopyOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	err := untar(buf, t.TempDir(), "evil", "../evil")
+	if err == nil || !strings.Contains(err.Error(), "invalid archive entry") {
+		t.Errorf("expected traversal error, got %v", err)
+	}
+}
+
+func TestUntarRejectsSymlinkEscape(t *testing.T) {
+	outside := t.TempDir()
+	tests := []struct {
+		name    string
+		entries []tar.Header
+	}{
+		{"write through symlink", []tar.Header{
+			{Name: "x", Typeflag: tar.TypeSymlink, Linkname: outside},
+			{Name: "x/evil", Typeflag: tar.TypeReg, Mode: 0644, Size: 4},
+		}},
+		{"relative link escape", []tar.Header{
+			{Name: "app/x", Typeflag: tar.TypeSymlink, Linkname: "../../.."},
+		}},
+		{"absolute link", []tar.Header{
+			{Name: "app/x", Typeflag: tar.TypeSymlink, Linkname: "/etc"},
+		}},
+	}
+	for _, tt := range tests {
+		buf := new(bytes.Buffer)
+		tw := tar.NewWriter(buf)
+		for _, hdr := range tt.entries {
+			hdr := hdr
+			if err := tw.WriteHeader(&hdr); err != nil {
+				t.Fatal(err)
+			}
+			if hdr.Size > 0 {
+				_, _ = tw.Write([]byte("evil"))
+			}
+		}
+		_ = tw.Close()
+
+		dst := t.TempDir()
+		if err := untar(buf, dst, "app", "app"); err == nil || !strings.Contains(err.Error(), "invalid archive entry") {
+			t.Errorf("%s: expected escape error, got %v", tt.name, err)
+		}
+		if entries, _ := os.ReadDir(outside); len(entries) != 0 {
+			t.Fatalf("%s: wrote outside destination: %v", tt.name, entries)
+		}
+	}
+
+	// 指向 dstDir 内部的相对链接仍然允许
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+	_ = tw.WriteHeader(&tar.Header{Name: "app/conf", Typeflag: tar.TypeDir, Mode: 0755})
+	_ = tw.WriteHeader(&tar.Header{Name: "app/current", Typeflag: tar.TypeSymlink, Linkname: "conf"})
+	_ = tw.WriteHeader(&tar.Header{Name: "app/current/a", Typeflag: tar.TypeReg, Mode: 0644, Size: 1})
+	_, _ = tw.Write([]byte("a"))
+	_ = tw.Close()
+	dst := t.TempDir()
+	if err := untar(buf, dst, "app", "app"); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(filepath.Join(dst, "app", "conf", "a")); err != nil || string(data) != "a" {
+		t.Errorf("data = %q, err = %v", data, err)
+	}
+}
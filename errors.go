@@ -0,0 +1,37 @@
+// Package docker
+// Date: 2024/07/19 09:42:18
+// Author: Amu
+// Description:
+package docker
+
+import "errors"
+
+var (
+	ErrNotFound  = errors.New("not found")
+	ErrAmbiguous = errors.New("ambiguous reference")
+	ErrInUse     = errors.New("in use")
+	ErrInvalid   = errors.New("invalid argument")
+
+	ErrCircuitOpen   = errors.New("circuit breaker is open")
+	ErrUnschedulable = errors.New("no host satisfies the placement request")
+)
+
+// invalidError 参数校验失败的错误, 保留原有的错误信息, 同时可以用 errors.Is 匹配 ErrInvalid
+type invalidError struct {
+	err error
+}
+
+func (e *invalidError) Error() string {
+	return e.err.Error()
+}
+
+func (e *invalidError) Unwrap() []error {
+	return []error{ErrInvalid, e.err}
+}
+
+func invalidArgument(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &invalidError{err: err}
+}
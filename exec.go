@@ -0,0 +1,133 @@
+// Package docker
+// Date: 2024/08/13 14:08:27
+// Author: Amu
+// Description:
+package docker
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+// ExecOptions 在容器内执行命令的参数
+type ExecOptions struct {
+	Cmd        []string
+	Tty        bool     // 分配伪终端, 此时标准错误与标准输出合并
+	Stdin      bool     // 连接标准输入
+	Env        []string // 追加的环境变量, 形如 KEY=value
+	WorkingDir string
+	User       string
+	Privileged bool
+	DetachKeys string // 断开连接的按键序列, 为空时使用 daemon 默认值
+	Height     uint   // 初始终端行数, 与 Width 同时为 0 时使用 daemon 默认值
+	Width      uint   // 初始终端列数
+}
+
+// ExecStatus exec 进程的状态
+type ExecStatus struct {
+	ID          string `json:"id"`
+	ContainerID string `json:"container_id"`
+	Running     bool   `json:"running"`
+	ExitCode    int    `json:"exit_code"`
+	PID         int    `json:"pid"`
+}
+
+// ExecSession 一次交互式 exec, 输出读完后可通过 Wait 获取退出码
+type ExecSession struct {
+	ID string
+	*AttachStream
+
+	manager *Manager
+}
+
+// ExecContainer 在容器内启动命令并连接其标准输入输出
+func (m *Manager) ExecContainer(ctx context.Context, containerID string, opts ExecOptions) (session *ExecSession, err error) {
+	var execID string
+	defer m.audit(ctx, "ExecContainer", auditArgs{"container": containerID, "options": auditExecOptions(opts)}).done(&execID, &err)
+	if len(opts.Cmd) == 0 {
+		return nil, invalidArgument(errors.New("exec command is required"))
+	}
+	containerID, err = m.ResolveContainer(ctx, containerID)
+	if err != nil {
+		return nil, err
+	}
+
+	var consoleSize *[2]uint
+	if opts.Height > 0 || opts.Width > 0 {
+		consoleSize = &[2]uint{opts.Height, opts.Width}
+	}
+	resp, err := m.client.ContainerExecCreate(ctx, containerID, container.ExecOptions{
+		User:         opts.User,
+		Privileged:   opts.Privileged,
+		Tty:          opts.Tty,
+		ConsoleSize:  consoleSize,
+		AttachStdin:  opts.Stdin,
+		AttachStdout: true,
+		AttachStderr: true,
+		DetachKeys:   opts.DetachKeys,
+		Env:          opts.Env,
+		WorkingDir:   opts.WorkingDir,
+		Cmd:          opts.Cmd,
+	})
+	if err != nil {
+		return nil, err
+	}
+	hijacked, err := m.client.ContainerExecAttach(ctx, resp.ID, container.ExecAttachOptions{
+		Tty:         opts.Tty,
+		ConsoleSize: consoleSize,
+	})
+	if err != nil {
+		return nil, err
+	}
+	execID = resp.ID
+	return &ExecSession{
+		ID:           resp.ID,
+		AttachStream: newAttachStream(hijacked, opts.Tty),
+		manager:      m,
+	}, nil
+}
+
+func (m *Manager) ResizeExecTTY(ctx context.Context, execID string, height, width uint) error {
+	return m.client.ContainerExecResize(ctx, execID, container.ResizeOptions{Height: height, Width: width})
+}
+
+func (m *Manager) InspectExec(ctx context.Context, execID string) (*ExecStatus, error) {
+	inspect, err := m.client.ContainerExecInspect(ctx, execID)
+	if err != nil {
+		return nil, err
+	}
+	return &ExecStatus{
+		ID:          inspect.ExecID,
+		ContainerID: inspect.ContainerID,
+		Running:     inspect.Running,
+		ExitCode:    inspect.ExitCode,
+		PID:         inspect.Pid,
+	}, nil
+}
+
+func (s *ExecSession) Resize(ctx context.Context, height, width uint) error {
+	return s.manager.ResizeExecTTY(ctx, s.ID, height, width)
+}
+
+// Wait 等待命令结束并返回退出码; 输出流结束后 daemon 可能稍晚才更新状态, 因此轮询直到不再运行
+func (s *ExecSession) Wait(ctx context.Context) (int, error) {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		status, err := s.manager.InspectExec(ctx, s.ID)
+		if err != nil {
+			return 0, err
+		}
+		if !status.Running {
+			return status.ExitCode, nil
+		}
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
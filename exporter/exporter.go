@@ -0,0 +1,284 @@
+// Package exporter
+// Date: 2024/08/09 15:20:17
+// Author: Amu
+// Description: 以 Prometheus 文本格式导出容器和 daemon 的指标
+package exporter
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/amuluze/docker"
+)
+
+const contentType = "text/plain; version=0.0.4; charset=utf-8"
+
+const (
+	DefaultTimeout     = 10 * time.Second
+	DefaultConcurrency = 8
+)
+
+// Source 导出指标所需的数据来源, *docker.Manager 实现了该接口
+type Source interface {
+	ListContainerStatus(ctx context.Context) ([]docker.ContainerStatus, error)
+	GetContainerStats(ctx context.Context, containerID string) (*docker.ContainerStats, error)
+	DiskUsage(ctx context.Context) (*docker.DiskUsage, error)
+}
+
+// Exporter 每次被抓取时采集一次指标, 实现了 http.Handler
+type Exporter struct {
+	source      Source
+	timeout     time.Duration
+	concurrency int
+}
+
+type Option func(*Exporter)
+
+// WithTimeout 设置单次抓取的超时时间, 默认为 DefaultTimeout
+func WithTimeout(timeout time.Duration) Option {
+	return func(e *Exporter) {
+		e.timeout = timeout
+	}
+}
+
+// WithConcurrency 设置同时采集资源使用的容器数量, 默认为 DefaultConcurrency
+func WithConcurrency(n int) Option {
+	return func(e *Exporter) {
+		e.concurrency = n
+	}
+}
+
+func New(source Source, opts ...Option) *Exporter {
+	e := &Exporter{
+		source:      source,
+		timeout:     DefaultTimeout,
+		concurrency: DefaultConcurrency,
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	if e.concurrency < 1 {
+		e.concurrency = 1
+	}
+	return e
+}
+
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), e.timeout)
+	defer cancel()
+
+	w.Header().Set("Content-Type", contentType)
+	_ = e.Collect(ctx).Encode(w)
+}
+
+// Collect 采集一次全部指标
+func (e *Exporter) Collect(ctx context.Context) *Metrics {
+	start := time.Now()
+	metrics := newMetrics()
+	var errCount int
+
+	statuses, err := e.source.ListContainerStatus(ctx)
+	if err != nil {
+		errCount++
+		metrics.add("docker_up", 0)
+	} else {
+		metrics.add("docker_up", 1)
+		errCount += e.collectContainers(ctx, metrics, statuses)
+	}
+
+	if du, err := e.source.DiskUsage(ctx); err != nil {
+		errCount++
+	} else {
+		metrics.add("docker_images", float64(du.Images))
+		metrics.add("docker_images_size_bytes", float64(du.ImagesSize))
+		metrics.add("docker_layers_size_bytes", float64(du.LayersSize))
+		metrics.add("docker_containers", float64(du.Containers))
+		metrics.add("docker_containers_size_bytes", float64(du.ContainersSize))
+		metrics.add("docker_volumes", float64(du.Volumes))
+		metrics.add("docker_volumes_size_bytes", float64(du.VolumesSize))
+		metrics.add("docker_build_cache_size_bytes", float64(du.BuildCacheSize))
+	}
+
+	metrics.add("docker_exporter_scrape_errors", float64(errCount))
+	metrics.add("docker_exporter_scrape_duration_seconds", time.Since(start).Seconds())
+	return metrics
+}
+
+// healthStates 容器健康状态的取值, 每个状态输出一条序列, 当前状态为 1
+var healthStates = []string{"starting", "healthy", "unhealthy"}
+
+func (e *Exporter) collectContainers(ctx context.Context, metrics *Metrics, statuses []docker.ContainerStatus) int {
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		errCount int
+	)
+	sem := make(chan struct{}, e.concurrency)
+	for _, status := range statuses {
+		labels := containerLabels(status)
+		up := 0.0
+		if status.Running {
+			up = 1
+		}
+		metrics.add("docker_container_up", up, labels...)
+		metrics.add("docker_container_restart_count", float64(status.RestartCount), labels...)
+		if status.Health != "" {
+			for _, state := range healthStates {
+				value := 0.0
+				if state == status.Health {
+					value = 1
+				}
+				metrics.add("docker_container_health_status", value, append(labels, label{"status", state})...)
+			}
+		}
+		if !status.Running {
+			continue
+		}
+
+		wg.Add(1)
+		go func(id string, labels []label) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			stats, err := e.source.GetContainerStats(ctx, id)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errCount++
+				return
+			}
+			metrics.add("docker_container_cpu_usage_percent", stats.CPUPercent, labels...)
+			metrics.add("docker_container_memory_usage_bytes", float64(stats.MemoryUsage), labels...)
+			metrics.add("docker_container_memory_limit_bytes", float64(stats.MemoryLimit), labels...)
+			metrics.add("docker_container_network_receive_bytes_total", float64(stats.NetworkRxBytes), labels...)
+			metrics.add("docker_container_network_transmit_bytes_total", float64(stats.NetworkTxBytes), labels...)
+			metrics.add("docker_container_blkio_read_bytes_total", float64(stats.BlockReadBytes), labels...)
+			metrics.add("docker_container_blkio_write_bytes_total", float64(stats.BlockWriteBytes), labels...)
+			metrics.add("docker_container_pids", float64(stats.PIDs), labels...)
+		}(status.ID, labels)
+	}
+	wg.Wait()
+	return errCount
+}
+
+func containerLabels(status docker.ContainerStatus) []label {
+	serverType := status.Labels[docker.ServerTypeLabel]
+	if serverType == "" {
+		serverType = docker.UnknownServer
+	}
+	return []label{
+		{"name", status.Name},
+		{"image", status.Image},
+		{"server_type", serverType},
+	}
+}
+
+type metricDesc struct {
+	help string
+	kind string
+}
+
+// descs 全部指标的说明, 输出时按名称排序
+var descs = map[string]metricDesc{
+	"docker_up":                                     {"Whether the docker daemon could be reached.", "gauge"},
+	"docker_images":                                 {"Number of images.", "gauge"},
+	"docker_images_size_bytes":                      {"Total size of images in bytes.", "gauge"},
+	"docker_layers_size_bytes":                      {"Total size of image layers on disk in bytes.", "gauge"},
+	"docker_containers":                             {"Number of containers.", "gauge"},
+	"docker_containers_size_bytes":                  {"Total size of container writable layers in bytes.", "gauge"},
+	"docker_volumes":                                {"Number of volumes.", "gauge"},
+	"docker_volumes_size_bytes":                     {"Total size of volumes in bytes.", "gauge"},
+	"docker_build_cache_size_bytes":                 {"Total size of the build cache in bytes.", "gauge"},
+	"docker_exporter_scrape_errors":                 {"Number of errors during the last scrape.", "gauge"},
+	"docker_exporter_scrape_duration_seconds":       {"Duration of the last scrape in seconds.", "gauge"},
+	"docker_container_up":                           {"Whether the container is running.", "gauge"},
+	"docker_container_restart_count":                {"Number of times the container has been restarted by docker.", "gauge"},
+	"docker_container_health_status":                {"Health check status of the container, 1 for the current status.", "gauge"},
+	"docker_container_cpu_usage_percent":            {"CPU usage of the container as a percentage of one CPU.", "gauge"},
+	"docker_container_memory_usage_bytes":           {"Memory usage of the container excluding page cache in bytes.", "gauge"},
+	"docker_container_memory_limit_bytes":           {"Memory limit of the container in bytes.", "gauge"},
+	"docker_container_network_receive_bytes_total":  {"Bytes received by the container on all networks.", "counter"},
+	"docker_container_network_transmit_bytes_total": {"Bytes transmitted by the container on all networks.", "counter"},
+	"docker_container_blkio_read_bytes_total":       {"Bytes read by the container from block devices.", "counter"},
+	"docker_container_blkio_write_bytes_total":      {"Bytes written by the container to block devices.", "counter"},
+	"docker_container_pids":                         {"Number of processes in the container.", "gauge"},
+}
+
+type label struct {
+	name  string
+	value string
+}
+
+type sample struct {
+	labels []label
+	value  float64
+}
+
+// Metrics 一次采集的结果
+type Metrics struct {
+	samples map[string][]sample
+}
+
+func newMetrics() *Metrics {
+	return &Metrics{samples: make(map[string][]sample)}
+}
+
+func (m *Metrics) add(name string, value float64, labels ...label) {
+	m.samples[name] = append(m.samples[name], sample{labels: labels, value: value})
+}
+
+// Encode 以 Prometheus 文本格式输出
+func (m *Metrics) Encode(w io.Writer) error {
+	names := make([]string, 0, len(m.samples))
+	for name := range m.samples {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	bw := bufio.NewWriter(w)
+	for _, name := range names {
+		desc := descs[name]
+		bw.WriteString("# HELP " + name + " " + desc.help + "\n")
+		bw.WriteString("# TYPE " + name + " " + desc.kind + "\n")
+		samples := m.samples[name]
+		sort.SliceStable(samples, func(i, j int) bool { return formatLabels(samples[i].labels) < formatLabels(samples[j].labels) })
+		for _, s := range samples {
+			bw.WriteString(name + formatLabels(s.labels) + " " + formatValue(s.value) + "\n")
+		}
+	}
+	return bw.Flush()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatLabels(labels []label) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	parts := make([]string, 0, len(labels))
+	for _, l := range labels {
+		parts = append(parts, l.name+`="`+labelEscaper.Replace(l.value)+`"`)
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
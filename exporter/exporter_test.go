@@ -0,0 +1,104 @@
+// Package exporter
+// Date: 2024/08/09 15:31:52
+// Author: Amu
+// Description:
+package exporter
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/amuluze/docker"
+)
+
+type fakeSource struct {
+	statuses []docker.ContainerStatus
+	stats    map[string]*docker.ContainerStats
+	du       *docker.DiskUsage
+	err      error
+}
+
+func (f *fakeSource) ListContainerStatus(context.Context) ([]docker.ContainerStatus, error) {
+	return f.statuses, f.err
+}
+
+func (f *fakeSource) GetContainerStats(_ context.Context, containerID string) (*docker.ContainerStats, error) {
+	stats, ok := f.stats[containerID]
+	if !ok {
+		return nil, errors.New("no such container")
+	}
+	return stats, nil
+}
+
+func (f *fakeSource) DiskUsage(context.Context) (*docker.DiskUsage, error) {
+	if f.du == nil {
+		return nil, errors.New("disk usage unavailable")
+	}
+	return f.du, nil
+}
+
+func TestExporter(t *testing.T) {
+	source := &fakeSource{
+		statuses: []docker.ContainerStatus{
+			{ID: "c1", Name: "redis", Image: "redis:7.0.5", Running: true, RestartCount: 2, Health: "healthy", Labels: map[string]string{docker.ServerTypeLabel: docker.DatabaseServer}},
+			{ID: "c2", Name: "web", Image: "nginx", Running: true},
+			{ID: "c3", Name: "job", Image: `busy"box`},
+		},
+		stats: map[string]*docker.ContainerStats{
+			"c1": {CPUPercent: 12.5, MemoryUsage: 1024, MemoryLimit: 4096, NetworkRxBytes: 10, NetworkTxBytes: 20, BlockReadBytes: 30, BlockWriteBytes: 40, PIDs: 5},
+		},
+		du: &docker.DiskUsage{Images: 3, ImagesSize: 300, Volumes: 2, VolumesSize: 50},
+	}
+
+	recorder := httptest.NewRecorder()
+	New(source).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if ct := recorder.Header().Get("Content-Type"); ct != contentType {
+		t.Errorf("content type = %s", ct)
+	}
+	body := recorder.Body.String()
+
+	redis := `{name="redis",image="redis:7.0.5",server_type="database"}`
+	for _, line := range []string{
+		"# TYPE docker_container_up gauge",
+		"# TYPE docker_container_network_receive_bytes_total counter",
+		"docker_up 1",
+		"docker_container_up" + redis + " 1",
+		`docker_container_up{name="job",image="busy\"box",server_type="unknown"} 0`,
+		"docker_container_restart_count" + redis + " 2",
+		`docker_container_health_status{name="redis",image="redis:7.0.5",server_type="database",status="healthy"} 1`,
+		`docker_container_health_status{name="redis",image="redis:7.0.5",server_type="database",status="unhealthy"} 0`,
+		"docker_container_cpu_usage_percent" + redis + " 12.5",
+		"docker_container_memory_usage_bytes" + redis + " 1024",
+		"docker_container_memory_limit_bytes" + redis + " 4096",
+		"docker_container_network_transmit_bytes_total" + redis + " 20",
+		"docker_container_blkio_write_bytes_total" + redis + " 40",
+		"docker_images 3",
+		"docker_volumes_size_bytes 50",
+		"docker_exporter_scrape_errors 1",
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("missing line %q in:\n%s", line, body)
+		}
+	}
+	if strings.Contains(body, `docker_container_health_status{name="web"`) {
+		t.Error("containers without health check should not report health status")
+	}
+	if strings.Contains(body, `docker_container_cpu_usage_percent{name="job"`) {
+		t.Error("stopped containers should not report resource usage")
+	}
+}
+
+func TestExporterDaemonDown(t *testing.T) {
+	metrics := New(&fakeSource{err: errors.New("connection refused")}).Collect(context.Background())
+	var b strings.Builder
+	if err := metrics.Encode(&b); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), "docker_up 0\n") || !strings.Contains(b.String(), "docker_exporter_scrape_errors 2\n") {
+		t.Errorf("unexpected output:\n%s", b.String())
+	}
+}
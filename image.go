@@ -7,7 +7,7 @@ package docker
 import (
 	"bytes"
 	"context"
-	"errors"
+	"fmt"
 	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/api/types/image"
 	"github.com/docker/docker/api/types/registry"
@@ -27,7 +27,7 @@ type ImageSummary struct {
 }
 
 func (m *Manager) ListImage(ctx context.Context) ([]ImageSummary, error) {
-	images, err := m.client.ImageList(ctx, image.ListOptions{All: true})
+	images, err := m.listImages(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -38,27 +38,42 @@ func (m *Manager) ListImage(ctx context.Context) ([]ImageSummary, error) {
 			continue
 		}
 		for _, repoTag := range im.RepoTags {
-			tags := strings.Split(repoTag, ":")
-			im := ImageSummary{
-				ID:      im.ID,
-				Name:    tags[0],
-				Tag:     tags[1],
-				Created: time.Unix(im.Created, 0).Format("2006-01-02 15:04:05"),
-				Size:    strconv.FormatFloat(float64(im.Size)/(1000*1000), 'f', 2, 64) + "MB",
-			}
-			imageList = append(imageList, im)
+			imageList = append(imageList, imageSummaryFromTag(im, repoTag))
 		}
 	}
 	return imageList, nil
 }
 
-func (m *Manager) DeleteImage(ctx context.Context, imageID string) error {
-	_, err := m.client.ImageRemove(ctx, imageID, image.RemoveOptions{Force: true})
+// listImages 列出全部镜像, 启用缓存时使用缓存
+func (m *Manager) listImages(ctx context.Context) ([]image.Summary, error) {
+	return m.cache.imageList(ctx, func(ctx context.Context) ([]image.Summary, error) {
+		return m.client.ImageList(ctx, image.ListOptions{All: true})
+	})
+}
+
+// imageSummaryFromTag 一个镜像有多个标签时, 每个标签对应一条 ImageSummary
+func imageSummaryFromTag(im image.Summary, repoTag string) ImageSummary {
+	tags := strings.Split(repoTag, ":")
+	return ImageSummary{
+		ID:      im.ID,
+		Name:    tags[0],
+		Tag:     tags[1],
+		Created: time.Unix(im.Created, 0).Format("2006-01-02 15:04:05"),
+		Size:    strconv.FormatFloat(float64(im.Size)/(1000*1000), 'f', 2, 64) + "MB",
+	}
+}
+
+func (m *Manager) DeleteImage(ctx context.Context, imageID string) (err error) {
+	defer m.invalidate()
+	defer m.audit(ctx, "DeleteImage", auditArgs{"image": imageID}).done(nil, &err)
+	_, err = m.client.ImageRemove(ctx, imageID, image.RemoveOptions{Force: true})
 	return err
 }
 
-func (m *Manager) PruneImages(ctx context.Context) error {
-	_, err := m.client.ImagesPrune(ctx, filters.NewArgs(filters.Arg("dangling", "true")))
+func (m *Manager) PruneImages(ctx context.Context) (err error) {
+	defer m.invalidate()
+	defer m.audit(ctx, "PruneImages", nil).done(nil, &err)
+	_, err = m.client.ImagesPrune(ctx, filters.NewArgs(filters.Arg("dangling", "true")))
 	return err
 }
 
@@ -68,7 +83,9 @@ func (m *Manager) SearchImage(ctx context.Context, imageName string) ([]registry
 	})
 }
 
-func (m *Manager) PullImage(ctx context.Context, imageName string) error {
+func (m *Manager) PullImage(ctx context.Context, imageName string) (err error) {
+	defer m.invalidate()
+	defer m.audit(ctx, "PullImage", auditArgs{"image": imageName}).done(nil, &err)
 	pullReader, err := m.client.ImagePull(ctx, imageName, image.PullOptions{All: false, PrivilegeFunc: nil, RegistryAuth: ""})
 	if err != nil {
 		return err
@@ -87,11 +104,15 @@ func (m *Manager) PullImage(ctx context.Context, imageName string) error {
 	return nil
 }
 
-func (m *Manager) TagImage(ctx context.Context, oldTag, newTag string) error {
+func (m *Manager) TagImage(ctx context.Context, oldTag, newTag string) (err error) {
+	defer m.invalidate()
+	defer m.audit(ctx, "TagImage", auditArgs{"source": oldTag, "target": newTag}).done(nil, &err)
 	return m.client.ImageTag(ctx, oldTag, newTag)
 }
 
-func (m *Manager) ImportImage(ctx context.Context, sourceFile string) error {
+func (m *Manager) ImportImage(ctx context.Context, sourceFile string) (err error) {
+	defer m.invalidate()
+	defer m.audit(ctx, "ImportImage", auditArgs{"file": sourceFile}).done(nil, &err)
 	inputFile, err := os.Open(sourceFile)
 	if err != nil {
 		return err
@@ -152,7 +173,7 @@ func (m *Manager) ExportImage(ctx context.Context, imageIDs []string, targetFile
 }
 
 func (m *Manager) GetImageByName(ctx context.Context, imageName string) (*ImageSummary, error) {
-	images, err := m.client.ImageList(ctx, image.ListOptions{All: true})
+	images, err := m.listImages(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -160,18 +181,12 @@ func (m *Manager) GetImageByName(ctx context.Context, imageName string) (*ImageS
 	for _, v := range images {
 		for _, t := range v.RepoTags {
 			if t == imageName {
-				tagsList := strings.Split(t, ":")
-				return &ImageSummary{
-					ID:      v.ID,
-					Name:    tagsList[0],
-					Tag:     tagsList[1],
-					Created: time.Unix(v.Created, 0).Format("2006-01-02 15:04:05"),
-					Size:    strconv.FormatFloat(float64(v.Size)/(1000*1000), 'f', 2, 64) + "MB",
-				}, nil
+				summary := imageSummaryFromTag(v, t)
+				return &summary, nil
 			}
 		}
 	}
-	return nil, errors.New("not found image")
+	return nil, fmt.Errorf("image %s: %w", imageName, ErrNotFound)
 }
 
 func (m *Manager) GetImageByID(ctx context.Context, imageID string) (*ImageSummary, error) {
@@ -180,12 +195,18 @@ func (m *Manager) GetImageByID(ctx context.Context, imageID string) (*ImageSumma
 		return nil, err
 	}
 
-	tagsList := strings.Split(imageResponse.RepoTags[0], ":")
+	// 未打标签的镜像名称和标签为 <none>
+	name, tag := "<none>", "<none>"
+	if len(imageResponse.RepoTags) > 0 {
+		repoTag := imageResponse.RepoTags[0]
+		idx := strings.LastIndex(repoTag, ":")
+		name, tag = repoTag[:idx], repoTag[idx+1:]
+	}
 
 	return &ImageSummary{
 		ID:      imageResponse.ID,
-		Name:    tagsList[0],
-		Tag:     tagsList[1],
+		Name:    name,
+		Tag:     tag,
 		Created: imageResponse.Created,
 		Size:    strconv.FormatFloat(float64(imageResponse.Size)/(1000*1000), 'f', 2, 64) + "MB",
 	}, nil
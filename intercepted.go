@@ -0,0 +1,487 @@
+// Package docker
+// Date: 2024/08/16 10:26:58
+// Author: Amu
+// Description:
+package docker
+
+import (
+	"context"
+	"io"
+	"io/fs"
+
+	"github.com/docker/docker/api/types/registry"
+)
+
+// interceptedManager 将每个方法调用交给拦截器链, 链的最后一环调用 next
+type interceptedManager struct {
+	next         IManager
+	interceptors []Interceptor
+}
+
+var _ IManager = (*interceptedManager)(nil)
+
+func (m *interceptedManager) invoke(ctx context.Context, operation string, args map[string]any, fn Invoker) error {
+	call := &Call{Operation: operation, Args: args}
+	return chainInvoker(m.interceptors, fn)(ctx, call)
+}
+
+func (m *interceptedManager) invoke0(ctx context.Context, operation string, args map[string]any, fn func(ctx context.Context) error) error {
+	return m.invoke(ctx, operation, args, func(ctx context.Context, _ *Call) error {
+		return fn(ctx)
+	})
+}
+
+// invoke1 调用只有一个返回值的方法; 拦截器没有调用 next 时返回零值
+func invoke1[T any](m *interceptedManager, ctx context.Context, operation string, args map[string]any, fn func(ctx context.Context) (T, error)) (T, error) {
+	var result T
+	err := m.invoke(ctx, operation, args, func(ctx context.Context, call *Call) error {
+		r, err := fn(ctx)
+		result, call.Result = r, r
+		return err
+	})
+	return result, err
+}
+
+func (m *interceptedManager) Version(ctx context.Context) (*Version, error) {
+	return invoke1(m, ctx, "Version", nil, m.next.Version)
+}
+
+func (m *interceptedManager) SystemInfo(ctx context.Context) (*SystemInfo, error) {
+	return invoke1(m, ctx, "SystemInfo", nil, m.next.SystemInfo)
+}
+
+func (m *interceptedManager) DiskUsage(ctx context.Context) (*DiskUsage, error) {
+	return invoke1(m, ctx, "DiskUsage", nil, m.next.DiskUsage)
+}
+
+func (m *interceptedManager) ListContainer(ctx context.Context) ([]ContainerSummary, error) {
+	return invoke1(m, ctx, "ListContainer", nil, m.next.ListContainer)
+}
+
+func (m *interceptedManager) HasSameNameContainer(ctx context.Context, containerName string) (bool, error) {
+	return invoke1(m, ctx, "HasSameNameContainer", map[string]any{"containerName": containerName}, func(ctx context.Context) (bool, error) {
+		return m.next.HasSameNameContainer(ctx, containerName)
+	})
+}
+
+func (m *interceptedManager) CreateContainer(ctx context.Context, containerName, imageName, networkName string, ports, vols, env, commands []string, labels map[string]string) (string, error) {
+	args := map[string]any{
+		"containerName": containerName,
+		"imageName":     imageName,
+		"networkName":   networkName,
+		"ports":         ports,
+		"vols":          vols,
+		"env":           env,
+		"commands":      commands,
+		"labels":        labels,
+	}
+	return invoke1(m, ctx, "CreateContainer", args, func(ctx context.Context) (string, error) {
+		return m.next.CreateContainer(ctx, containerName, imageName, networkName, ports, vols, env, commands, labels)
+	})
+}
+
+func (m *interceptedManager) CreateContainerWithSpec(ctx context.Context, spec ContainerSpec) (string, error) {
+	return invoke1(m, ctx, "CreateContainerWithSpec", map[string]any{"spec": spec}, func(ctx context.Context) (string, error) {
+		return m.next.CreateContainerWithSpec(ctx, spec)
+	})
+}
+
+func (m *interceptedManager) PreparePorts(ctx context.Context, ports []string) ([]PortMapping, error) {
+	return invoke1(m, ctx, "PreparePorts", map[string]any{"ports": ports}, func(ctx context.Context) ([]PortMapping, error) {
+		return m.next.PreparePorts(ctx, ports)
+	})
+}
+
+func (m *interceptedManager) StartContainer(ctx context.Context, containerID string) error {
+	return m.invoke0(ctx, "StartContainer", map[string]any{"containerID": containerID}, func(ctx context.Context) error {
+		return m.next.StartContainer(ctx, containerID)
+	})
+}
+
+func (m *interceptedManager) StopContainer(ctx context.Context, containerID string) error {
+	return m.invoke0(ctx, "StopContainer", map[string]any{"containerID": containerID}, func(ctx context.Context) error {
+		return m.next.StopContainer(ctx, containerID)
+	})
+}
+
+func (m *interceptedManager) RestartContainer(ctx context.Context, containerID string) error {
+	return m.invoke0(ctx, "RestartContainer", map[string]any{"containerID": containerID}, func(ctx context.Context) error {
+		return m.next.RestartContainer(ctx, containerID)
+	})
+}
+
+func (m *interceptedManager) DeleteContainer(ctx context.Context, containerID string) error {
+	return m.invoke0(ctx, "DeleteContainer", map[string]any{"containerID": containerID}, func(ctx context.Context) error {
+		return m.next.DeleteContainer(ctx, containerID)
+	})
+}
+
+func (m *interceptedManager) CopyFileToContainer(ctx context.Context, containerID, srcFile, dstFile string) error {
+	return m.invoke0(ctx, "CopyFileToContainer", map[string]any{"containerID": containerID, "srcFile": srcFile, "dstFile": dstFile}, func(ctx context.Context) error {
+		return m.next.CopyFileToContainer(ctx, containerID, srcFile, dstFile)
+	})
+}
+
+func (m *interceptedManager) CopyToContainer(ctx context.Context, containerID, srcPath, dstPath string, opts CopyOptions) error {
+	args := map[string]any{
+		"containerID": containerID,
+		"srcPath":     srcPath,
+		"dstPath":     dstPath,
+		"opts":        opts,
+	}
+	return m.invoke0(ctx, "CopyToContainer", args, func(ctx context.Context) error {
+		return m.next.CopyToContainer(ctx, containerID, srcPath, dstPath, opts)
+	})
+}
+
+func (m *interceptedManager) CopyReaderToContainer(ctx context.Context, containerID, dstPath string, r io.Reader, opts CopyOptions) error {
+	args := map[string]any{
+		"containerID": containerID,
+		"dstPath":     dstPath,
+		"r":           r,
+		"opts":        opts,
+	}
+	return m.invoke0(ctx, "CopyReaderToContainer", args, func(ctx context.Context) error {
+		return m.next.CopyReaderToContainer(ctx, containerID, dstPath, r, opts)
+	})
+}
+
+func (m *interceptedManager) CopyFSToContainer(ctx context.Context, containerID string, fsys fs.FS, dstDir string, opts CopyOptions) error {
+	args := map[string]any{
+		"containerID": containerID,
+		"fsys":        fsys,
+		"dstDir":      dstDir,
+		"opts":        opts,
+	}
+	return m.invoke0(ctx, "CopyFSToContainer", args, func(ctx context.Context) error {
+		return m.next.CopyFSToContainer(ctx, containerID, fsys, dstDir, opts)
+	})
+}
+
+func (m *interceptedManager) CopyFromContainer(ctx context.Context, containerID, srcPath, dstPath string) error {
+	return m.invoke0(ctx, "CopyFromContainer", map[string]any{"containerID": containerID, "srcPath": srcPath, "dstPath": dstPath}, func(ctx context.Context) error {
+		return m.next.CopyFromContainer(ctx, containerID, srcPath, dstPath)
+	})
+}
+
+func (m *interceptedManager) ReadFileFromContainer(ctx context.Context, containerID, srcPath string) ([]byte, error) {
+	return invoke1(m, ctx, "ReadFileFromContainer", map[string]any{"containerID": containerID, "srcPath": srcPath}, func(ctx context.Context) ([]byte, error) {
+		return m.next.ReadFileFromContainer(ctx, containerID, srcPath)
+	})
+}
+
+func (m *interceptedManager) StatContainerPath(ctx context.Context, containerID, containerPath string) (*ContainerPathStat, error) {
+	return invoke1(m, ctx, "StatContainerPath", map[string]any{"containerID": containerID, "containerPath": containerPath}, func(ctx context.Context) (*ContainerPathStat, error) {
+		return m.next.StatContainerPath(ctx, containerID, containerPath)
+	})
+}
+
+func (m *interceptedManager) GetContainerMem(ctx context.Context, containerID string) (float64, float64, float64, error) {
+	var total, used, percent float64
+	err := m.invoke(ctx, "GetContainerMem", map[string]any{"containerID": containerID}, func(ctx context.Context, call *Call) error {
+		var err error
+		total, used, percent, err = m.next.GetContainerMem(ctx, containerID)
+		call.Result = []any{total, used, percent}
+		return err
+	})
+	return total, used, percent, err
+}
+
+func (m *interceptedManager) GetContainerCpu(ctx context.Context, containerID string) (float64, error) {
+	return invoke1(m, ctx, "GetContainerCpu", map[string]any{"containerID": containerID}, func(ctx context.Context) (float64, error) {
+		return m.next.GetContainerCpu(ctx, containerID)
+	})
+}
+
+func (m *interceptedManager) GetContainerStats(ctx context.Context, containerID string) (*ContainerStats, error) {
+	return invoke1(m, ctx, "GetContainerStats", map[string]any{"containerID": containerID}, func(ctx context.Context) (*ContainerStats, error) {
+		return m.next.GetContainerStats(ctx, containerID)
+	})
+}
+
+func (m *interceptedManager) GetContainerStatus(ctx context.Context, containerID string) (*ContainerStatus, error) {
+	return invoke1(m, ctx, "GetContainerStatus", map[string]any{"containerID": containerID}, func(ctx context.Context) (*ContainerStatus, error) {
+		return m.next.GetContainerStatus(ctx, containerID)
+	})
+}
+
+func (m *interceptedManager) StreamContainerStats(ctx context.Context, containerID string, fn func(*ContainerStats) error) error {
+	return m.invoke0(ctx, "StreamContainerStats", map[string]any{"containerID": containerID, "fn": fn}, func(ctx context.Context) error {
+		return m.next.StreamContainerStats(ctx, containerID, fn)
+	})
+}
+
+func (m *interceptedManager) ListContainerStatus(ctx context.Context) ([]ContainerStatus, error) {
+	return invoke1(m, ctx, "ListContainerStatus", nil, m.next.ListContainerStatus)
+}
+
+func (m *interceptedManager) GetContainerIDByContainerName(ctx context.Context, containerName string) (string, error) {
+	return invoke1(m, ctx, "GetContainerIDByContainerName", map[string]any{"containerName": containerName}, func(ctx context.Context) (string, error) {
+		return m.next.GetContainerIDByContainerName(ctx, containerName)
+	})
+}
+
+func (m *interceptedManager) ResolveContainer(ctx context.Context, containerIDOrName string) (string, error) {
+	return invoke1(m, ctx, "ResolveContainer", map[string]any{"containerIDOrName": containerIDOrName}, func(ctx context.Context) (string, error) {
+		return m.next.ResolveContainer(ctx, containerIDOrName)
+	})
+}
+
+func (m *interceptedManager) ContainerExists(ctx context.Context, containerID string) (bool, error) {
+	return invoke1(m, ctx, "ContainerExists", map[string]any{"containerID": containerID}, func(ctx context.Context) (bool, error) {
+		return m.next.ContainerExists(ctx, containerID)
+	})
+}
+
+func (m *interceptedManager) Reconcile(ctx context.Context, desired []ContainerSpec, opts ReconcileOptions) (*ReconcilePlan, error) {
+	return invoke1(m, ctx, "Reconcile", map[string]any{"desired": desired, "opts": opts}, func(ctx context.Context) (*ReconcilePlan, error) {
+		return m.next.Reconcile(ctx, desired, opts)
+	})
+}
+
+func (m *interceptedManager) UpgradeContainer(ctx context.Context, containerID, newImage string) (string, error) {
+	return invoke1(m, ctx, "UpgradeContainer", map[string]any{"containerID": containerID, "newImage": newImage}, func(ctx context.Context) (string, error) {
+		return m.next.UpgradeContainer(ctx, containerID, newImage)
+	})
+}
+
+func (m *interceptedManager) UpgradeContainerWithOptions(ctx context.Context, containerID, newImage string, opts UpgradeOptions) (string, error) {
+	return invoke1(m, ctx, "UpgradeContainerWithOptions", map[string]any{"containerID": containerID, "newImage": newImage, "opts": opts}, func(ctx context.Context) (string, error) {
+		return m.next.UpgradeContainerWithOptions(ctx, containerID, newImage, opts)
+	})
+}
+
+func (m *interceptedManager) CloneContainer(ctx context.Context, containerID, newName string, overrides CloneOverrides) (string, error) {
+	return invoke1(m, ctx, "CloneContainer", map[string]any{"containerID": containerID, "newName": newName, "overrides": overrides}, func(ctx context.Context) (string, error) {
+		return m.next.CloneContainer(ctx, containerID, newName, overrides)
+	})
+}
+
+func (m *interceptedManager) ContainerToSpec(ctx context.Context, containerID string) (*ContainerSpec, error) {
+	return invoke1(m, ctx, "ContainerToSpec", map[string]any{"containerID": containerID}, func(ctx context.Context) (*ContainerSpec, error) {
+		return m.next.ContainerToSpec(ctx, containerID)
+	})
+}
+
+func (m *interceptedManager) GenerateCompose(ctx context.Context, containerIDs []string) ([]byte, error) {
+	return invoke1(m, ctx, "GenerateCompose", map[string]any{"containerIDs": containerIDs}, func(ctx context.Context) ([]byte, error) {
+		return m.next.GenerateCompose(ctx, containerIDs)
+	})
+}
+
+func (m *interceptedManager) ContainerLogs(ctx context.Context, containerID string) (io.ReadCloser, error) {
+	return invoke1(m, ctx, "ContainerLogs", map[string]any{"containerID": containerID}, func(ctx context.Context) (io.ReadCloser, error) {
+		return m.next.ContainerLogs(ctx, containerID)
+	})
+}
+
+func (m *interceptedManager) ContainerLogsWithOptions(ctx context.Context, containerID string, opts LogsOptions) (io.ReadCloser, error) {
+	return invoke1(m, ctx, "ContainerLogsWithOptions", map[string]any{"containerID": containerID, "opts": opts}, func(ctx context.Context) (io.ReadCloser, error) {
+		return m.next.ContainerLogsWithOptions(ctx, containerID, opts)
+	})
+}
+
+func (m *interceptedManager) RenameContainer(ctx context.Context, containerID, newName string) error {
+	return m.invoke0(ctx, "RenameContainer", map[string]any{"containerID": containerID, "newName": newName}, func(ctx context.Context) error {
+		return m.next.RenameContainer(ctx, containerID, newName)
+	})
+}
+
+func (m *interceptedManager) CommitContainer(ctx context.Context, containerID string, opts CommitOptions) (string, error) {
+	return invoke1(m, ctx, "CommitContainer", map[string]any{"containerID": containerID, "opts": opts}, func(ctx context.Context) (string, error) {
+		return m.next.CommitContainer(ctx, containerID, opts)
+	})
+}
+
+func (m *interceptedManager) ExportContainer(ctx context.Context, containerID, targetFile string) error {
+	return m.invoke0(ctx, "ExportContainer", map[string]any{"containerID": containerID, "targetFile": targetFile}, func(ctx context.Context) error {
+		return m.next.ExportContainer(ctx, containerID, targetFile)
+	})
+}
+
+func (m *interceptedManager) ContainerChanges(ctx context.Context, containerID string) ([]ContainerChange, error) {
+	return invoke1(m, ctx, "ContainerChanges", map[string]any{"containerID": containerID}, func(ctx context.Context) ([]ContainerChange, error) {
+		return m.next.ContainerChanges(ctx, containerID)
+	})
+}
+
+func (m *interceptedManager) ContainerProcesses(ctx context.Context, containerID, psArgs string) ([]ContainerProcess, error) {
+	return invoke1(m, ctx, "ContainerProcesses", map[string]any{"containerID": containerID, "psArgs": psArgs}, func(ctx context.Context) ([]ContainerProcess, error) {
+		return m.next.ContainerProcesses(ctx, containerID, psArgs)
+	})
+}
+
+func (m *interceptedManager) AttachContainer(ctx context.Context, containerID string, opts AttachOptions) (*AttachStream, error) {
+	return invoke1(m, ctx, "AttachContainer", map[string]any{"containerID": containerID, "opts": opts}, func(ctx context.Context) (*AttachStream, error) {
+		return m.next.AttachContainer(ctx, containerID, opts)
+	})
+}
+
+func (m *interceptedManager) ResizeContainerTTY(ctx context.Context, containerID string, height, width uint) error {
+	return m.invoke0(ctx, "ResizeContainerTTY", map[string]any{"containerID": containerID, "height": height, "width": width}, func(ctx context.Context) error {
+		return m.next.ResizeContainerTTY(ctx, containerID, height, width)
+	})
+}
+
+func (m *interceptedManager) ExecContainer(ctx context.Context, containerID string, opts ExecOptions) (*ExecSession, error) {
+	return invoke1(m, ctx, "ExecContainer", map[string]any{"containerID": containerID, "opts": opts}, func(ctx context.Context) (*ExecSession, error) {
+		return m.next.ExecContainer(ctx, containerID, opts)
+	})
+}
+
+func (m *interceptedManager) ResizeExecTTY(ctx context.Context, execID string, height, width uint) error {
+	return m.invoke0(ctx, "ResizeExecTTY", map[string]any{"execID": execID, "height": height, "width": width}, func(ctx context.Context) error {
+		return m.next.ResizeExecTTY(ctx, execID, height, width)
+	})
+}
+
+func (m *interceptedManager) InspectExec(ctx context.Context, execID string) (*ExecStatus, error) {
+	return invoke1(m, ctx, "InspectExec", map[string]any{"execID": execID}, func(ctx context.Context) (*ExecStatus, error) {
+		return m.next.InspectExec(ctx, execID)
+	})
+}
+
+func (m *interceptedManager) ListImage(ctx context.Context) ([]ImageSummary, error) {
+	return invoke1(m, ctx, "ListImage", nil, m.next.ListImage)
+}
+
+func (m *interceptedManager) DeleteImage(ctx context.Context, imageID string) error {
+	return m.invoke0(ctx, "DeleteImage", map[string]any{"imageID": imageID}, func(ctx context.Context) error {
+		return m.next.DeleteImage(ctx, imageID)
+	})
+}
+
+func (m *interceptedManager) PruneImages(ctx context.Context) error {
+	return m.invoke0(ctx, "PruneImages", nil, func(ctx context.Context) error {
+		return m.next.PruneImages(ctx)
+	})
+}
+
+func (m *interceptedManager) SearchImage(ctx context.Context, imageName string) ([]registry.SearchResult, error) {
+	return invoke1(m, ctx, "SearchImage", map[string]any{"imageName": imageName}, func(ctx context.Context) ([]registry.SearchResult, error) {
+		return m.next.SearchImage(ctx, imageName)
+	})
+}
+
+func (m *interceptedManager) PullImage(ctx context.Context, imageName string) error {
+	return m.invoke0(ctx, "PullImage", map[string]any{"imageName": imageName}, func(ctx context.Context) error {
+		return m.next.PullImage(ctx, imageName)
+	})
+}
+
+func (m *interceptedManager) TagImage(ctx context.Context, oldTag, newTag string) error {
+	return m.invoke0(ctx, "TagImage", map[string]any{"oldTag": oldTag, "newTag": newTag}, func(ctx context.Context) error {
+		return m.next.TagImage(ctx, oldTag, newTag)
+	})
+}
+
+func (m *interceptedManager) ImportImage(ctx context.Context, sourceFile string) error {
+	return m.invoke0(ctx, "ImportImage", map[string]any{"sourceFile": sourceFile}, func(ctx context.Context) error {
+		return m.next.ImportImage(ctx, sourceFile)
+	})
+}
+
+func (m *interceptedManager) ExportImage(ctx context.Context, imageIDs []string, targetFile string) error {
+	return m.invoke0(ctx, "ExportImage", map[string]any{"imageIDs": imageIDs, "targetFile": targetFile}, func(ctx context.Context) error {
+		return m.next.ExportImage(ctx, imageIDs, targetFile)
+	})
+}
+
+func (m *interceptedManager) GetImageByName(ctx context.Context, imageName string) (*ImageSummary, error) {
+	return invoke1(m, ctx, "GetImageByName", map[string]any{"imageName": imageName}, func(ctx context.Context) (*ImageSummary, error) {
+		return m.next.GetImageByName(ctx, imageName)
+	})
+}
+
+func (m *interceptedManager) GetImageByID(ctx context.Context, imageID string) (*ImageSummary, error) {
+	return invoke1(m, ctx, "GetImageByID", map[string]any{"imageID": imageID}, func(ctx context.Context) (*ImageSummary, error) {
+		return m.next.GetImageByID(ctx, imageID)
+	})
+}
+
+func (m *interceptedManager) ListNetwork(ctx context.Context) ([]NetworkSummary, error) {
+	return invoke1(m, ctx, "ListNetwork", nil, m.next.ListNetwork)
+}
+
+func (m *interceptedManager) HasSameNameNetwork(ctx context.Context, networkName string) (bool, error) {
+	return invoke1(m, ctx, "HasSameNameNetwork", map[string]any{"networkName": networkName}, func(ctx context.Context) (bool, error) {
+		return m.next.HasSameNameNetwork(ctx, networkName)
+	})
+}
+
+func (m *interceptedManager) CreateNetwork(ctx context.Context, name, driver, subnet, gateway string, labels map[string]string) (string, error) {
+	args := map[string]any{
+		"name":    name,
+		"driver":  driver,
+		"subnet":  subnet,
+		"gateway": gateway,
+		"labels":  labels,
+	}
+	return invoke1(m, ctx, "CreateNetwork", args, func(ctx context.Context) (string, error) {
+		return m.next.CreateNetwork(ctx, name, driver, subnet, gateway, labels)
+	})
+}
+
+func (m *interceptedManager) CreateNetworkWithSpec(ctx context.Context, spec NetworkSpec) (string, error) {
+	return invoke1(m, ctx, "CreateNetworkWithSpec", map[string]any{"spec": spec}, func(ctx context.Context) (string, error) {
+		return m.next.CreateNetworkWithSpec(ctx, spec)
+	})
+}
+
+func (m *interceptedManager) NextFreeSubnet(ctx context.Context, prefixLen int) (string, error) {
+	return invoke1(m, ctx, "NextFreeSubnet", map[string]any{"prefixLen": prefixLen}, func(ctx context.Context) (string, error) {
+		return m.next.NextFreeSubnet(ctx, prefixLen)
+	})
+}
+
+func (m *interceptedManager) GetNetworkByID(ctx context.Context, networkID string) (*NetworkSummary, error) {
+	return invoke1(m, ctx, "GetNetworkByID", map[string]any{"networkID": networkID}, func(ctx context.Context) (*NetworkSummary, error) {
+		return m.next.GetNetworkByID(ctx, networkID)
+	})
+}
+
+func (m *interceptedManager) DeleteNetwork(ctx context.Context, networkID string) error {
+	return m.invoke0(ctx, "DeleteNetwork", map[string]any{"networkID": networkID}, func(ctx context.Context) error {
+		return m.next.DeleteNetwork(ctx, networkID)
+	})
+}
+
+func (m *interceptedManager) DeleteNetworkWithOptions(ctx context.Context, networkID string, opts DeleteNetworkOptions) error {
+	return m.invoke0(ctx, "DeleteNetworkWithOptions", map[string]any{"networkID": networkID, "opts": opts}, func(ctx context.Context) error {
+		return m.next.DeleteNetworkWithOptions(ctx, networkID, opts)
+	})
+}
+
+func (m *interceptedManager) PruneNetwork(ctx context.Context) error {
+	return m.invoke0(ctx, "PruneNetwork", nil, func(ctx context.Context) error {
+		return m.next.PruneNetwork(ctx)
+	})
+}
+
+func (m *interceptedManager) PruneNetworkWithOptions(ctx context.Context, opts PruneNetworkOptions) ([]string, error) {
+	return invoke1(m, ctx, "PruneNetworkWithOptions", map[string]any{"opts": opts}, func(ctx context.Context) ([]string, error) {
+		return m.next.PruneNetworkWithOptions(ctx, opts)
+	})
+}
+
+func (m *interceptedManager) JoinNetwork(ctx context.Context, containerID, networkID string) error {
+	return m.invoke0(ctx, "JoinNetwork", map[string]any{"containerID": containerID, "networkID": networkID}, func(ctx context.Context) error {
+		return m.next.JoinNetwork(ctx, containerID, networkID)
+	})
+}
+
+func (m *interceptedManager) JoinNetworkWithOptions(ctx context.Context, containerID, networkID string, opts EndpointOptions) error {
+	return m.invoke0(ctx, "JoinNetworkWithOptions", map[string]any{"containerID": containerID, "networkID": networkID, "opts": opts}, func(ctx context.Context) error {
+		return m.next.JoinNetworkWithOptions(ctx, containerID, networkID, opts)
+	})
+}
+
+func (m *interceptedManager) LeaveNetwork(ctx context.Context, containerID, networkID string) error {
+	return m.invoke0(ctx, "LeaveNetwork", map[string]any{"containerID": containerID, "networkID": networkID}, func(ctx context.Context) error {
+		return m.next.LeaveNetwork(ctx, containerID, networkID)
+	})
+}
+
+func (m *interceptedManager) Topology(ctx context.Context) (*Topology, error) {
+	return invoke1(m, ctx, "Topology", nil, m.next.Topology)
+}
@@ -0,0 +1,129 @@
+// Package docker
+// Date: 2024/08/16 09:47:21
+// Author: Amu
+// Description:
+package docker
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Call 一次经过拦截器链的 IManager 方法调用
+type Call struct {
+	Operation string         // 方法名, 如 StartContainer
+	Args      map[string]any // 参数, 键为参数名, 不含 ctx
+	Result    any            // 返回值, 调用结束后设置; 多个返回值时为 []any, 没有返回值时为 nil
+}
+
+// Invoker 执行调用链的下一环, 最后一环调用被装饰的 IManager
+type Invoker func(ctx context.Context, call *Call) error
+
+// Interceptor 拦截一次调用, 可以在 next 前后添加逻辑、多次调用 next 或不调用 next 直接返回错误
+type Interceptor func(ctx context.Context, call *Call, next Invoker) error
+
+// Chain 将多个拦截器组合为一个, 按参数顺序由外向内执行
+func Chain(interceptors ...Interceptor) Interceptor {
+	return func(ctx context.Context, call *Call, next Invoker) error {
+		return chainInvoker(interceptors, next)(ctx, call)
+	}
+}
+
+func chainInvoker(interceptors []Interceptor, last Invoker) Invoker {
+	invoker := last
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], invoker
+		invoker = func(ctx context.Context, call *Call) error {
+			return interceptor(ctx, call, next)
+		}
+	}
+	return invoker
+}
+
+// Intercept 返回一个 IManager, 其每个方法调用都依次经过 interceptors 后再调用 m
+func Intercept(m IManager, interceptors ...Interceptor) IManager {
+	return &interceptedManager{next: m, interceptors: interceptors}
+}
+
+// LoggingInterceptor 以 Debug 级别记录成功的调用, 以 Error 级别记录失败的调用; logger 为 nil 时使用 slog.Default()。
+// 参数中可能含有敏感信息, 因此不记录参数和返回值
+func LoggingInterceptor(logger *slog.Logger) Interceptor {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return func(ctx context.Context, call *Call, next Invoker) error {
+		start := time.Now()
+		err := next(ctx, call)
+		if err != nil {
+			logger.ErrorContext(ctx, "docker call failed", "operation", call.Operation, "duration", time.Since(start), "error", err)
+		} else {
+			logger.DebugContext(ctx, "docker call", "operation", call.Operation, "duration", time.Since(start))
+		}
+		return err
+	}
+}
+
+// TimingInterceptor 在每次调用结束后以方法名、耗时和错误调用 observe, 用于对接指标系统
+func TimingInterceptor(observe func(operation string, duration time.Duration, err error)) Interceptor {
+	return func(ctx context.Context, call *Call, next Invoker) error {
+		start := time.Now()
+		err := next(ctx, call)
+		observe(call.Operation, time.Since(start), err)
+		return err
+	}
+}
+
+// longRunningOperations 返回流或传输数据、等待容器就绪的操作, 耗时取决于数据量或调用方读取的时间
+var longRunningOperations = map[string]bool{
+	"AttachContainer": true, "ExecContainer": true, "ContainerLogs": true, "ContainerLogsWithOptions": true,
+	"StreamContainerStats": true, "PullImage": true, "ImportImage": true, "ExportImage": true, "ExportContainer": true,
+	"CopyToContainer": true, "CopyFileToContainer": true, "CopyReaderToContainer": true, "CopyFSToContainer": true,
+	"CopyFromContainer": true, "UpgradeContainer": true, "UpgradeContainerWithOptions": true, "Reconcile": true,
+}
+
+// TimeoutInterceptor 为每次调用设置 timeout 的超时时间。返回流的操作(如 ContainerLogs、StreamContainerStats)
+// 以及传输数据、等待容器就绪的操作(如 PullImage、CopyToContainer、UpgradeContainer)不设置超时, 由调用方的 ctx 控制
+func TimeoutInterceptor(timeout time.Duration) Interceptor {
+	return func(ctx context.Context, call *Call, next Invoker) error {
+		if timeout <= 0 || longRunningOperations[call.Operation] {
+			return next(ctx, call)
+		}
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		return next(ctx, call)
+	}
+}
+
+// tracerName OpenTelemetry instrumentation 的名称
+const tracerName = "github.com/amuluze/docker"
+
+// TracingInterceptor 为每次调用创建一个名为 docker.<方法名> 的 span, 字符串类型的参数作为 span 属性
+// (环境变量等切片和结构体参数可能含有敏感信息, 不作为属性); tracer 为 nil 时使用全局 TracerProvider
+func TracingInterceptor(tracer trace.Tracer) Interceptor {
+	if tracer == nil {
+		tracer = otel.Tracer(tracerName)
+	}
+	return func(ctx context.Context, call *Call, next Invoker) error {
+		attrs := []attribute.KeyValue{attribute.String("docker.operation", call.Operation)}
+		for name, value := range call.Args {
+			if v, ok := value.(string); ok {
+				attrs = append(attrs, attribute.String("docker.args."+name, v))
+			}
+		}
+		ctx, span := tracer.Start(ctx, "docker."+call.Operation, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+		defer span.End()
+
+		err := next(ctx, call)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		return err
+	}
+}
@@ -0,0 +1,179 @@
+// Package docker
+// Date: 2024/08/16 11:15:40
+// Author: Amu
+// Description:
+package docker
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// stubManager 只实现测试用到的方法, 其余方法调用时会 panic
+type stubManager struct {
+	IManager
+	started []string
+	err     error
+}
+
+func (s *stubManager) StartContainer(_ context.Context, containerID string) error {
+	s.started = append(s.started, containerID)
+	return s.err
+}
+
+func (s *stubManager) ResolveContainer(_ context.Context, ref string) (string, error) {
+	return "id-" + ref, s.err
+}
+
+func (s *stubManager) GetContainerMem(context.Context, string) (float64, float64, float64, error) {
+	return 1024, 512, 50, nil
+}
+
+func TestInterceptorChain(t *testing.T) {
+	var order []string
+	record := func(name string) Interceptor {
+		return func(ctx context.Context, call *Call, next Invoker) error {
+			order = append(order, name+" before "+call.Operation)
+			err := next(ctx, call)
+			order = append(order, name+" after "+call.Operation)
+			return err
+		}
+	}
+	var calls []Call
+	capture := func(ctx context.Context, call *Call, next Invoker) error {
+		err := next(ctx, call)
+		calls = append(calls, *call)
+		return err
+	}
+	stub := &stubManager{}
+	m := Intercept(stub, Chain(record("a"), record("b")), capture)
+
+	id, err := m.ResolveContainer(context.Background(), "redis")
+	if err != nil || id != "id-redis" {
+		t.Fatalf("id = %q, err = %v", id, err)
+	}
+	want := []string{"a before ResolveContainer", "b before ResolveContainer", "b after ResolveContainer", "a after ResolveContainer"}
+	if !reflect.DeepEqual(order, want) {
+		t.Errorf("order = %v", order)
+	}
+	if _, _, percent, _ := m.GetContainerMem(context.Background(), "redis"); percent != 50 {
+		t.Errorf("percent = %v", percent)
+	}
+
+	wantCalls := []Call{
+		{Operation: "ResolveContainer", Args: map[string]any{"containerIDOrName": "redis"}, Result: "id-redis"},
+		{Operation: "GetContainerMem", Args: map[string]any{"containerID": "redis"}, Result: []any{1024.0, 512.0, 50.0}},
+	}
+	if !reflect.DeepEqual(calls, wantCalls) {
+		t.Errorf("calls = %+v", calls)
+	}
+}
+
+func TestInterceptorShortCircuit(t *testing.T) {
+	denied := errors.New("permission denied")
+	authorize := func(ctx context.Context, call *Call, next Invoker) error {
+		if CallerFromContext(ctx) != "admin" {
+			return denied
+		}
+		return next(ctx, call)
+	}
+	stub := &stubManager{}
+	m := Intercept(stub, authorize)
+
+	if _, err := m.ResolveContainer(context.Background(), "redis"); !errors.Is(err, denied) {
+		t.Errorf("err = %v", err)
+	}
+	if err := m.StartContainer(context.Background(), "redis"); !errors.Is(err, denied) {
+		t.Errorf("err = %v", err)
+	}
+	if err := m.StartContainer(WithCaller(context.Background(), "admin"), "redis"); err != nil {
+		t.Errorf("err = %v", err)
+	}
+	if !reflect.DeepEqual(stub.started, []string{"redis"}) {
+		t.Errorf("started = %v", stub.started)
+	}
+}
+
+func TestTimingAndLoggingInterceptors(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	var observed []string
+	timing := TimingInterceptor(func(operation string, duration time.Duration, err error) {
+		observed = append(observed, operation)
+		if duration <= 0 {
+			t.Errorf("duration = %v", duration)
+		}
+	})
+	stub := &stubManager{}
+	m := Intercept(stub, LoggingInterceptor(logger), timing)
+
+	_ = m.StartContainer(context.Background(), "redis")
+	stub.err = errors.New("daemon unavailable")
+	_ = m.StartContainer(context.Background(), "nginx")
+
+	if !reflect.DeepEqual(observed, []string{"StartContainer", "StartContainer"}) {
+		t.Errorf("observed = %v", observed)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], "level=DEBUG") || !strings.Contains(lines[1], "level=ERROR") ||
+		!strings.Contains(lines[1], `error="daemon unavailable"`) {
+		t.Errorf("log:\n%s", buf.String())
+	}
+	if strings.Contains(buf.String(), "nginx") {
+		t.Errorf("arguments should not be logged:\n%s", buf.String())
+	}
+}
+
+func TestTimeoutInterceptor(t *testing.T) {
+	deadlines := make(map[string]bool)
+	capture := func(ctx context.Context, call *Call, next Invoker) error {
+		_, deadlines[call.Operation] = ctx.Deadline()
+		return nil
+	}
+	m := Intercept(&stubManager{}, TimeoutInterceptor(time.Minute), capture)
+	ctx := context.Background()
+
+	_ = m.StartContainer(ctx, "redis")
+	_, _ = m.ContainerLogs(ctx, "redis")
+	_ = m.StreamContainerStats(ctx, "redis", func(*ContainerStats) error { return nil })
+	// 返回流的操作不设置超时, 否则读取会在超时后中断
+	if want := map[string]bool{"StartContainer": true, "ContainerLogs": false, "StreamContainerStats": false}; !reflect.DeepEqual(deadlines, want) {
+		t.Errorf("deadlines = %v, want %v", deadlines, want)
+	}
+}
+
+func TestTracingInterceptor(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	stub := &stubManager{err: errors.New("no such container")}
+	m := Intercept(stub, TracingInterceptor(provider.Tracer("test")))
+
+	_ = m.StartContainer(context.Background(), "redis")
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("spans = %d", len(spans))
+	}
+	span := spans[0]
+	if span.Name() != "docker.StartContainer" || span.Status().Code != codes.Error {
+		t.Errorf("span = %s, status = %+v", span.Name(), span.Status())
+	}
+	attrs := attribute.NewSet(span.Attributes()...)
+	if v, _ := attrs.Value("docker.args.containerID"); v.AsString() != "redis" {
+		t.Errorf("attributes = %v", span.Attributes())
+	}
+	if len(span.Events()) != 1 || span.Events()[0].Name != "exception" {
+		t.Errorf("events = %v", span.Events())
+	}
+}
@@ -8,37 +8,105 @@ import (
 	"context"
 	"github.com/docker/docker/api/types/registry"
 	"io"
+	"io/fs"
 
 	"github.com/docker/docker/client"
 )
 
 type Manager struct {
-	client *client.Client
+	client          *client.Client
+	subnetAllocator *SubnetAllocator
+	portAllocator   *PortAllocator
+	auditSinks      []AuditSink
+	clientOpts      []client.Opt
+	cache           *resourceCache
 }
 
-func NewManager() (*Manager, error) {
-	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
-	return &Manager{client: cli}, err
+type Option func(*Manager)
+
+// WithSubnetAllocator 设置创建 bridge 网络未指定子网时使用的分配器, 默认为 nil, 即由 daemon 自行分配
+func WithSubnetAllocator(allocator *SubnetAllocator) Option {
+	return func(m *Manager) {
+		m.subnetAllocator = allocator
+	}
+}
+
+// WithPortAllocator 设置宿主机端口冲突检查和 auto 端口分配, 默认为 nil, 即不做检查。
+// CheckHost 在本进程的网络命名空间中试探端口, 本进程运行在容器中时应设为 false
+func WithPortAllocator(allocator *PortAllocator) Option {
+	return func(m *Manager) {
+		m.portAllocator = allocator
+	}
+}
+
+// WithClientOptions 设置连接 daemon 的参数, 如 client.WithHost, 在环境变量 DOCKER_HOST 等之后生效
+func WithClientOptions(opts ...client.Opt) Option {
+	return func(m *Manager) {
+		m.clientOpts = append(m.clientOpts, opts...)
+	}
+}
+
+func NewManager(opts ...Option) (*Manager, error) {
+	m := &Manager{}
+	for _, opt := range opts {
+		opt(m)
+	}
+	clientOpts := append([]client.Opt{client.FromEnv, client.WithAPIVersionNegotiation()}, m.clientOpts...)
+	cli, err := client.NewClientWithOpts(clientOpts...)
+	m.client = cli
+	return m, err
 }
 
 var _ IManager = (*Manager)(nil)
 
 type IManager interface {
 	Version(context.Context) (*Version, error)
+	SystemInfo(ctx context.Context) (*SystemInfo, error)
+	DiskUsage(ctx context.Context) (*DiskUsage, error)
 
 	ListContainer(ctx context.Context) ([]ContainerSummary, error)
 	HasSameNameContainer(ctx context.Context, containerName string) (bool, error)
 	CreateContainer(ctx context.Context, containerName, imageName, networkName string, ports []string, vols []string, env []string, commands []string, labels map[string]string) (string, error)
+	CreateContainerWithSpec(ctx context.Context, spec ContainerSpec) (string, error)
+	PreparePorts(ctx context.Context, ports []string) ([]PortMapping, error)
 	StartContainer(ctx context.Context, containerID string) error
 	StopContainer(ctx context.Context, containerID string) error
 	RestartContainer(ctx context.Context, containerID string) error
 	DeleteContainer(ctx context.Context, containerID string) error
 	CopyFileToContainer(ctx context.Context, containerID string, srcFile, dstFile string) error
+	CopyToContainer(ctx context.Context, containerID, srcPath, dstPath string, opts CopyOptions) error
+	CopyReaderToContainer(ctx context.Context, containerID, dstPath string, r io.Reader, opts CopyOptions) error
+	CopyFSToContainer(ctx context.Context, containerID string, fsys fs.FS, dstDir string, opts CopyOptions) error
+	CopyFromContainer(ctx context.Context, containerID, srcPath, dstPath string) error
+	ReadFileFromContainer(ctx context.Context, containerID, srcPath string) ([]byte, error)
+	StatContainerPath(ctx context.Context, containerID, containerPath string) (*ContainerPathStat, error)
 	GetContainerMem(ctx context.Context, containerID string) (float64, float64, float64, error)
 	GetContainerCpu(ctx context.Context, containerID string) (float64, error)
+	GetContainerStats(ctx context.Context, containerID string) (*ContainerStats, error)
+	GetContainerStatus(ctx context.Context, containerID string) (*ContainerStatus, error)
+	StreamContainerStats(ctx context.Context, containerID string, fn func(*ContainerStats) error) error
+	ListContainerStatus(ctx context.Context) ([]ContainerStatus, error)
 	GetContainerIDByContainerName(ctx context.Context, containerName string) (string, error)
+	ResolveContainer(ctx context.Context, containerIDOrName string) (string, error)
+	ContainerExists(ctx context.Context, containerID string) (bool, error)
+	Reconcile(ctx context.Context, desired []ContainerSpec, opts ReconcileOptions) (*ReconcilePlan, error)
+	UpgradeContainer(ctx context.Context, containerID, newImage string) (string, error)
+	UpgradeContainerWithOptions(ctx context.Context, containerID, newImage string, opts UpgradeOptions) (string, error)
+	CloneContainer(ctx context.Context, containerID, newName string, overrides CloneOverrides) (string, error)
+	ContainerToSpec(ctx context.Context, containerID string) (*ContainerSpec, error)
+	GenerateCompose(ctx context.Context, containerIDs []string) ([]byte, error)
 	ContainerLogs(ctx context.Context, containerID string) (io.ReadCloser, error)
+	ContainerLogsWithOptions(ctx context.Context, containerID string, opts LogsOptions) (io.ReadCloser, error)
 	RenameContainer(ctx context.Context, containerID, newName string) error
+	CommitContainer(ctx context.Context, containerID string, opts CommitOptions) (string, error)
+	ExportContainer(ctx context.Context, containerID string, targetFile string) error
+	ContainerChanges(ctx context.Context, containerID string) ([]ContainerChange, error)
+	ContainerProcesses(ctx context.Context, containerID string, psArgs string) ([]ContainerProcess, error)
+	AttachContainer(ctx context.Context, containerID string, opts AttachOptions) (*AttachStream, error)
+	ResizeContainerTTY(ctx context.Context, containerID string, height, width uint) error
+	ExecContainer(ctx context.Context, containerID string, opts ExecOptions) (*ExecSession, error)
+	ResizeExecTTY(ctx context.Context, execID string, height, width uint) error
+	InspectExec(ctx context.Context, execID string) (*ExecStatus, error)
 
 	ListImage(ctx context.Context) ([]ImageSummary, error)
 	DeleteImage(ctx context.Context, imageID string) error
@@ -54,9 +122,15 @@ type IManager interface {
 	ListNetwork(ctx context.Context) ([]NetworkSummary, error)
 	HasSameNameNetwork(ctx context.Context, networkName string) (bool, error)
 	CreateNetwork(ctx context.Context, name, driver, subnet, gateway string, labels map[string]string) (string, error)
+	CreateNetworkWithSpec(ctx context.Context, spec NetworkSpec) (string, error)
+	NextFreeSubnet(ctx context.Context, prefixLen int) (string, error)
 	GetNetworkByID(ctx context.Context, networkID string) (*NetworkSummary, error)
 	DeleteNetwork(ctx context.Context, networkID string) error
+	DeleteNetworkWithOptions(ctx context.Context, networkID string, opts DeleteNetworkOptions) error
 	PruneNetwork(ctx context.Context) error
+	PruneNetworkWithOptions(ctx context.Context, opts PruneNetworkOptions) ([]string, error)
 	JoinNetwork(ctx context.Context, containerID, networkID string) error
+	JoinNetworkWithOptions(ctx context.Context, containerID, networkID string, opts EndpointOptions) error
 	LeaveNetwork(ctx context.Context, containerID, networkID string) error
+	Topology(ctx context.Context) (*Topology, error)
 }
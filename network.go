@@ -6,10 +6,22 @@ package docker
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/api/types/network"
+	"net"
+	"net/netip"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
+)
+
+const (
+	bridgeNameOption = "com.docker.network.bridge.name"
+	bridgeICCOption  = "com.docker.network.bridge.enable_icc"
+	driverMTUOption  = "com.docker.network.driver.mtu"
 )
 
 type NetworkSummary struct {
@@ -27,9 +39,41 @@ type NetworkSummary struct {
 type SubNetworkConfig struct {
 	Subnet  string
 	Gateway string
+	IPRange string
+}
+
+// NetworkSpec 创建网络的完整参数
+type NetworkSpec struct {
+	Name          string            `json:"name"`
+	Driver        string            `json:"driver"`       // 为空时使用 bridge
+	Pools         []IPAMPool        `json:"pools"`        // IPv4 与 IPv6 地址池, 设置了 WithSubnetAllocator 时为空地址池或没有地址池的 bridge 网络分配子网
+	PrefixLen     int               `json:"prefix_len"`   // 自动分配子网的掩码长度, 为 0 时使用分配器的默认值
+	IPAMDriver    string            `json:"ipam_driver"`  // 为空时使用 default
+	IPAMOptions   map[string]string `json:"ipam_options"` // IPAM 驱动参数
+	EnableIPv6    bool              `json:"enable_ipv6"`
+	Internal      bool              `json:"internal"`
+	Attachable    bool              `json:"attachable"`
+	Ingress       bool              `json:"ingress"`
+	BridgeName    string            `json:"bridge_name"`    // 宿主机上的网桥名称
+	MTU           int               `json:"mtu"`            // 为 0 时使用 daemon 默认值
+	ICC           *bool             `json:"icc"`            // 是否允许容器间通信, 为 nil 时使用 daemon 默认值
+	DriverOptions map[string]string `json:"driver_options"` // 其它驱动参数, 优先级高于 BridgeName/MTU/ICC
+	Labels        map[string]string `json:"labels"`
+}
+
+// IPAMPool 网络的一个地址池
+type IPAMPool struct {
+	Subnet       string            `json:"subnet"`        // CIDR, 如 172.20.0.0/16 或 fd00:20::/64
+	Gateway      string            `json:"gateway"`       // 网关地址, 需位于 Subnet 内
+	IPRange      string            `json:"ip_range"`      // 分配容器地址的子范围, 需位于 Subnet 内
+	AuxAddresses map[string]string `json:"aux_addresses"` // 保留的辅助地址, 如 host: 172.20.0.2
 }
 
 func (m *Manager) ListNetwork(ctx context.Context) ([]NetworkSummary, error) {
+	return m.cache.networkList(ctx, m.listNetwork)
+}
+
+func (m *Manager) listNetwork(ctx context.Context) ([]NetworkSummary, error) {
 	nets, err := m.client.NetworkList(ctx, network.ListOptions{})
 	if err != nil {
 		return nil, err
@@ -50,6 +94,7 @@ func (m *Manager) ListNetwork(ctx context.Context) ([]NetworkSummary, error) {
 			subNet = append(subNet, SubNetworkConfig{
 				Subnet:  ncf.Subnet,
 				Gateway: ncf.Gateway,
+				IPRange: ncf.IPRange,
 			})
 		}
 		n := NetworkSummary{
@@ -58,6 +103,7 @@ func (m *Manager) ListNetwork(ctx context.Context) ([]NetworkSummary, error) {
 			Driver:     net.Driver,
 			Scope:      net.Scope,
 			Created:    net.Created.Format("2006-01-02 15:04:05"),
+			Internal:   net.Internal,
 			SubNet:     subNet,
 			Containers: containers,
 			Labels:     net.Labels,
@@ -81,16 +127,160 @@ func (m *Manager) HasSameNameNetwork(ctx context.Context, networkName string) (b
 }
 
 func (m *Manager) CreateNetwork(ctx context.Context, name, driver, subnet, gateway string, labels map[string]string) (string, error) {
-	nt, err := m.client.NetworkCreate(ctx, name, network.CreateOptions{
+	return m.CreateNetworkWithSpec(ctx, NetworkSpec{
+		Name:       name,
 		Driver:     driver,
-		IPAM:       &network.IPAM{Config: []network.IPAMConfig{{Subnet: subnet, Gateway: gateway}}},
+		Pools:      []IPAMPool{{Subnet: subnet, Gateway: gateway}},
 		Labels:     labels,
 		Internal:   false,
 		Attachable: true,
 	})
+}
+
+func (m *Manager) CreateNetworkWithSpec(ctx context.Context, spec NetworkSpec) (id string, err error) {
+	defer m.invalidate()
+	defer m.audit(ctx, "CreateNetworkWithSpec", auditArgs{"spec": spec}).done(&id, &err)
+	if err := validateNetworkSpec(spec); err != nil {
+		return "", invalidArgument(err)
+	}
+	if m.subnetAllocator != nil && needsAllocatedSubnet(spec) {
+		// 分配与创建之间持有锁, 避免并发创建的网络拿到同一个子网
+		m.subnetAllocator.mu.Lock()
+		defer m.subnetAllocator.mu.Unlock()
+		subnet, err := m.NextFreeSubnet(ctx, spec.PrefixLen)
+		if err != nil {
+			return "", err
+		}
+		spec.Pools = withAllocatedSubnet(spec.Pools, subnet)
+	}
+	nt, err := m.client.NetworkCreate(ctx, spec.Name, networkCreateOptions(spec))
 	return nt.ID, err
 }
 
+// needsAllocatedSubnet 判断是否为网络分配 IPv4 子网: 只用于 bridge 驱动和默认 IPAM 驱动,
+// macvlan、overlay 等驱动和第三方 IPAM 的子网由调用方或驱动决定; 只给出 IPv6 地址池时不追加 IPv4 子网
+func needsAllocatedSubnet(spec NetworkSpec) bool {
+	if spec.Driver != "" && spec.Driver != "bridge" {
+		return false
+	}
+	if spec.IPAMDriver != "" && spec.IPAMDriver != "default" {
+		return false
+	}
+	if hasIPv4Subnet(spec.Pools) {
+		return false
+	}
+	for _, pool := range spec.Pools {
+		if pool.Subnet == "" {
+			return true
+		}
+	}
+	return len(spec.Pools) == 0
+}
+
+func hasIPv4Subnet(pools []IPAMPool) bool {
+	for _, pool := range pools {
+		if prefix, err := netip.ParsePrefix(pool.Subnet); err == nil && prefix.Addr().Is4() {
+			return true
+		}
+	}
+	return false
+}
+
+// withAllocatedSubnet 用分配到的子网填充第一个空地址池, 没有空地址池时追加一个
+func withAllocatedSubnet(pools []IPAMPool, subnet string) []IPAMPool {
+	result := make([]IPAMPool, 0, len(pools)+1)
+	filled := false
+	for _, pool := range pools {
+		if pool.Subnet == "" && !filled {
+			pool.Subnet = subnet
+			filled = true
+		}
+		result = append(result, pool)
+	}
+	if !filled {
+		result = append(result, IPAMPool{Subnet: subnet})
+	}
+	return result
+}
+
+// validateNetworkSpec 在调用 daemon 之前校验地址池的 CIDR、网关、地址范围和辅助地址
+func validateNetworkSpec(spec NetworkSpec) error {
+	if spec.Name == "" {
+		return errors.New("network name is required")
+	}
+	if spec.MTU < 0 {
+		return fmt.Errorf("invalid mtu %d", spec.MTU)
+	}
+
+	var prefixes []netip.Prefix
+	for _, pool := range spec.Pools {
+		if pool.Subnet == "" {
+			if pool.Gateway != "" || pool.IPRange != "" || len(pool.AuxAddresses) > 0 {
+				return errors.New("gateway, ip range and auxiliary addresses require a subnet")
+			}
+			continue
+		}
+		prefix, err := netip.ParsePrefix(pool.Subnet)
+		if err != nil {
+			return fmt.Errorf("invalid subnet %s: invalid CIDR block notation", pool.Subnet)
+		}
+		if prefix.Addr().Is6() && !spec.EnableIPv6 {
+			return fmt.Errorf("subnet %s is an IPv6 block but EnableIPv6 is false", pool.Subnet)
+		}
+		for _, p := range prefixes {
+			if p.Overlaps(prefix) {
+				return fmt.Errorf("subnet %s overlaps with subnet %s", prefix, p)
+			}
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	return network.ValidateIPAM(networkCreateOptions(spec).IPAM, spec.EnableIPv6)
+}
+
+func networkCreateOptions(spec NetworkSpec) network.CreateOptions {
+	ipam := &network.IPAM{
+		Driver:  spec.IPAMDriver,
+		Options: spec.IPAMOptions,
+	}
+	for _, pool := range spec.Pools {
+		if pool.Subnet == "" {
+			continue
+		}
+		ipam.Config = append(ipam.Config, network.IPAMConfig{
+			Subnet:     pool.Subnet,
+			IPRange:    pool.IPRange,
+			Gateway:    pool.Gateway,
+			AuxAddress: pool.AuxAddresses,
+		})
+	}
+
+	options := make(map[string]string)
+	if spec.BridgeName != "" {
+		options[bridgeNameOption] = spec.BridgeName
+	}
+	if spec.MTU > 0 {
+		options[driverMTUOption] = strconv.Itoa(spec.MTU)
+	}
+	if spec.ICC != nil {
+		options[bridgeICCOption] = strconv.FormatBool(*spec.ICC)
+	}
+	for k, v := range spec.DriverOptions {
+		options[k] = v
+	}
+
+	enableIPv6 := spec.EnableIPv6
+	return network.CreateOptions{
+		Driver:     spec.Driver,
+		EnableIPv6: &enableIPv6,
+		IPAM:       ipam,
+		Internal:   spec.Internal,
+		Attachable: spec.Attachable,
+		Ingress:    spec.Ingress,
+		Options:    options,
+		Labels:     spec.Labels,
+	}
+}
+
 func (m *Manager) GetNetworkByName(ctx context.Context, name string) (*NetworkSummary, error) {
 	networks, err := m.ListNetwork(ctx)
 	if err != nil {
@@ -104,13 +294,14 @@ func (m *Manager) GetNetworkByName(ctx context.Context, name string) (*NetworkSu
 				Driver:     nt.Driver,
 				Scope:      nt.Scope,
 				Created:    nt.Created,
+				Internal:   nt.Internal,
 				Containers: nt.Containers,
 				Labels:     nt.Labels,
 				SubNet:     nt.SubNet,
 			}, nil
 		}
 	}
-	return nil, fmt.Errorf("nt %s not found", name)
+	return nil, fmt.Errorf("network %s: %w", name, ErrNotFound)
 }
 
 func (m *Manager) GetNetworkByID(ctx context.Context, networkID string) (*NetworkSummary, error) {
@@ -131,6 +322,7 @@ func (m *Manager) GetNetworkByID(ctx context.Context, networkID string) (*Networ
 		subNet = append(subNet, SubNetworkConfig{
 			Subnet:  ncf.Subnet,
 			Gateway: ncf.Gateway,
+			IPRange: ncf.IPRange,
 		})
 	}
 	nw := &NetworkSummary{
@@ -139,6 +331,7 @@ func (m *Manager) GetNetworkByID(ctx context.Context, networkID string) (*Networ
 		Driver:     nr.Driver,
 		Scope:      nr.Scope,
 		Created:    nr.Created.Format("2006-01-02 15:04:05"),
+		Internal:   nr.Internal,
 		SubNet:     subNet,
 		Containers: containers,
 		Labels:     nr.Labels,
@@ -146,30 +339,165 @@ func (m *Manager) GetNetworkByID(ctx context.Context, networkID string) (*Networ
 	return nw, nil
 }
 
+// DeleteNetworkOptions 删除网络时的参数
+type DeleteNetworkOptions struct {
+	Disconnect bool // 先断开所有已接入的容器, 否则网络仍在使用时拒绝删除
+	Force      bool // 断开容器时强制断开
+}
+
+// NetworkInUseError 网络仍有容器接入时返回的错误
+type NetworkInUseError struct {
+	Network    string
+	Containers []string // 已接入容器的名称
+}
+
+func (e *NetworkInUseError) Error() string {
+	return fmt.Sprintf("network %s is in use by containers: %s", e.Network, strings.Join(e.Containers, ", "))
+}
+
+func (e *NetworkInUseError) Unwrap() error {
+	return ErrInUse
+}
+
 func (m *Manager) DeleteNetwork(ctx context.Context, networkID string) error {
-	return m.client.NetworkRemove(ctx, networkID)
+	return m.DeleteNetworkWithOptions(ctx, networkID, DeleteNetworkOptions{})
+}
+
+func (m *Manager) DeleteNetworkWithOptions(ctx context.Context, networkID string, opts DeleteNetworkOptions) (err error) {
+	defer m.invalidate()
+	defer m.audit(ctx, "DeleteNetworkWithOptions", auditArgs{"network": networkID, "options": opts}).done(nil, &err)
+	nr, err := m.client.NetworkInspect(ctx, networkID, network.InspectOptions{})
+	if err != nil {
+		return err
+	}
+	if len(nr.Containers) > 0 && !opts.Disconnect {
+		names := make([]string, 0, len(nr.Containers))
+		for id, endpoint := range nr.Containers {
+			name := endpoint.Name
+			if name == "" {
+				name = id
+			}
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return &NetworkInUseError{Network: nr.Name, Containers: names}
+	}
+	for id := range nr.Containers {
+		if err := m.client.NetworkDisconnect(ctx, nr.ID, id, opts.Force); err != nil {
+			return err
+		}
+	}
+	return m.client.NetworkRemove(ctx, nr.ID)
+}
+
+// PruneNetworkOptions 清理网络时的过滤条件
+type PruneNetworkOptions struct {
+	Labels map[string]string // 只清理带有这些标签的网络, 值为空时只要求标签存在
+	Until  time.Duration     // 只清理创建时间早于该时长之前的网络, 为 0 时不限制
 }
 
+// PruneNetwork 清理未被使用且带有 CreatedByProbe 标签的网络, 不影响其他程序创建的网络
 func (m *Manager) PruneNetwork(ctx context.Context) error {
-	_, err := m.client.NetworksPrune(ctx, filters.NewArgs(filters.Arg("until", "0")))
+	_, err := m.PruneNetworkWithOptions(ctx, PruneNetworkOptions{Labels: map[string]string{CreatedByProbe: "true"}})
 	return err
 }
 
+// PruneNetworkWithOptions 清理未被使用的网络, 返回被删除的网络名称
+func (m *Manager) PruneNetworkWithOptions(ctx context.Context, opts PruneNetworkOptions) (deleted []string, err error) {
+	defer m.invalidate()
+	defer m.audit(ctx, "PruneNetworkWithOptions", auditArgs{"options": opts}).done(&deleted, &err)
+	report, err := m.client.NetworksPrune(ctx, pruneNetworkFilters(opts))
+	if err != nil {
+		return nil, err
+	}
+	return report.NetworksDeleted, nil
+}
+
+func pruneNetworkFilters(opts PruneNetworkOptions) filters.Args {
+	args := filters.NewArgs()
+	for k, v := range opts.Labels {
+		if v == "" {
+			args.Add("label", k)
+			continue
+		}
+		args.Add("label", k+"="+v)
+	}
+	if opts.Until > 0 {
+		args.Add("until", opts.Until.String())
+	}
+	return args
+}
+
+// EndpointOptions 容器接入网络时的端点配置
+type EndpointOptions struct {
+	Aliases     []string `json:"aliases"`      // 网络内的 DNS 别名
+	IPv4Address string   `json:"ipv4_address"` // 固定 IPv4 地址, 需位于网络的子网内
+	IPv6Address string   `json:"ipv6_address"` // 固定 IPv6 地址
+	MacAddress  string   `json:"mac_address"`
+	Links       []string `json:"links"` // 形如 container:alias
+}
+
+func endpointSettings(opts EndpointOptions) (*network.EndpointSettings, error) {
+	settings := &network.EndpointSettings{
+		Aliases:    opts.Aliases,
+		Links:      opts.Links,
+		MacAddress: opts.MacAddress,
+	}
+	if opts.IPv4Address != "" {
+		addr, err := netip.ParseAddr(opts.IPv4Address)
+		if err != nil || !addr.Is4() {
+			return nil, fmt.Errorf("invalid ipv4 address %s", opts.IPv4Address)
+		}
+	}
+	if opts.IPv6Address != "" {
+		addr, err := netip.ParseAddr(opts.IPv6Address)
+		if err != nil || !addr.Is6() {
+			return nil, fmt.Errorf("invalid ipv6 address %s", opts.IPv6Address)
+		}
+	}
+	if opts.IPv4Address != "" || opts.IPv6Address != "" {
+		settings.IPAMConfig = &network.EndpointIPAMConfig{
+			IPv4Address: opts.IPv4Address,
+			IPv6Address: opts.IPv6Address,
+		}
+	}
+	if opts.MacAddress != "" {
+		if _, err := net.ParseMAC(opts.MacAddress); err != nil {
+			return nil, fmt.Errorf("invalid mac address %s", opts.MacAddress)
+		}
+	}
+	return settings, nil
+}
+
 func (m *Manager) JoinNetwork(ctx context.Context, containerID, networkID string) error {
+	return m.JoinNetworkWithOptions(ctx, containerID, networkID, EndpointOptions{})
+}
+
+func (m *Manager) JoinNetworkWithOptions(ctx context.Context, containerID, networkID string, opts EndpointOptions) (err error) {
+	defer m.invalidate()
+	defer m.audit(ctx, "JoinNetworkWithOptions", auditArgs{"container": containerID, "network": networkID, "options": opts}).done(nil, &err)
+	settings, err := endpointSettings(opts)
+	if err != nil {
+		return invalidArgument(err)
+	}
 	if _, err := m.client.NetworkInspect(ctx, networkID, network.InspectOptions{}); err != nil {
 		return err
 	}
-	if _, err := m.client.ContainerInspect(ctx, containerID); err != nil {
+	containerID, err = m.ResolveContainer(ctx, containerID)
+	if err != nil {
 		return err
 	}
-	return m.client.NetworkConnect(ctx, networkID, containerID, &network.EndpointSettings{})
+	return m.client.NetworkConnect(ctx, networkID, containerID, settings)
 }
 
-func (m *Manager) LeaveNetwork(ctx context.Context, containerID, networkID string) error {
+func (m *Manager) LeaveNetwork(ctx context.Context, containerID, networkID string) (err error) {
+	defer m.invalidate()
+	defer m.audit(ctx, "LeaveNetwork", auditArgs{"container": containerID, "network": networkID}).done(nil, &err)
 	if _, err := m.client.NetworkInspect(ctx, networkID, network.InspectOptions{}); err != nil {
 		return err
 	}
-	if _, err := m.client.ContainerInspect(ctx, containerID); err != nil {
+	containerID, err = m.ResolveContainer(ctx, containerID)
+	if err != nil {
 		return err
 	}
 	return m.client.NetworkDisconnect(ctx, networkID, containerID, true)
@@ -6,7 +6,10 @@ package docker
 
 import (
 	"context"
+	"errors"
+	"net/http"
 	"testing"
+	"time"
 )
 
 func TestListNetwork(t *testing.T) {
@@ -49,3 +52,196 @@ func TestPruneNetwork(t *testing.T) {
 	}
 	t.Log("prune network success")
 }
+
+func TestCreateNetworkWithSpec(t *testing.T) {
+	manager, _ := NewManager()
+	icc := false
+	networkID, err := manager.CreateNetworkWithSpec(context.Background(), NetworkSpec{
+		Name:       "test-v6",
+		Driver:     "bridge",
+		EnableIPv6: true,
+		Pools: []IPAMPool{
+			{Subnet: "172.21.0.0/16", Gateway: "172.21.0.1", IPRange: "172.21.5.0/24", AuxAddresses: map[string]string{"host": "172.21.0.2"}},
+			{Subnet: "fd00:21::/64", Gateway: "fd00:21::1"},
+		},
+		BridgeName: "br-test-v6",
+		MTU:        1450,
+		ICC:        &icc,
+		Labels:     map[string]string{CreatedByProbe: "true"},
+	})
+	if err != nil {
+		t.Fatalf("create network failed: %v\n", err)
+	}
+	t.Logf("network id: %#v\n", networkID)
+}
+
+func TestValidateNetworkSpec(t *testing.T) {
+	cases := []struct {
+		name  string
+		spec  NetworkSpec
+		valid bool
+	}{
+		{"ipv4", NetworkSpec{Name: "n", Pools: []IPAMPool{{Subnet: "172.20.0.0/24", Gateway: "172.20.0.1"}}}, true},
+		{"dual stack", NetworkSpec{Name: "n", EnableIPv6: true, Pools: []IPAMPool{{Subnet: "172.20.0.0/24"}, {Subnet: "fd00::/64"}}}, true},
+		{"no pools", NetworkSpec{Name: "n"}, true},
+		{"no name", NetworkSpec{}, false},
+		{"bad cidr", NetworkSpec{Name: "n", Pools: []IPAMPool{{Subnet: "172.20.0.0/33"}}}, false},
+		{"unmasked", NetworkSpec{Name: "n", Pools: []IPAMPool{{Subnet: "172.20.0.1/24"}}}, false},
+		{"gateway outside", NetworkSpec{Name: "n", Pools: []IPAMPool{{Subnet: "172.20.0.0/24", Gateway: "172.21.0.1"}}}, false},
+		{"range outside", NetworkSpec{Name: "n", Pools: []IPAMPool{{Subnet: "172.20.0.0/24", IPRange: "172.20.1.0/25"}}}, false},
+		{"aux outside", NetworkSpec{Name: "n", Pools: []IPAMPool{{Subnet: "172.20.0.0/24", AuxAddresses: map[string]string{"a": "10.0.0.1"}}}}, false},
+		{"ipv6 disabled", NetworkSpec{Name: "n", Pools: []IPAMPool{{Subnet: "fd00::/64"}}}, false},
+		{"overlap", NetworkSpec{Name: "n", Pools: []IPAMPool{{Subnet: "172.20.0.0/16"}, {Subnet: "172.20.1.0/24"}}}, false},
+		{"gateway without subnet", NetworkSpec{Name: "n", Pools: []IPAMPool{{Gateway: "172.20.0.1"}}}, false},
+	}
+	for _, c := range cases {
+		err := validateNetworkSpec(c.spec)
+		if (err == nil) != c.valid {
+			t.Errorf("%s: expected valid=%v, got %v", c.name, c.valid, err)
+		}
+	}
+}
+
+func TestNetworkCreateOptions(t *testing.T) {
+	icc := false
+	opts := networkCreateOptions(NetworkSpec{
+		Name:          "n",
+		BridgeName:    "br0",
+		MTU:           1400,
+		ICC:           &icc,
+		DriverOptions: map[string]string{driverMTUOption: "1300"},
+	})
+	if opts.Options[bridgeNameOption] != "br0" || opts.Options[bridgeICCOption] != "false" || opts.Options[driverMTUOption] != "1300" {
+		t.Errorf("unexpected driver options: %#v", opts.Options)
+	}
+}
+
+func TestJoinNetworkWithOptions(t *testing.T) {
+	manager, _ := NewManager()
+	err := manager.JoinNetworkWithOptions(context.Background(), "redis", "test", EndpointOptions{
+		Aliases:     []string{"cache"},
+		IPv4Address: "172.20.0.10",
+	})
+	if err != nil {
+		t.Errorf("join network failed: %v\n", err)
+	}
+}
+
+func TestEndpointSettings(t *testing.T) {
+	settings, err := endpointSettings(EndpointOptions{
+		Aliases:     []string{"cache"},
+		IPv4Address: "172.20.0.10",
+		IPv6Address: "fd00::10",
+		MacAddress:  "02:42:ac:14:00:0a",
+		Links:       []string{"mysql:db"},
+	})
+	if err != nil {
+		t.Fatalf("endpoint settings error: %v", err)
+	}
+	if settings.IPAMConfig == nil || settings.IPAMConfig.IPv4Address != "172.20.0.10" || settings.IPAMConfig.IPv6Address != "fd00::10" {
+		t.Errorf("unexpected ipam config: %#v", settings.IPAMConfig)
+	}
+	if settings, _ := endpointSettings(EndpointOptions{}); settings.IPAMConfig != nil {
+		t.Errorf("expected no ipam config: %#v", settings.IPAMConfig)
+	}
+	for _, opts := range []EndpointOptions{
+		{IPv4Address: "fd00::10"},
+		{IPv6Address: "172.20.0.10"},
+		{MacAddress: "not-a-mac"},
+	} {
+		if _, err := endpointSettings(opts); err == nil {
+			t.Errorf("expected error for %#v", opts)
+		}
+	}
+}
+
+func TestDeleteNetworkWithOptions(t *testing.T) {
+	manager, _ := NewManager()
+	err := manager.DeleteNetworkWithOptions(context.Background(), "test", DeleteNetworkOptions{Disconnect: true})
+	if err != nil {
+		t.Errorf("delete network failed: %v\n", err)
+	}
+}
+
+func TestPruneNetworkWithOptions(t *testing.T) {
+	manager, _ := NewManager()
+	deleted, err := manager.PruneNetworkWithOptions(context.Background(), PruneNetworkOptions{
+		Labels: map[string]string{CreatedByProbe: "true"},
+		Until:  24 * time.Hour,
+	})
+	if err != nil {
+		t.Errorf("prune network failed: %v\n", err)
+	}
+	t.Logf("deleted networks: %v", deleted)
+}
+
+func TestPruneNetworkOnlyProbe(t *testing.T) {
+	var query string
+	m := newFakeDaemonManager(t, func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query().Get("filters")
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"NetworksDeleted":[]}`))
+	})
+	if err := m.PruneNetwork(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"label":{"` + CreatedByProbe + `=true":true}}`; query != want {
+		t.Errorf("filters = %s, want %s", query, want)
+	}
+}
+
+func TestPruneNetworkFilters(t *testing.T) {
+	args := pruneNetworkFilters(PruneNetworkOptions{
+		Labels: map[string]string{CreatedByProbe: "true", ServerTypeLabel: ""},
+		Until:  90 * time.Minute,
+	})
+	if !args.ExactMatch("label", CreatedByProbe+"=true") || !args.ExactMatch("label", ServerTypeLabel) {
+		t.Errorf("unexpected label filters: %v", args.Get("label"))
+	}
+	if until := args.Get("until"); len(until) != 1 || until[0] != "1h30m0s" {
+		t.Errorf("unexpected until filter: %v", until)
+	}
+	if pruneNetworkFilters(PruneNetworkOptions{}).Len() != 0 {
+		t.Error("expected empty filters")
+	}
+}
+
+func TestNetworkInUseError(t *testing.T) {
+	var err error = &NetworkInUseError{Network: "test", Containers: []string{"nginx", "redis"}}
+	if !errors.Is(err, ErrInUse) {
+		t.Error("expected ErrInUse")
+	}
+	if err.Error() != "network test is in use by containers: nginx, redis" {
+		t.Errorf("unexpected message: %s", err)
+	}
+}
+
+func TestCreateNetworkWithSpecInvalid(t *testing.T) {
+	manager, _ := NewManager()
+	_, err := manager.CreateNetworkWithSpec(context.Background(), NetworkSpec{Name: "test", MTU: -1})
+	if !errors.Is(err, ErrInvalid) || err.Error() != "invalid mtu -1" {
+		t.Errorf("error = %v, want invalid argument", err)
+	}
+}
+
+func TestNeedsAllocatedSubnet(t *testing.T) {
+	cases := []struct {
+		spec     NetworkSpec
+		expected bool
+	}{
+		{NetworkSpec{}, true},
+		{NetworkSpec{Driver: "bridge", Pools: []IPAMPool{{Gateway: ""}}}, true},
+		{NetworkSpec{Pools: []IPAMPool{{Subnet: "172.21.0.0/16"}}}, false},
+		{NetworkSpec{EnableIPv6: true, Pools: []IPAMPool{{Subnet: "fd00:21::/64"}}}, false},
+		{NetworkSpec{EnableIPv6: true, Pools: []IPAMPool{{}, {Subnet: "fd00:21::/64"}}}, true},
+		{NetworkSpec{Driver: "macvlan"}, false},
+		{NetworkSpec{Driver: "overlay"}, false},
+		{NetworkSpec{IPAMDriver: "infoblox"}, false},
+		{NetworkSpec{IPAMDriver: "default"}, true},
+	}
+	for _, c := range cases {
+		if got := needsAllocatedSubnet(c.spec); got != c.expected {
+			t.Errorf("needsAllocatedSubnet(%+v) = %v, expected %v", c.spec, got, c.expected)
+		}
+	}
+}
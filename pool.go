@@ -0,0 +1,449 @@
+// Package docker
+// Date: 2024/08/20 09:52:37
+// Author: Amu
+// Description:
+package docker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/client"
+)
+
+// DefaultHostTimeout Pool 对单台主机调用的默认超时时间
+const DefaultHostTimeout = 10 * time.Second
+
+// HostConfig 一台 Docker 主机的连接参数
+type HostConfig struct {
+	Name       string            // 主机名称, 在 Pool 中唯一, 不能包含 /
+	Host       string            // daemon 地址, 如 tcp://10.0.0.2:2376, 为空时使用环境变量 DOCKER_HOST
+	APIVersion string            // 固定的 API 版本, 为空时自动协商
+	TLSCACert  string            // TLS 证书路径, 三项都为空时不使用 TLS
+	TLSCert    string            //
+	TLSKey     string            //
+	Timeout    time.Duration     // 单次调用的超时时间, 为 0 时不限制; 不作用于返回流和传输数据的操作, 见 TimeoutInterceptor
+	Labels     map[string]string // 主机标签, 供调度时筛选主机
+	Options    []Option          // 其它 Manager 选项
+}
+
+func (c HostConfig) managerOptions() []Option {
+	var clientOpts []client.Opt
+	if c.Host != "" {
+		clientOpts = append(clientOpts, client.WithHost(c.Host))
+	}
+	if c.APIVersion != "" {
+		clientOpts = append(clientOpts, client.WithVersion(c.APIVersion))
+	}
+	if c.TLSCACert != "" || c.TLSCert != "" || c.TLSKey != "" {
+		clientOpts = append(clientOpts, client.WithTLSClientConfig(c.TLSCACert, c.TLSCert, c.TLSKey))
+	}
+	return append([]Option{WithClientOptions(clientOpts...)}, c.Options...)
+}
+
+// Pool 按名称管理多台主机的 IManager
+type Pool struct {
+	timeout time.Duration
+
+	mu      sync.RWMutex
+	hosts   map[string]IManager
+	labels  map[string]map[string]string
+	closers map[string]io.Closer // AddHost 创建的 Manager, 由 Pool 负责关闭
+}
+
+type PoolOption func(*Pool)
+
+// WithHostTimeout 设置并发访问各主机时单台主机的超时时间, 超时的主机计为不可达, 默认为 DefaultHostTimeout
+func WithHostTimeout(timeout time.Duration) PoolOption {
+	return func(p *Pool) {
+		p.timeout = timeout
+	}
+}
+
+// NewPool 为每个 HostConfig 创建一个 Manager; 创建时不连接 daemon, 主机不可达不会导致失败
+func NewPool(hosts []HostConfig, opts ...PoolOption) (*Pool, error) {
+	p := &Pool{
+		timeout: DefaultHostTimeout,
+		hosts:   make(map[string]IManager),
+		labels:  make(map[string]map[string]string),
+		closers: make(map[string]io.Closer),
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	for _, host := range hosts {
+		if err := p.AddHost(host); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// AddHost 按连接参数创建 Manager 并加入 Pool, 该 Manager 在 Remove 或 Close 时关闭
+func (p *Pool) AddHost(config HostConfig) error {
+	if err := validateHostName(config.Name); err != nil {
+		return err
+	}
+	m, err := NewManager(config.managerOptions()...)
+	if err != nil {
+		return fmt.Errorf("host %s: %w", config.Name, err)
+	}
+	var host IManager = m
+	if config.Timeout > 0 {
+		host = Intercept(m, TimeoutInterceptor(config.Timeout))
+	}
+	if err := p.add(config.Name, host, config.Labels, m); err != nil {
+		_ = m.Close()
+		return err
+	}
+	return nil
+}
+
+// Add 将已有的 IManager 加入 Pool, 如经过 Intercept 装饰的 Manager; Pool 不负责关闭它
+func (p *Pool) Add(name string, m IManager, labels map[string]string) error {
+	return p.add(name, m, labels, nil)
+}
+
+func (p *Pool) add(name string, m IManager, labels map[string]string, closer io.Closer) error {
+	if err := validateHostName(name); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.hosts[name]; ok {
+		return invalidArgument(fmt.Errorf("host %s already exists", name))
+	}
+	p.hosts[name] = m
+	p.labels[name] = labels
+	if closer != nil {
+		p.closers[name] = closer
+	}
+	return nil
+}
+
+func validateHostName(name string) error {
+	if name == "" || strings.Contains(name, "/") {
+		return invalidArgument(fmt.Errorf("invalid host name %q", name))
+	}
+	return nil
+}
+
+// Remove 从 Pool 中移除主机, 主机由 AddHost 加入时关闭其 Manager
+func (p *Pool) Remove(name string) {
+	p.mu.Lock()
+	closer := p.closers[name]
+	delete(p.hosts, name)
+	delete(p.labels, name)
+	delete(p.closers, name)
+	p.mu.Unlock()
+	if closer != nil {
+		_ = closer.Close()
+	}
+}
+
+// Close 移除全部主机并关闭由 AddHost 创建的 Manager, 包括其缓存的事件订阅和连接
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	closers := p.closers
+	p.hosts = make(map[string]IManager)
+	p.labels = make(map[string]map[string]string)
+	p.closers = make(map[string]io.Closer)
+	p.mu.Unlock()
+
+	var errs []error
+	for name, closer := range closers {
+		if err := closer.Close(); err != nil {
+			errs = append(errs, &HostError{Host: name, Err: err})
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Hosts 返回全部主机名称, 按名称排序
+func (p *Pool) Hosts() []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	names := make([]string, 0, len(p.hosts))
+	for name := range p.hosts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Host 返回主机对应的 IManager
+func (p *Pool) Host(name string) (IManager, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	m, ok := p.hosts[name]
+	if !ok {
+		return nil, fmt.Errorf("host %s: %w", name, ErrNotFound)
+	}
+	return m, nil
+}
+
+// HostLabels 返回主机的标签
+func (p *Pool) HostLabels(name string) map[string]string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.labels[name]
+}
+
+// HostError 某台主机上的调用失败
+type HostError struct {
+	Host string
+	Err  error
+}
+
+func (e *HostError) Error() string {
+	return fmt.Sprintf("host %s: %v", e.Host, e.Err)
+}
+
+func (e *HostError) Unwrap() error {
+	return e.Err
+}
+
+// PoolError 部分主机调用失败时返回的错误, 其余主机的结果仍然有效
+type PoolError struct {
+	Errors []*HostError // 按主机名称排序
+}
+
+func (e *PoolError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (e *PoolError) Unwrap() []error {
+	errs := make([]error, len(e.Errors))
+	for i, err := range e.Errors {
+		errs[i] = err
+	}
+	return errs
+}
+
+// FailedHosts 返回调用失败的主机名称
+func (e *PoolError) FailedHosts() []string {
+	hosts := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		hosts[i] = err.Host
+	}
+	return hosts
+}
+
+// each 并发地在每台主机上调用 fn, 返回成功的主机名称(已排序), 有主机失败时同时返回 *PoolError
+func (p *Pool) each(ctx context.Context, fn func(ctx context.Context, host string, m IManager) error) ([]string, error) {
+	p.mu.RLock()
+	hosts := make(map[string]IManager, len(p.hosts))
+	for name, m := range p.hosts {
+		hosts[name] = m
+	}
+	p.mu.RUnlock()
+
+	var (
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		ok     []string
+		failed []*HostError
+	)
+	for name, m := range hosts {
+		wg.Add(1)
+		go func(name string, m IManager) {
+			defer wg.Done()
+			hostCtx, cancel := ctx, context.CancelFunc(func() {})
+			if p.timeout > 0 {
+				hostCtx, cancel = context.WithTimeout(ctx, p.timeout)
+			}
+			defer cancel()
+			err := fn(hostCtx, name, m)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				failed = append(failed, &HostError{Host: name, Err: err})
+				return
+			}
+			ok = append(ok, name)
+		}(name, m)
+	}
+	wg.Wait()
+
+	sort.Strings(ok)
+	if len(failed) == 0 {
+		return ok, nil
+	}
+	sort.Slice(failed, func(i, j int) bool { return failed[i].Host < failed[j].Host })
+	return ok, &PoolError{Errors: failed}
+}
+
+// HostContainer 带有主机名称的容器信息
+type HostContainer struct {
+	Host string `json:"host"`
+	ContainerSummary
+}
+
+// HostImage 带有主机名称的镜像信息
+type HostImage struct {
+	Host string `json:"host"`
+	ImageSummary
+}
+
+// HostNetwork 带有主机名称的网络信息
+type HostNetwork struct {
+	Host string `json:"host"`
+	NetworkSummary
+}
+
+// fanOut 并发地在每台主机上调用 list 并按主机名称顺序合并结果
+func fanOut[T, R any](ctx context.Context, p *Pool, list func(m IManager, ctx context.Context) ([]T, error), wrap func(host string, item T) R) ([]R, error) {
+	var mu sync.Mutex
+	results := make(map[string][]T)
+	ok, err := p.each(ctx, func(ctx context.Context, host string, m IManager) error {
+		items, err := list(m, ctx)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		results[host] = items
+		return nil
+	})
+	merged := make([]R, 0)
+	for _, host := range ok {
+		for _, item := range results[host] {
+			merged = append(merged, wrap(host, item))
+		}
+	}
+	return merged, err
+}
+
+// ListContainer 返回全部主机上的容器; 部分主机不可达时返回其余主机的结果和 *PoolError
+func (p *Pool) ListContainer(ctx context.Context) ([]HostContainer, error) {
+	return fanOut(ctx, p, IManager.ListContainer, func(host string, c ContainerSummary) HostContainer {
+		return HostContainer{Host: host, ContainerSummary: c}
+	})
+}
+
+// ListImage 返回全部主机上的镜像; 部分主机不可达时返回其余主机的结果和 *PoolError
+func (p *Pool) ListImage(ctx context.Context) ([]HostImage, error) {
+	return fanOut(ctx, p, IManager.ListImage, func(host string, im ImageSummary) HostImage {
+		return HostImage{Host: host, ImageSummary: im}
+	})
+}
+
+// ListNetwork 返回全部主机上的网络; 部分主机不可达时返回其余主机的结果和 *PoolError
+func (p *Pool) ListNetwork(ctx context.Context) ([]HostNetwork, error) {
+	return fanOut(ctx, p, IManager.ListNetwork, func(host string, n NetworkSummary) HostNetwork {
+		return HostNetwork{Host: host, NetworkSummary: n}
+	})
+}
+
+// LocateContainer 查找容器所在的主机, 返回主机名称和容器 ID。
+// 引用形如 host/container 时只在该主机上查找; 否则在全部主机上查找, 多台主机上都存在时返回 ErrAmbiguous。
+// 有主机不可达或查找失败(不含 ErrNotFound)时即使在其他主机上找到也返回 *PoolError, 因为同名容器可能位于该主机上,
+// 此时需要使用 host/container 指定主机
+func (p *Pool) LocateContainer(ctx context.Context, ref string) (string, string, error) {
+	if host, name, ok := strings.Cut(ref, "/"); ok && host != "" {
+		m, err := p.Host(host)
+		if err != nil {
+			return "", "", err
+		}
+		id, err := m.ResolveContainer(ctx, name)
+		if err != nil {
+			return "", "", err
+		}
+		return host, id, nil
+	}
+
+	var mu sync.Mutex
+	found := make(map[string]string)
+	_, err := p.each(ctx, func(ctx context.Context, host string, m IManager) error {
+		id, err := m.ResolveContainer(ctx, ref)
+		if errors.Is(err, ErrNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		found[host] = id
+		return nil
+	})
+	if len(found) <= 1 && err != nil {
+		return "", "", err
+	}
+	switch len(found) {
+	case 1:
+		for host, id := range found {
+			return host, id, nil
+		}
+	case 0:
+		return "", "", fmt.Errorf("container %q: %w", ref, ErrNotFound)
+	}
+	hosts := make([]string, 0, len(found))
+	for host := range found {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	return "", "", fmt.Errorf("container %q exists on hosts %s, use host/container: %w", ref, strings.Join(hosts, ", "), ErrAmbiguous)
+}
+
+// OnContainer 在容器所在的主机上调用 fn, fn 收到的是容器 ID, 参数顺序与 IManager.StartContainer 等方法表达式一致
+func (p *Pool) OnContainer(ctx context.Context, ref string, fn func(m IManager, ctx context.Context, containerID string) error) error {
+	host, id, err := p.LocateContainer(ctx, ref)
+	if err != nil {
+		return err
+	}
+	m, err := p.Host(host)
+	if err != nil {
+		return err
+	}
+	if err := fn(m, ctx, id); err != nil {
+		return &HostError{Host: host, Err: err}
+	}
+	return nil
+}
+
+func (p *Pool) StartContainer(ctx context.Context, ref string) error {
+	return p.OnContainer(ctx, ref, IManager.StartContainer)
+}
+
+func (p *Pool) StopContainer(ctx context.Context, ref string) error {
+	return p.OnContainer(ctx, ref, IManager.StopContainer)
+}
+
+func (p *Pool) RestartContainer(ctx context.Context, ref string) error {
+	return p.OnContainer(ctx, ref, IManager.RestartContainer)
+}
+
+func (p *Pool) DeleteContainer(ctx context.Context, ref string) error {
+	return p.OnContainer(ctx, ref, IManager.DeleteContainer)
+}
+
+func (p *Pool) GetContainerStats(ctx context.Context, ref string) (*ContainerStats, error) {
+	var stats *ContainerStats
+	err := p.OnContainer(ctx, ref, func(m IManager, ctx context.Context, id string) error {
+		var err error
+		stats, err = m.GetContainerStats(ctx, id)
+		return err
+	})
+	return stats, err
+}
+
+func (p *Pool) ContainerLogsWithOptions(ctx context.Context, ref string, opts LogsOptions) (io.ReadCloser, error) {
+	var logs io.ReadCloser
+	err := p.OnContainer(ctx, ref, func(m IManager, ctx context.Context, id string) error {
+		var err error
+		logs, err = m.ContainerLogsWithOptions(ctx, id, opts)
+		return err
+	})
+	return logs, err
+}
@@ -0,0 +1,191 @@
+// Package docker
+// Date: 2024/08/20 11:03:18
+// Author: Amu
+// Description:
+package docker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/client"
+)
+
+// fakeHost 以内存中的容器列表模拟一台主机, err 不为空时模拟主机不可达
+type fakeHost struct {
+	IManager
+	containers []ContainerSummary
+	started    []string
+	err        error
+	delay      time.Duration
+}
+
+func (f *fakeHost) ListContainer(ctx context.Context) ([]ContainerSummary, error) {
+	if f.delay > 0 {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(f.delay):
+		}
+	}
+	return f.containers, f.err
+}
+
+func (f *fakeHost) ResolveContainer(_ context.Context, ref string) (string, error) {
+	if f.err != nil {
+		return "", f.err
+	}
+	for _, c := range f.containers {
+		if c.ID == ref || c.Name == ref {
+			return c.ID, nil
+		}
+	}
+	return "", fmt.Errorf("container %q: %w", ref, ErrNotFound)
+}
+
+func (f *fakeHost) StartContainer(_ context.Context, containerID string) error {
+	f.started = append(f.started, containerID)
+	return f.err
+}
+
+func newTestPool(t *testing.T, hosts map[string]*fakeHost, opts ...PoolOption) *Pool {
+	t.Helper()
+	p, err := NewPool(nil, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, host := range hosts {
+		if err := p.Add(name, host, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return p
+}
+
+func TestPoolListContainer(t *testing.T) {
+	unreachable := client.ErrorConnectionFailed("tcp://10.0.0.3:2376")
+	p := newTestPool(t, map[string]*fakeHost{
+		"b": {containers: []ContainerSummary{{ID: "b1", Name: "redis"}}},
+		"a": {containers: []ContainerSummary{{ID: "a1", Name: "nginx"}, {ID: "a2", Name: "mysql"}}},
+		"c": {err: unreachable},
+	})
+
+	containers, err := p.ListContainer(context.Background())
+	var poolErr *PoolError
+	if !errors.As(err, &poolErr) || !reflect.DeepEqual(poolErr.FailedHosts(), []string{"c"}) || !client.IsErrConnectionFailed(err) {
+		t.Fatalf("err = %v", err)
+	}
+	var got []string
+	for _, c := range containers {
+		got = append(got, c.Host+"/"+c.ID)
+	}
+	if want := []string{"a/a1", "a/a2", "b/b1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("containers = %v, want %v", got, want)
+	}
+}
+
+func TestPoolHostTimeout(t *testing.T) {
+	p := newTestPool(t, map[string]*fakeHost{
+		"fast": {containers: []ContainerSummary{{ID: "f1"}}},
+		"slow": {containers: []ContainerSummary{{ID: "s1"}}, delay: time.Minute},
+	}, WithHostTimeout(20*time.Millisecond))
+
+	containers, err := p.ListContainer(context.Background())
+	if !errors.Is(err, context.DeadlineExceeded) || len(containers) != 1 || containers[0].Host != "fast" {
+		t.Errorf("containers = %+v, err = %v", containers, err)
+	}
+}
+
+func TestPoolLocateContainer(t *testing.T) {
+	a := &fakeHost{containers: []ContainerSummary{{ID: "a1", Name: "nginx"}, {ID: "a2", Name: "redis"}}}
+	b := &fakeHost{containers: []ContainerSummary{{ID: "b1", Name: "redis"}}}
+	c := &fakeHost{err: client.ErrorConnectionFailed("")}
+	p := newTestPool(t, map[string]*fakeHost{"a": a, "b": b})
+	ctx := context.Background()
+
+	if host, id, err := p.LocateContainer(ctx, "nginx"); host != "a" || id != "a1" || err != nil {
+		t.Errorf("host = %q, id = %q, err = %v", host, id, err)
+	}
+	if _, _, err := p.LocateContainer(ctx, "redis"); !errors.Is(err, ErrAmbiguous) {
+		t.Errorf("err = %v", err)
+	}
+	if host, id, err := p.LocateContainer(ctx, "b/redis"); host != "b" || id != "b1" || err != nil {
+		t.Errorf("host = %q, id = %q, err = %v", host, id, err)
+	}
+	if _, _, err := p.LocateContainer(ctx, "x/redis"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("err = %v", err)
+	}
+	if _, _, err := p.LocateContainer(ctx, "mysql"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("err = %v", err)
+	}
+
+	// 容器可能位于不可达的主机上, 不能确定不存在
+	if err := p.Add("c", c, nil); err != nil {
+		t.Fatal(err)
+	}
+	var poolErr *PoolError
+	if _, _, err := p.LocateContainer(ctx, "mysql"); errors.Is(err, ErrNotFound) || !errors.As(err, &poolErr) {
+		t.Errorf("err = %v", err)
+	}
+	// 其余主机上找到时, 不可达的主机上仍可能有同名容器
+	if host, _, err := p.LocateContainer(ctx, "nginx"); host != "" || !errors.As(err, &poolErr) {
+		t.Errorf("host = %q, err = %v", host, err)
+	}
+	if err := p.DeleteContainer(ctx, "nginx"); !errors.As(err, &poolErr) {
+		t.Errorf("err = %v", err)
+	}
+	if host, _, err := p.LocateContainer(ctx, "a/nginx"); host != "a" || err != nil {
+		t.Errorf("host = %q, err = %v", host, err)
+	}
+
+	if err := p.StartContainer(ctx, "b/redis"); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(b.started, []string{"b1"}) || len(a.started) != 0 {
+		t.Errorf("a = %v, b = %v", a.started, b.started)
+	}
+}
+
+func TestPoolAdd(t *testing.T) {
+	p := newTestPool(t, map[string]*fakeHost{"a": {}})
+	if err := p.Add("a", &fakeHost{}, nil); !errors.Is(err, ErrInvalid) {
+		t.Errorf("err = %v", err)
+	}
+	if err := p.Add("a/b", &fakeHost{}, nil); !errors.Is(err, ErrInvalid) {
+		t.Errorf("err = %v", err)
+	}
+	if err := p.AddHost(HostConfig{Name: "remote", Host: "tcp://10.0.0.2:2376", APIVersion: "1.46", Labels: map[string]string{"zone": "a"}}); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(p.Hosts(), []string{"a", "remote"}) || p.HostLabels("remote")["zone"] != "a" {
+		t.Errorf("hosts = %v", p.Hosts())
+	}
+	p.Remove("a")
+	if _, err := p.Host("a"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestPoolClose(t *testing.T) {
+	p := newTestPool(t, map[string]*fakeHost{"local": {}})
+	config := HostConfig{Name: "remote", Host: "tcp://10.0.0.2:2376", APIVersion: "1.46", Timeout: time.Second, Options: []Option{WithCache(0)}}
+	if err := p.AddHost(config); err != nil {
+		t.Fatal(err)
+	}
+	m := p.closers["remote"].(*Manager)
+	// 超时按调用设置, 不作用于整个连接
+	if _, ok := p.hosts["remote"].(*interceptedManager); !ok || m.client.HTTPClient().Timeout != 0 {
+		t.Errorf("host = %T, http timeout = %v", p.hosts["remote"], m.client.HTTPClient().Timeout)
+	}
+
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !m.cache.closed || len(p.Hosts()) != 0 {
+		t.Errorf("cache closed = %v, hosts = %v", m.cache.closed, p.Hosts())
+	}
+}
@@ -0,0 +1,312 @@
+// Package docker
+// Date: 2024/07/30 10:15:46
+// Author: Amu
+// Description:
+package docker
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/errdefs"
+	"github.com/docker/go-connections/nat"
+)
+
+// AutoHostPort 端口映射中的宿主机端口写作 auto 时, 从 PortAllocator 的范围中分配空闲端口, 如 auto:80/tcp
+const AutoHostPort = "auto"
+
+const (
+	DefaultHostPortMin = 20000
+	DefaultHostPortMax = 29999
+)
+
+// PortAllocator 检查宿主机端口冲突并为 auto 端口分配空闲端口
+type PortAllocator struct {
+	Min       int  // 自动分配的最小端口, 为 0 时使用 DefaultHostPortMin
+	Max       int  // 自动分配的最大端口, 为 0 时使用 DefaultHostPortMax
+	CheckHost bool // daemon 在本机时, 同时检查端口是否已被宿主机上的其它进程占用
+
+	mu sync.Mutex
+}
+
+func NewPortAllocator(minPort, maxPort int, checkHost bool) *PortAllocator {
+	return &PortAllocator{Min: minPort, Max: maxPort, CheckHost: checkHost}
+}
+
+func (a *PortAllocator) portRange() (int, int) {
+	minPort, maxPort := a.Min, a.Max
+	if minPort == 0 {
+		minPort = DefaultHostPortMin
+	}
+	if maxPort == 0 {
+		maxPort = DefaultHostPortMax
+	}
+	return minPort, maxPort
+}
+
+// PortConflictError 宿主机端口已被占用时返回的错误
+type PortConflictError struct {
+	Binding PortMapping
+	Owner   string // 占用端口的容器名称, 为空时表示被宿主机上的进程占用
+}
+
+func (e *PortConflictError) Error() string {
+	if e.Owner == "" {
+		return fmt.Sprintf("host port %s/%s is already bound on the host", net.JoinHostPort(e.Binding.IP, e.Binding.HostPort), e.Binding.Proto)
+	}
+	return fmt.Sprintf("host port %s/%s is already published by container %s", net.JoinHostPort(e.Binding.IP, e.Binding.HostPort), e.Binding.Proto, e.Owner)
+}
+
+func (e *PortConflictError) Unwrap() error {
+	return ErrInUse
+}
+
+func (p PortMapping) String() string {
+	if p.HostPort == "" {
+		return fmt.Sprintf("%s/%s", p.ContainerPort, p.Proto)
+	}
+	return fmt.Sprintf("%s:%s/%s", net.JoinHostPort(p.IP, p.HostPort), p.ContainerPort, p.Proto)
+}
+
+// publishedPort 已被占用的宿主机端口
+type publishedPort struct {
+	ip    string
+	owner string
+}
+
+type portKey struct {
+	proto string
+	port  string
+}
+
+// parsePortSpecs 解析端口映射, 返回结果中与 auto 对应的下标
+func parsePortSpecs(specs []string) ([]PortMapping, map[int]bool, error) {
+	var mappings []PortMapping
+	auto := make(map[int]bool)
+	for _, spec := range specs {
+		raw, isAuto := spec, false
+		if last := strings.LastIndex(spec, ":"); last > 0 {
+			hostPart := spec[:last]
+			prev := strings.LastIndex(hostPart, ":")
+			if hostPart[prev+1:] == AutoHostPort {
+				raw = hostPart[:prev+1] + spec[last:]
+				isAuto = true
+			}
+		}
+
+		portsMapping, err := nat.ParsePortSpec(raw)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, portMapping := range portsMapping {
+			hostIP := portMapping.Binding.HostIP
+			if hostIP == "" {
+				hostIP = "0.0.0.0"
+			}
+			if isAuto {
+				auto[len(mappings)] = true
+			}
+			mappings = append(mappings, PortMapping{
+				Proto:         portMapping.Port.Proto(),
+				IP:            hostIP,
+				HostPort:      portMapping.Binding.HostPort,
+				ContainerPort: portMapping.Port.Port(),
+			})
+		}
+	}
+	return mappings, auto, nil
+}
+
+func isUnspecifiedIP(ip string) bool {
+	parsed := net.ParseIP(ip)
+	return ip == "" || (parsed != nil && parsed.IsUnspecified())
+}
+
+// ipOverlaps 两个监听地址中任意一个为通配地址或二者相同即视为冲突
+func ipOverlaps(a, b string) bool {
+	return isUnspecifiedIP(a) || isUnspecifiedIP(b) || a == b
+}
+
+func findPortOwner(used map[portKey][]publishedPort, proto, ip, port string) (publishedPort, bool) {
+	for _, p := range used[portKey{proto: proto, port: port}] {
+		if ipOverlaps(p.ip, ip) {
+			return p, true
+		}
+	}
+	return publishedPort{}, false
+}
+
+// hostPortFree 通过尝试监听判断宿主机端口是否空闲
+func hostPortFree(proto, ip, port string) bool {
+	address := net.JoinHostPort(ip, port)
+	if proto == "udp" {
+		conn, err := net.ListenPacket("udp", address)
+		if err != nil {
+			return false
+		}
+		_ = conn.Close()
+		return true
+	}
+	if proto == "sctp" {
+		return true
+	}
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return false
+	}
+	_ = listener.Close()
+	return true
+}
+
+// isLocalDaemon daemon 通过本地 socket 连接时, 宿主机端口检查才有意义
+func (m *Manager) isLocalDaemon() bool {
+	host := m.client.DaemonHost()
+	return strings.HasPrefix(host, "unix://") || strings.HasPrefix(host, "npipe://")
+}
+
+// publishedPorts 返回全部容器占用的宿主机端口: 运行中的容器取实际绑定的端口,
+// 已创建或已停止的容器取 HostConfig.PortBindings 中固定的端口, 启动时同样会占用
+func (m *Manager) publishedPorts(ctx context.Context) (map[portKey][]publishedPort, error) {
+	containers, err := m.client.ContainerList(ctx, container.ListOptions{All: true})
+	if err != nil {
+		return nil, err
+	}
+	used := make(map[portKey][]publishedPort)
+	for _, c := range containers {
+		var owner string
+		if len(c.Names) > 0 {
+			owner = strings.TrimPrefix(c.Names[0], "/")
+		}
+		if c.State == "running" {
+			for _, p := range c.Ports {
+				if p.PublicPort == 0 {
+					continue
+				}
+				key := portKey{proto: p.Type, port: strconv.Itoa(int(p.PublicPort))}
+				used[key] = append(used[key], publishedPort{ip: p.IP, owner: owner})
+			}
+			continue
+		}
+
+		inspect, err := m.client.ContainerInspect(ctx, c.ID)
+		if errdefs.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if inspect.HostConfig == nil {
+			continue
+		}
+		for port, bindings := range inspect.HostConfig.PortBindings {
+			for _, binding := range bindings {
+				if binding.HostPort == "" {
+					// 启动时由 daemon 随机分配
+					continue
+				}
+				start, end, err := nat.ParsePortRangeToInt(binding.HostPort)
+				if err != nil {
+					continue
+				}
+				for hostPort := start; hostPort <= end; hostPort++ {
+					key := portKey{proto: port.Proto(), port: strconv.Itoa(hostPort)}
+					used[key] = append(used[key], publishedPort{ip: binding.HostIP, owner: owner})
+				}
+			}
+		}
+	}
+	return used, nil
+}
+
+// PreparePorts 解析端口映射, 检查宿主机端口是否与其它容器或宿主机进程冲突,
+// 并为 auto 端口分配空闲端口, 返回最终的端口映射
+func (m *Manager) PreparePorts(ctx context.Context, ports []string) ([]PortMapping, error) {
+	mappings, auto, err := parsePortSpecs(ports)
+	if err != nil {
+		return nil, err
+	}
+	if m.portAllocator == nil {
+		if len(auto) > 0 {
+			return nil, fmt.Errorf("%s host ports require a port allocator", AutoHostPort)
+		}
+		return mappings, nil
+	}
+
+	used, err := m.publishedPorts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	checkHost := m.portAllocator.CheckHost && m.isLocalDaemon()
+	if err := assignHostPorts(mappings, auto, used, m.portAllocator, checkHost); err != nil {
+		return nil, err
+	}
+	return mappings, nil
+}
+
+// assignHostPorts 先检查显式指定的端口, 再为 auto 端口分配, 分配结果写回 mappings
+func assignHostPorts(mappings []PortMapping, auto map[int]bool, used map[portKey][]publishedPort, allocator *PortAllocator, checkHost bool) error {
+	reserve := func(p PortMapping) {
+		key := portKey{proto: p.Proto, port: p.HostPort}
+		used[key] = append(used[key], publishedPort{ip: p.IP})
+	}
+
+	for i, p := range mappings {
+		if auto[i] || p.HostPort == "" {
+			continue
+		}
+		start, end, err := nat.ParsePortRangeToInt(p.HostPort)
+		if err != nil {
+			return err
+		}
+		for port := start; port <= end; port++ {
+			hostPort := strconv.Itoa(port)
+			binding := PortMapping{Proto: p.Proto, IP: p.IP, HostPort: hostPort, ContainerPort: p.ContainerPort}
+			if owner, ok := findPortOwner(used, p.Proto, p.IP, hostPort); ok {
+				if owner.owner == "" {
+					return fmt.Errorf("host port %s/%s is mapped more than once", net.JoinHostPort(p.IP, hostPort), p.Proto)
+				}
+				return &PortConflictError{Binding: binding, Owner: owner.owner}
+			}
+			if checkHost && !hostPortFree(p.Proto, p.IP, hostPort) {
+				return &PortConflictError{Binding: binding}
+			}
+		}
+		if start == end {
+			reserve(p)
+		} else {
+			for port := start; port <= end; port++ {
+				reserve(PortMapping{Proto: p.Proto, IP: p.IP, HostPort: strconv.Itoa(port)})
+			}
+		}
+	}
+
+	minPort, maxPort := allocator.portRange()
+	next := minPort
+	for i := range mappings {
+		if !auto[i] {
+			continue
+		}
+		p := &mappings[i]
+		for ; next <= maxPort; next++ {
+			hostPort := strconv.Itoa(next)
+			if _, ok := findPortOwner(used, p.Proto, p.IP, hostPort); ok {
+				continue
+			}
+			if checkHost && !hostPortFree(p.Proto, p.IP, hostPort) {
+				continue
+			}
+			p.HostPort = hostPort
+			reserve(*p)
+			break
+		}
+		if p.HostPort == "" {
+			return fmt.Errorf("no free host port in range %d-%d for %s/%s", minPort, maxPort, p.ContainerPort, p.Proto)
+		}
+	}
+	return nil
+}
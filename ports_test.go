@@ -0,0 +1,127 @@
+// Package docker
+// Date: 2024/07/30 10:16:20
+// Author: Amu
+// Description:
+package docker
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestPreparePorts(t *testing.T) {
+	manager, _ := NewManager(WithPortAllocator(NewPortAllocator(0, 0, true)))
+	mappings, err := manager.PreparePorts(context.Background(), []string{"6379:6379", "auto:80/tcp"})
+	if err != nil {
+		t.Fatalf("prepare ports error: %v", err)
+	}
+	for _, mapping := range mappings {
+		t.Logf("port mapping: %s", mapping)
+	}
+}
+
+func TestParsePortSpecs(t *testing.T) {
+	mappings, auto, err := parsePortSpecs([]string{"8080:80", "127.0.0.1:auto:443/tcp", "auto:53/udp", "9000"})
+	if err != nil {
+		t.Fatalf("parse port specs error: %v", err)
+	}
+	expected := []string{"0.0.0.0:8080:80/tcp", "443/tcp", "53/udp", "9000/tcp"}
+	for i, mapping := range mappings {
+		if mapping.String() != expected[i] {
+			t.Errorf("mapping %d: expected %s, got %s", i, expected[i], mapping)
+		}
+	}
+	if mappings[1].IP != "127.0.0.1" {
+		t.Errorf("host ip not kept: %#v", mappings[1])
+	}
+	if !auto[1] || !auto[2] || auto[0] || auto[3] {
+		t.Errorf("unexpected auto flags: %v", auto)
+	}
+}
+
+func TestAssignHostPorts(t *testing.T) {
+	used := map[portKey][]publishedPort{
+		{proto: "tcp", port: "8080"}:  {{ip: "0.0.0.0", owner: "nginx"}},
+		{proto: "tcp", port: "20000"}: {{ip: "0.0.0.0", owner: "web"}},
+	}
+	allocator := NewPortAllocator(20000, 20005, false)
+
+	mappings, auto, _ := parsePortSpecs([]string{"8080:80"})
+	err := assignHostPorts(mappings, auto, used, allocator, false)
+	var conflict *PortConflictError
+	if !errors.As(err, &conflict) || conflict.Owner != "nginx" || !errors.Is(err, ErrInUse) {
+		t.Fatalf("expected conflict with nginx, got %v", err)
+	}
+
+	mappings, auto, _ = parsePortSpecs([]string{"127.0.0.1:8081:80", "auto:81", "auto:82"})
+	if err := assignHostPorts(mappings, auto, used, allocator, false); err != nil {
+		t.Fatalf("assign host ports error: %v", err)
+	}
+	if mappings[1].HostPort != "20001" || mappings[2].HostPort != "20002" {
+		t.Errorf("unexpected auto ports: %v", mappings)
+	}
+
+	mappings, auto, _ = parsePortSpecs([]string{"9090:80", "9090:81"})
+	if err := assignHostPorts(mappings, auto, map[portKey][]publishedPort{}, allocator, false); err == nil {
+		t.Error("expected duplicate mapping error")
+	}
+
+	mappings, auto, _ = parsePortSpecs([]string{"auto:80"})
+	full := NewPortAllocator(20000, 20000, false)
+	if err := assignHostPorts(mappings, auto, used, full, false); err == nil {
+		t.Error("expected exhausted range error")
+	}
+}
+
+func TestHostPortFree(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip("cannot listen: ", err)
+	}
+	defer listener.Close()
+	port := strconv.Itoa(listener.Addr().(*net.TCPAddr).Port)
+	if hostPortFree("tcp", "127.0.0.1", port) {
+		t.Errorf("port %s should be in use", port)
+	}
+}
+
+func TestPreparePortsStoppedContainers(t *testing.T) {
+	m := newFakeDaemonManager(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/containers/json"):
+			if r.URL.Query().Get("all") != "1" {
+				t.Errorf("containers listed without all=1: %s", r.URL.RawQuery)
+			}
+			_, _ = w.Write([]byte(`[
+				{"Id":"c1","Names":["/web"],"State":"running","Ports":[{"PublicPort":8080,"PrivatePort":80,"Type":"tcp"}]},
+				{"Id":"c2","Names":["/created"],"State":"created"},
+				{"Id":"c3","Names":["/stopped"],"State":"exited"}
+			]`))
+		case strings.HasSuffix(r.URL.Path, "/containers/c2/json"):
+			_, _ = w.Write([]byte(`{"Id":"c2","HostConfig":{"PortBindings":{"80/tcp":[{"HostIp":"","HostPort":"20000"}]}}}`))
+		case strings.HasSuffix(r.URL.Path, "/containers/c3/json"):
+			_, _ = w.Write([]byte(`{"Id":"c3","HostConfig":{"PortBindings":{"53/udp":[{"HostIp":"","HostPort":"5353"}],"443/tcp":[{"HostPort":""}]}}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"message":"not found"}`))
+		}
+	}, WithPortAllocator(NewPortAllocator(20000, 20001, false)))
+	ctx := context.Background()
+
+	mappings, err := m.PreparePorts(ctx, []string{"auto:80"})
+	if err != nil || len(mappings) != 1 || mappings[0].HostPort != "20001" {
+		t.Fatalf("mappings = %v, err = %v", mappings, err)
+	}
+	for spec, owner := range map[string]string{"8080:80": "web", "20000:80": "created", "5353:53/udp": "stopped"} {
+		var conflict *PortConflictError
+		if _, err := m.PreparePorts(ctx, []string{spec}); !errors.As(err, &conflict) || conflict.Owner != owner {
+			t.Errorf("%s: err = %v, expected conflict with %s", spec, err, owner)
+		}
+	}
+}
@@ -0,0 +1,444 @@
+// Package docker
+// Date: 2024/08/02 14:27:09
+// Author: Amu
+// Description:
+package docker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/errdefs"
+	"github.com/docker/go-connections/nat"
+)
+
+type ReconcileAction string
+
+const (
+	ReconcileCreate   ReconcileAction = "create"   // 容器不存在, 需要创建
+	ReconcileRecreate ReconcileAction = "recreate" // 配置与期望不一致, 需要删除后重建
+	ReconcileStart    ReconcileAction = "start"    // 配置一致但未运行
+	ReconcileRemove   ReconcileAction = "remove"   // 由 probe 创建但已不在期望列表中
+	ReconcileKeep     ReconcileAction = "keep"     // 无需变更
+	ReconcileSkip     ReconcileAction = "skip"     // 同名容器不是由 probe 创建的, 不做处理
+)
+
+// ReconcileStep 对单个容器的处理计划
+type ReconcileStep struct {
+	Action      ReconcileAction `json:"action"`
+	Name        string          `json:"name"`
+	ContainerID string          `json:"container_id"`
+	Reasons     []string        `json:"reasons"`
+	Error       string          `json:"error,omitempty"`
+
+	spec *ContainerSpec
+}
+
+// ReconcilePlan 一次调和的全部步骤, 执行顺序为 remove, recreate, create, start
+type ReconcilePlan struct {
+	Steps []ReconcileStep `json:"steps"`
+}
+
+// Changed 计划中是否包含需要执行的变更
+func (p *ReconcilePlan) Changed() bool {
+	for _, step := range p.Steps {
+		if step.Action != ReconcileKeep && step.Action != ReconcileSkip {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *ReconcilePlan) String() string {
+	symbols := map[ReconcileAction]string{
+		ReconcileCreate:   "+",
+		ReconcileRecreate: "~",
+		ReconcileStart:    ">",
+		ReconcileRemove:   "-",
+		ReconcileKeep:     "=",
+		ReconcileSkip:     "!",
+	}
+	b := new(strings.Builder)
+	for _, step := range p.Steps {
+		fmt.Fprintf(b, "%s %s %s", symbols[step.Action], step.Action, step.Name)
+		if len(step.Reasons) > 0 {
+			fmt.Fprintf(b, " (%s)", strings.Join(step.Reasons, "; "))
+		}
+		if step.Error != "" {
+			fmt.Fprintf(b, " error: %s", step.Error)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+type ReconcileOptions struct {
+	DryRun bool // 只生成计划, 不做任何变更
+	Pull   bool // 生成计划前拉取期望的镜像, 以便发现镜像仓库中的新版本
+}
+
+var reconcileOrder = map[ReconcileAction]int{
+	ReconcileRemove:   0,
+	ReconcileRecreate: 1,
+	ReconcileCreate:   2,
+	ReconcileStart:    3,
+	ReconcileKeep:     4,
+	ReconcileSkip:     5,
+}
+
+// Reconcile 将带有 CreatedByProbe 标签的容器调整为 desired 描述的状态:
+// 缺失的创建, 配置不一致的重建, 多余的删除, 其它容器不受影响
+func (m *Manager) Reconcile(ctx context.Context, desired []ContainerSpec, opts ReconcileOptions) (*ReconcilePlan, error) {
+	defer m.invalidate()
+	if opts.Pull {
+		for _, spec := range desired {
+			if err := m.PullImage(ctx, spec.Image); err != nil {
+				return nil, err
+			}
+		}
+	}
+	plan, err := m.planReconcile(ctx, desired)
+	if err != nil || opts.DryRun {
+		return plan, err
+	}
+
+	var errs []error
+	for i := range plan.Steps {
+		step := &plan.Steps[i]
+		if err := m.applyReconcileStep(ctx, step); err != nil {
+			step.Error = err.Error()
+			errs = append(errs, fmt.Errorf("%s %s: %w", step.Action, step.Name, err))
+		}
+	}
+	return plan, errors.Join(errs...)
+}
+
+func (m *Manager) planReconcile(ctx context.Context, desired []ContainerSpec) (*ReconcilePlan, error) {
+	containers, err := m.client.ContainerList(ctx, container.ListOptions{All: true})
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]types.Container)
+	for _, c := range containers {
+		for _, name := range c.Names {
+			byName[strings.TrimPrefix(name, "/")] = c
+		}
+	}
+
+	plan := &ReconcilePlan{}
+	wanted := make(map[string]bool)
+	for i := range desired {
+		spec := managedSpec(desired[i])
+		if spec.Name == "" {
+			return nil, errors.New("desired container name is required")
+		}
+		if wanted[spec.Name] {
+			return nil, fmt.Errorf("desired container %s is declared more than once", spec.Name)
+		}
+		wanted[spec.Name] = true
+
+		step := ReconcileStep{Name: spec.Name, spec: &spec}
+		actual, ok := byName[spec.Name]
+		switch {
+		case !ok:
+			step.Action = ReconcileCreate
+		case actual.Labels[CreatedByProbe] != "true":
+			step.Action = ReconcileSkip
+			step.ContainerID = actual.ID
+			step.Reasons = []string{"container is not managed by probe"}
+		default:
+			step.ContainerID = actual.ID
+			inspect, err := m.client.ContainerInspect(ctx, actual.ID)
+			if err != nil {
+				return nil, err
+			}
+			var image *types.ImageInspect
+			if im, _, err := m.client.ImageInspectWithRaw(ctx, spec.Image); err == nil {
+				image = &im
+			} else if !errdefs.IsNotFound(err) {
+				return nil, err
+			}
+			step.Reasons = containerDiff(spec, inspect, image)
+			switch {
+			case len(step.Reasons) > 0:
+				step.Action = ReconcileRecreate
+			case inspect.ContainerJSONBase == nil || inspect.State == nil || !inspect.State.Running:
+				step.Action = ReconcileStart
+			default:
+				step.Action = ReconcileKeep
+			}
+		}
+		plan.Steps = append(plan.Steps, step)
+	}
+
+	for _, c := range containers {
+		if c.Labels[CreatedByProbe] != "true" || len(c.Names) == 0 {
+			continue
+		}
+		name := strings.TrimPrefix(c.Names[0], "/")
+		if wanted[name] {
+			continue
+		}
+		plan.Steps = append(plan.Steps, ReconcileStep{
+			Action:      ReconcileRemove,
+			Name:        name,
+			ContainerID: c.ID,
+			Reasons:     []string{"not in desired state"},
+		})
+	}
+
+	sort.SliceStable(plan.Steps, func(i, j int) bool {
+		return reconcileOrder[plan.Steps[i].Action] < reconcileOrder[plan.Steps[j].Action]
+	})
+	return plan, nil
+}
+
+func (m *Manager) applyReconcileStep(ctx context.Context, step *ReconcileStep) error {
+	switch step.Action {
+	case ReconcileRemove:
+		return m.DeleteContainer(ctx, step.ContainerID)
+	case ReconcileRecreate:
+		return m.recreate(ctx, step)
+	case ReconcileCreate:
+		return m.createAndStart(ctx, step)
+	case ReconcileStart:
+		return m.StartContainer(ctx, step.ContainerID)
+	}
+	return nil
+}
+
+// recreate 删除旧容器后按 spec 创建并启动新容器; 镜像在删除旧容器之前准备好,
+// 创建或启动失败时删除新容器并按旧容器的配置恢复, 避免服务没有容器
+func (m *Manager) recreate(ctx context.Context, step *ReconcileStep) error {
+	if err := m.ensureImage(ctx, step.spec.Image); err != nil {
+		return err
+	}
+	inspect, err := m.client.ContainerInspect(ctx, step.ContainerID)
+	if err != nil {
+		return err
+	}
+	oldID := step.ContainerID
+	cfg := createConfigFromInspect(inspect, nil, m.client.ClientVersion())
+	reuseAnonymousVolumes(cfg, inspect.Mounts)
+	wasRunning := inspect.State != nil && inspect.State.Running
+	if err := m.DeleteContainer(ctx, oldID); err != nil {
+		return err
+	}
+
+	createErr := m.createAndStart(ctx, step)
+	if createErr == nil {
+		return nil
+	}
+	restoreCtx, cancel := rollbackContext(ctx)
+	defer cancel()
+	if step.ContainerID != oldID {
+		_ = m.client.ContainerRemove(restoreCtx, step.ContainerID, container.RemoveOptions{Force: true})
+	}
+	restoredID, err := m.createFromConfig(restoreCtx, cfg, strings.TrimPrefix(inspect.Name, "/"))
+	if err == nil && wasRunning {
+		err = m.client.ContainerStart(restoreCtx, restoredID, container.StartOptions{})
+	}
+	if err != nil {
+		step.ContainerID = ""
+		return fmt.Errorf("%w; restoring previous container failed: %v", createErr, err)
+	}
+	step.ContainerID = restoredID
+	return fmt.Errorf("%w; previous container was restored", createErr)
+}
+
+// ensureImage 镜像不在本地时拉取
+func (m *Manager) ensureImage(ctx context.Context, imageName string) error {
+	if _, _, err := m.client.ImageInspectWithRaw(ctx, imageName); errdefs.IsNotFound(err) {
+		return m.PullImage(ctx, imageName)
+	}
+	return nil
+}
+
+func (m *Manager) createAndStart(ctx context.Context, step *ReconcileStep) error {
+	if err := m.ensureImage(ctx, step.spec.Image); err != nil {
+		return err
+	}
+	containerID, err := m.CreateContainerWithSpec(ctx, *step.spec)
+	if err != nil {
+		return err
+	}
+	step.ContainerID = containerID
+	return m.StartContainer(ctx, containerID)
+}
+
+// managedSpec 复制 spec 并加上 CreatedByProbe 标签
+func managedSpec(spec ContainerSpec) ContainerSpec {
+	labels := make(map[string]string, len(spec.Labels)+1)
+	for k, v := range spec.Labels {
+		labels[k] = v
+	}
+	labels[CreatedByProbe] = "true"
+	spec.Labels = labels
+	return spec
+}
+
+// containerDiff 比较期望的配置与容器的实际配置, 返回不一致的原因。
+// 镜像自带的环境变量和标签会先合并到期望值中, image 为 nil 表示镜像不在本地
+func containerDiff(spec ContainerSpec, inspect types.ContainerJSON, image *types.ImageInspect) []string {
+	var reasons []string
+	base := inspect.ContainerJSONBase
+	if base == nil {
+		base = &types.ContainerJSONBase{}
+	}
+	var imageConfig container.Config
+	if image == nil {
+		reasons = append(reasons, fmt.Sprintf("image %s not present locally", spec.Image))
+	} else {
+		if image.Config != nil {
+			imageConfig = *image.Config
+		}
+		if base.Image != image.ID {
+			reasons = append(reasons, fmt.Sprintf("image %s changed", spec.Image))
+		}
+	}
+
+	var actualConfig container.Config
+	if inspect.Config != nil {
+		actualConfig = *inspect.Config
+	}
+	var hostConfig container.HostConfig
+	if base.HostConfig != nil {
+		hostConfig = *base.HostConfig
+	}
+
+	if !equalStringMap(envMap(imageConfig.Env, spec.Env), envMap(actualConfig.Env)) {
+		reasons = append(reasons, "env changed")
+	}
+	if spec.Cmd != nil && strings.Join(spec.Cmd, "\x00") != strings.Join(actualConfig.Cmd, "\x00") {
+		reasons = append(reasons, "command changed")
+	}
+	if !equalStringMap(mergeLabels(imageConfig.Labels, spec.Labels), mergeLabels(actualConfig.Labels)) {
+		reasons = append(reasons, "labels changed")
+	}
+	if !portsMatch(spec.Ports, hostConfig.PortBindings) {
+		reasons = append(reasons, "ports changed")
+	}
+	if binds, err := parseVolumes(spec.Volumes); err != nil || !equalStringSet(binds, hostConfig.Binds) {
+		reasons = append(reasons, "volumes changed")
+	}
+	if policy, err := parseRestartPolicy(spec.RestartPolicy); err != nil || policy != hostConfig.RestartPolicy {
+		reasons = append(reasons, "restart policy changed")
+	}
+	if spec.Memory != hostConfig.Memory {
+		reasons = append(reasons, "memory changed")
+	}
+	if int64(spec.CPUs*1e9) != hostConfig.NanoCPUs {
+		reasons = append(reasons, "cpus changed")
+	}
+	if len(spec.Networks) > 0 {
+		var expected, actual []string
+		for _, attachment := range spec.Networks {
+			expected = append(expected, attachment.Network)
+		}
+		if inspect.NetworkSettings != nil {
+			for name := range inspect.NetworkSettings.Networks {
+				actual = append(actual, name)
+			}
+		}
+		if !equalStringSet(expected, actual) {
+			reasons = append(reasons, "networks changed")
+		}
+	}
+	return reasons
+}
+
+// envMap 依次合并 KEY=value 形式的环境变量, 后出现的覆盖先出现的
+func envMap(envs ...[]string) map[string]string {
+	result := make(map[string]string)
+	for _, list := range envs {
+		for _, env := range list {
+			key, value, _ := strings.Cut(env, "=")
+			result[key] = value
+		}
+	}
+	return result
+}
+
+func mergeLabels(labels ...map[string]string) map[string]string {
+	result := make(map[string]string)
+	for _, m := range labels {
+		for k, v := range m {
+			result[k] = v
+		}
+	}
+	return result
+}
+
+func equalStringMap(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if bv, ok := b[k]; !ok || bv != v {
+			return false
+		}
+	}
+	return true
+}
+
+func equalStringSet(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	counts := make(map[string]int)
+	for _, s := range a {
+		counts[s]++
+	}
+	for _, s := range b {
+		if counts[s] == 0 {
+			return false
+		}
+		counts[s]--
+	}
+	return true
+}
+
+// portsMatch 比较期望的端口映射与实际的 PortBindings, auto 或未指定的宿主机端口匹配任意端口
+func portsMatch(specs []string, bindings nat.PortMap) bool {
+	mappings, auto, err := parsePortSpecs(specs)
+	if err != nil {
+		return false
+	}
+	var actual []PortMapping
+	for port, list := range bindings {
+		for _, binding := range list {
+			hostIP := binding.HostIP
+			if hostIP == "" {
+				hostIP = "0.0.0.0"
+			}
+			actual = append(actual, PortMapping{Proto: port.Proto(), IP: hostIP, HostPort: binding.HostPort, ContainerPort: port.Port()})
+		}
+	}
+	if len(mappings) != len(actual) {
+		return false
+	}
+
+	matched := make([]bool, len(actual))
+	for i, want := range mappings {
+		found := false
+		for j, got := range actual {
+			if matched[j] || got.Proto != want.Proto || got.ContainerPort != want.ContainerPort || got.IP != want.IP {
+				continue
+			}
+			if !auto[i] && want.HostPort != "" && want.HostPort != got.HostPort {
+				continue
+			}
+			matched[j], found = true, true
+			break
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
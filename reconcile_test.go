@@ -0,0 +1,190 @@
+// Package docker
+// Date: 2024/08/02 14:27:48
+// Author: Amu
+// Description:
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/go-connections/nat"
+)
+
+func TestReconcile(t *testing.T) {
+	manager, _ := NewManager()
+	plan, err := manager.Reconcile(context.Background(), []ContainerSpec{
+		{
+			Name:     "redis",
+			Image:    "redis:7.0.5",
+			Networks: []NetworkAttachment{{Network: "test"}},
+			Ports:    []string{"6379:6379"},
+			Labels:   map[string]string{ServerTypeLabel: DatabaseServer},
+		},
+	}, ReconcileOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("reconcile error: %v", err)
+	}
+	t.Log(plan)
+}
+
+func testInspect() (types.ContainerJSON, *types.ImageInspect) {
+	inspect := types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			Image: "sha256:redis",
+			State: &types.ContainerState{Running: true},
+			HostConfig: &container.HostConfig{
+				Binds:         []string{"/data:/data:rw"},
+				RestartPolicy: container.RestartPolicy{Name: container.RestartPolicyAlways},
+				Resources:     container.Resources{Memory: 512 << 20, NanoCPUs: 1500000000},
+				PortBindings: nat.PortMap{
+					"6379/tcp": {{HostIP: "0.0.0.0", HostPort: "6379"}},
+					"8080/tcp": {{HostIP: "0.0.0.0", HostPort: "20001"}},
+				},
+			},
+		},
+		Config: &container.Config{
+			Env:    []string{"PATH=/usr/bin", "MODE=cluster"},
+			Cmd:    []string{"redis-server"},
+			Labels: map[string]string{"maintainer": "redis", CreatedByProbe: "true"},
+		},
+		NetworkSettings: &types.NetworkSettings{Networks: map[string]*network.EndpointSettings{"test": {}}},
+	}
+	image := &types.ImageInspect{
+		ID:     "sha256:redis",
+		Config: &container.Config{Env: []string{"PATH=/usr/bin"}, Labels: map[string]string{"maintainer": "redis"}},
+	}
+	return inspect, image
+}
+
+func TestContainerDiff(t *testing.T) {
+	spec := managedSpec(ContainerSpec{
+		Name:     "redis",
+		Image:    "redis:7.0.5",
+		Networks: []NetworkAttachment{{Network: "test"}},
+		Ports:    []string{"6379:6379", "auto:8080"},
+		Volumes:  []string{"/data:/data"},
+		Env:      []string{"MODE=cluster"},
+		Cmd:      []string{"redis-server"},
+		Memory:   512 << 20,
+		CPUs:     1.5,
+	})
+	inspect, image := testInspect()
+	if reasons := containerDiff(spec, inspect, image); len(reasons) != 0 {
+		t.Errorf("expected no diff, got %v", reasons)
+	}
+
+	changed := spec
+	changed.Env = []string{"MODE=standalone"}
+	changed.Ports = []string{"6380:6379", "auto:8080"}
+	changed.Networks = []NetworkAttachment{{Network: "prod"}}
+	reasons := containerDiff(changed, inspect, &types.ImageInspect{ID: "sha256:new", Config: image.Config})
+	expected := "image redis:7.0.5 changed; env changed; ports changed; networks changed"
+	if strings.Join(reasons, "; ") != expected {
+		t.Errorf("unexpected reasons: %v", reasons)
+	}
+
+	changed = spec
+	changed.RestartPolicy = "on-failure:3"
+	changed.Memory = 1 << 30
+	changed.CPUs = 2
+	reasons = containerDiff(changed, inspect, image)
+	if expected := "restart policy changed; memory changed; cpus changed"; strings.Join(reasons, "; ") != expected {
+		t.Errorf("unexpected reasons: %v", reasons)
+	}
+
+	if reasons := containerDiff(spec, inspect, nil); len(reasons) == 0 || !strings.Contains(reasons[0], "not present") {
+		t.Errorf("expected missing image reason, got %v", reasons)
+	}
+}
+
+func TestReconcilePlanString(t *testing.T) {
+	plan := &ReconcilePlan{Steps: []ReconcileStep{
+		{Action: ReconcileRecreate, Name: "redis", Reasons: []string{"env changed"}},
+		{Action: ReconcileKeep, Name: "nginx"},
+	}}
+	if !plan.Changed() {
+		t.Error("expected changed plan")
+	}
+	if plan.String() != "~ recreate redis (env changed)\n= keep nginx\n" {
+		t.Errorf("unexpected plan output: %q", plan.String())
+	}
+}
+
+func TestReconcileRecreateRestoresOnFailure(t *testing.T) {
+	oldID, newID, restoredID := strings.Repeat("a", 64), strings.Repeat("b", 64), strings.Repeat("c", 64)
+	var (
+		mu       sync.Mutex
+		requests []string
+		images   []string
+	)
+	m := newFakeDaemonManager(t, func(w http.ResponseWriter, r *http.Request) {
+		path := r.URL.Path[strings.Index(r.URL.Path[1:], "/")+1:]
+		mu.Lock()
+		requests = append(requests, r.Method+" "+path)
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == http.MethodGet && path == "/images/redis:7/json":
+			_, _ = w.Write([]byte(`{"Id":"sha256:new"}`))
+		case r.Method == http.MethodGet && path == "/containers/"+oldID+"/json":
+			_, _ = w.Write([]byte(`{"Id":"` + oldID + `","Name":"/redis","State":{"Running":true},
+				"Config":{"Image":"redis:6","Labels":{"created.by.probe":"true"}},"HostConfig":{"NetworkMode":"default"},
+				"NetworkSettings":{"Networks":{}}}`))
+		case r.Method == http.MethodGet && (path == "/containers/"+newID+"/json" || path == "/containers/"+restoredID+"/json"):
+			_, _ = w.Write([]byte(`{"Id":"` + strings.Split(path, "/")[2] + `"}`))
+		case r.Method == http.MethodDelete:
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == http.MethodPost && path == "/containers/create":
+			var config container.Config
+			_ = json.NewDecoder(r.Body).Decode(&config)
+			mu.Lock()
+			images = append(images, config.Image)
+			id := newID
+			if len(images) > 1 {
+				id = restoredID
+			}
+			mu.Unlock()
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"Id":"` + id + `"}`))
+		case r.Method == http.MethodPost && path == "/containers/"+newID+"/start":
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte(`{"message":"port is already allocated"}`))
+		case r.Method == http.MethodPost && path == "/containers/"+restoredID+"/start":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"message":"not found"}`))
+		}
+	})
+
+	spec := managedSpec(ContainerSpec{Name: "redis", Image: "redis:7"})
+	step := &ReconcileStep{Action: ReconcileRecreate, Name: "redis", ContainerID: oldID, spec: &spec}
+	err := m.applyReconcileStep(context.Background(), step)
+	if err == nil || !strings.Contains(err.Error(), "port is already allocated") || !strings.Contains(err.Error(), "restored") {
+		t.Fatalf("err = %v", err)
+	}
+	if step.ContainerID != restoredID {
+		t.Errorf("container id = %s", step.ContainerID)
+	}
+	if !reflect.DeepEqual(images, []string{"redis:7", "redis:6"}) {
+		t.Errorf("created images = %v", images)
+	}
+	var deleted []string
+	for _, r := range requests {
+		if strings.HasPrefix(r, http.MethodDelete) {
+			deleted = append(deleted, r)
+		}
+	}
+	if want := []string{"DELETE /containers/" + oldID, "DELETE /containers/" + newID}; !reflect.DeepEqual(deleted, want) {
+		t.Errorf("deleted = %v", deleted)
+	}
+}
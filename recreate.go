@@ -0,0 +1,332 @@
+// Package docker
+// Date: 2024/08/06 09:51:33
+// Author: Amu
+// Description:
+package docker
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/versions"
+)
+
+// createConfig 重新创建容器所需的全部配置
+type createConfig struct {
+	Config           *container.Config
+	HostConfig       *container.HostConfig
+	NetworkingConfig *network.NetworkingConfig
+	ExtraNetworks    map[string]*network.EndpointSettings // API 1.44 之前需要在创建后再连接的网络
+}
+
+// createConfigFromInspect 将 ContainerInspect 的结果还原为创建参数, 去掉 daemon 生成的运行时数据
+// (默认主机名、网络地址、以容器 ID 命名的别名等)。imageConfig 为容器当前镜像的配置,
+// 与其相同的环境变量、标签、命令和入口会被清除, 以便新镜像的默认值生效
+func createConfigFromInspect(inspect types.ContainerJSON, imageConfig *container.Config, apiVersion string) *createConfig {
+	config := *inspect.Config
+	if len(inspect.ID) >= 12 && config.Hostname == inspect.ID[:12] {
+		config.Hostname = ""
+	}
+	if imageConfig != nil {
+		config.Env = withoutImageEnv(config.Env, imageConfig.Env)
+		config.Labels = withoutImageLabels(config.Labels, imageConfig.Labels)
+		if strings.Join(config.Cmd, "\x00") == strings.Join(imageConfig.Cmd, "\x00") {
+			config.Cmd = nil
+		}
+		if strings.Join(config.Entrypoint, "\x00") == strings.Join(imageConfig.Entrypoint, "\x00") {
+			config.Entrypoint = nil
+		}
+		if config.WorkingDir == imageConfig.WorkingDir {
+			config.WorkingDir = ""
+		}
+		if config.User == imageConfig.User {
+			config.User = ""
+		}
+	}
+
+	hostConfig := *inspect.HostConfig
+	result := &createConfig{
+		Config:           &config,
+		HostConfig:       &hostConfig,
+		NetworkingConfig: &network.NetworkingConfig{EndpointsConfig: make(map[string]*network.EndpointSettings)},
+		ExtraNetworks:    make(map[string]*network.EndpointSettings),
+	}
+	if inspect.NetworkSettings == nil {
+		return result
+	}
+
+	primary := hostConfig.NetworkMode.NetworkName()
+	if primary == network.NetworkDefault {
+		primary = network.NetworkBridge
+	}
+	for name, endpoint := range inspect.NetworkSettings.Networks {
+		if endpoint == nil {
+			continue
+		}
+		settings := &network.EndpointSettings{
+			Links:      endpoint.Links,
+			DriverOpts: endpoint.DriverOpts,
+			NetworkID:  endpoint.NetworkID,
+		}
+		if endpoint.IPAMConfig != nil {
+			ipam := *endpoint.IPAMConfig
+			settings.IPAMConfig = &ipam
+		}
+		for _, alias := range endpoint.Aliases {
+			if len(inspect.ID) >= 12 && alias == inspect.ID[:12] {
+				continue
+			}
+			settings.Aliases = append(settings.Aliases, alias)
+		}
+		if name == primary || !versions.LessThan(apiVersion, "1.44") {
+			result.NetworkingConfig.EndpointsConfig[name] = settings
+		} else {
+			result.ExtraNetworks[name] = settings
+		}
+	}
+	return result
+}
+
+// reuseAnonymousVolumes 将旧容器的匿名卷(镜像的 VOLUME 或 -v /data)按卷名挂载到重建的容器,
+// 否则重建的容器会得到新的空卷。已由 Binds 或 Mounts 指定的挂载点不变; 克隆容器时不应调用
+func reuseAnonymousVolumes(cfg *createConfig, mounts []types.MountPoint) {
+	covered := make(map[string]bool)
+	for _, bind := range cfg.HostConfig.Binds {
+		if parts := strings.Split(bind, ":"); len(parts) >= 2 {
+			covered[path.Clean(parts[1])] = true
+		}
+	}
+	for _, m := range cfg.HostConfig.Mounts {
+		covered[path.Clean(m.Target)] = true
+	}
+	result := slices.Clone(cfg.HostConfig.Mounts)
+	for _, mp := range mounts {
+		if mp.Type != mount.TypeVolume || mp.Name == "" || covered[path.Clean(mp.Destination)] {
+			continue
+		}
+		result = append(result, mount.Mount{
+			Type:     mount.TypeVolume,
+			Source:   mp.Name,
+			Target:   mp.Destination,
+			ReadOnly: !mp.RW,
+		})
+	}
+	cfg.HostConfig.Mounts = result
+}
+
+func withoutImageEnv(envs, imageEnvs []string) []string {
+	defaults := make(map[string]bool, len(imageEnvs))
+	for _, env := range imageEnvs {
+		defaults[env] = true
+	}
+	var result []string
+	for _, env := range envs {
+		if !defaults[env] {
+			result = append(result, env)
+		}
+	}
+	return result
+}
+
+func withoutImageLabels(labels, imageLabels map[string]string) map[string]string {
+	result := make(map[string]string, len(labels))
+	for k, v := range labels {
+		if iv, ok := imageLabels[k]; ok && iv == v {
+			continue
+		}
+		result[k] = v
+	}
+	return result
+}
+
+// inspectForRecreate 读取容器及其镜像的配置
+func (m *Manager) inspectForRecreate(ctx context.Context, containerID string) (types.ContainerJSON, *container.Config, error) {
+	inspect, err := m.client.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return types.ContainerJSON{}, nil, err
+	}
+	var imageConfig *container.Config
+	if im, _, err := m.client.ImageInspectWithRaw(ctx, inspect.Image); err == nil {
+		imageConfig = im.Config
+	}
+	return inspect, imageConfig, nil
+}
+
+// createFromConfig 按 createConfig 创建容器并连接剩余的网络
+func (m *Manager) createFromConfig(ctx context.Context, cfg *createConfig, name string) (string, error) {
+	resp, err := m.client.ContainerCreate(ctx, cfg.Config, cfg.HostConfig, cfg.NetworkingConfig, nil, name)
+	if err != nil {
+		return "", err
+	}
+	for _, w := range resp.Warnings {
+		fmt.Printf("Container Create Warning: %s\n", w)
+	}
+	for networkName, settings := range cfg.ExtraNetworks {
+		if err := m.client.NetworkConnect(ctx, networkName, resp.ID, settings); err != nil {
+			_ = m.client.ContainerRemove(ctx, resp.ID, container.RemoveOptions{Force: true})
+			return "", err
+		}
+	}
+	return resp.ID, nil
+}
+
+// rollbackTimeout 回滚操作的超时时间
+const rollbackTimeout = time.Minute
+
+// rollbackContext 返回用于回滚和收尾的 ctx: 调用方取消或超时往往正是回滚的原因, 回滚仍需完成
+func rollbackContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.WithoutCancel(ctx), rollbackTimeout)
+}
+
+// UpgradeIncompleteError 新容器已健康运行, 但删除旧容器或将新容器改为原名称失败。
+// 此时旧容器已停止, 新容器以 <name>-upgrade-<时间戳> 运行, 需要手动删除 OldID 并重命名 NewID
+type UpgradeIncompleteError struct {
+	Name  string
+	OldID string
+	NewID string
+	Err   error
+}
+
+func (e *UpgradeIncompleteError) Error() string {
+	return fmt.Sprintf("upgrade %s incomplete: new container %s is running but old container %s was not replaced: %v", e.Name, e.NewID, e.OldID, e.Err)
+}
+
+func (e *UpgradeIncompleteError) Unwrap() error {
+	return e.Err
+}
+
+// UpgradeOptions 滚动升级的参数
+type UpgradeOptions struct {
+	HealthTimeout time.Duration // 等待新容器健康的最长时间, 为 0 时为 2 分钟
+	MinUptime     time.Duration // 没有健康检查时, 新容器需持续运行的时间, 为 0 时为 10 秒
+	StopTimeout   *int          // 停止旧容器的超时时间(秒), 为 nil 时使用容器的配置
+	SkipPull      bool          // 不拉取镜像, 直接使用本地镜像
+}
+
+func (m *Manager) UpgradeContainer(ctx context.Context, containerID, newImage string) (string, error) {
+	return m.UpgradeContainerWithOptions(ctx, containerID, newImage, UpgradeOptions{})
+}
+
+// UpgradeContainerWithOptions 使用 newImage 替换容器: 以原有配置创建新容器, 停止旧容器并启动新容器,
+// 新容器健康后删除旧容器并将新容器改为原名称; 新容器启动失败或不健康时删除新容器并重新启动旧容器。
+// 旧容器的匿名卷由新容器继续使用; 删除旧容器或重命名失败时返回 *UpgradeIncompleteError
+func (m *Manager) UpgradeContainerWithOptions(ctx context.Context, containerID, newImage string, opts UpgradeOptions) (id string, err error) {
+	defer m.invalidate()
+	defer m.audit(ctx, "UpgradeContainerWithOptions", auditArgs{"container": containerID, "image": newImage, "options": opts}).done(&id, &err)
+	containerID, err = m.ResolveContainer(ctx, containerID)
+	if err != nil {
+		return "", err
+	}
+	if !opts.SkipPull {
+		if err := m.PullImage(ctx, newImage); err != nil {
+			return "", err
+		}
+	}
+	inspect, imageConfig, err := m.inspectForRecreate(ctx, containerID)
+	if err != nil {
+		return "", err
+	}
+	name := strings.TrimPrefix(inspect.Name, "/")
+	wasRunning := inspect.State != nil && inspect.State.Running
+
+	cfg := createConfigFromInspect(inspect, imageConfig, m.client.ClientVersion())
+	cfg.Config.Image = newImage
+	reuseAnonymousVolumes(cfg, inspect.Mounts)
+	newID, err := m.createFromConfig(ctx, cfg, fmt.Sprintf("%s-upgrade-%d", name, time.Now().Unix()))
+	if err != nil {
+		return "", err
+	}
+
+	rollback := func(cause error) (string, error) {
+		ctx, cancel := rollbackContext(ctx)
+		defer cancel()
+		_ = m.client.ContainerRemove(ctx, newID, container.RemoveOptions{Force: true})
+		if wasRunning {
+			if err := m.client.ContainerStart(ctx, containerID, container.StartOptions{}); err != nil {
+				return "", fmt.Errorf("upgrade %s failed: %w; rollback failed: %v", name, cause, err)
+			}
+		}
+		return "", fmt.Errorf("upgrade %s failed and was rolled back: %w", name, cause)
+	}
+
+	if wasRunning {
+		if err := m.client.ContainerStop(ctx, containerID, container.StopOptions{Timeout: opts.StopTimeout}); err != nil {
+			return rollback(err)
+		}
+	}
+	if err := m.client.ContainerStart(ctx, newID, container.StartOptions{}); err != nil {
+		return rollback(err)
+	}
+	if err := m.waitHealthy(ctx, newID, opts.HealthTimeout, opts.MinUptime); err != nil {
+		return rollback(err)
+	}
+
+	// 新容器已经健康, 收尾不应因调用方取消而中断
+	finishCtx, cancel := rollbackContext(ctx)
+	defer cancel()
+	if err := m.client.ContainerRemove(finishCtx, containerID, container.RemoveOptions{Force: true}); err != nil {
+		return newID, &UpgradeIncompleteError{Name: name, OldID: containerID, NewID: newID, Err: err}
+	}
+	if err := m.client.ContainerRename(finishCtx, newID, name); err != nil {
+		return newID, &UpgradeIncompleteError{Name: name, OldID: containerID, NewID: newID, Err: err}
+	}
+	return newID, nil
+}
+
+// waitHealthy 等待容器健康: 有健康检查时等待 healthy, 否则要求容器自上次启动(State.StartedAt)起持续运行 minUptime。
+// 容器处于 restarting 说明已经退出过, 视为不健康
+func (m *Manager) waitHealthy(ctx context.Context, containerID string, timeout, minUptime time.Duration) error {
+	if timeout == 0 {
+		timeout = 2 * time.Minute
+	}
+	if minUptime == 0 {
+		minUptime = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		inspect, err := m.client.ContainerInspect(ctx, containerID)
+		if err != nil {
+			return err
+		}
+		state := inspect.State
+		switch {
+		case state == nil:
+			return fmt.Errorf("container %s has no state", containerID)
+		case !state.Running:
+			return fmt.Errorf("container %s exited with code %d", containerID, state.ExitCode)
+		case state.Restarting:
+			return fmt.Errorf("container %s is restarting, last exit code %d", containerID, state.ExitCode)
+		case state.Health != nil && state.Health.Status == types.Healthy:
+			return nil
+		case state.Health != nil && state.Health.Status == types.Unhealthy:
+			return fmt.Errorf("container %s is unhealthy", containerID)
+		case state.Health == nil:
+			// 按重启策略重启过的容器 StartedAt 会更新, 运行时间重新计算
+			startedAt, err := time.Parse(time.RFC3339Nano, state.StartedAt)
+			if err != nil {
+				return fmt.Errorf("container %s has invalid start time %q: %w", containerID, state.StartedAt, err)
+			}
+			if time.Since(startedAt) >= minUptime {
+				return nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("container %s did not become healthy: %w", containerID, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,238 @@
+// Package docker
+// Date: 2024/08/06 09:52:10
+// Author: Amu
+// Description:
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/network"
+)
+
+func TestUpgradeContainer(t *testing.T) {
+	manager, _ := NewManager()
+	containerID, err := manager.UpgradeContainer(context.Background(), "redis", "redis:7.2")
+	if err != nil {
+		t.Fatalf("upgrade container error: %v", err)
+	}
+	t.Logf("new container id: %s", containerID)
+}
+
+func TestCreateConfigFromInspect(t *testing.T) {
+	inspect := types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			ID:         "5c28bf6e16be0123456789",
+			HostConfig: &container.HostConfig{NetworkMode: "test", Binds: []string{"/data:/data:rw"}},
+		},
+		Config: &container.Config{
+			Hostname: "5c28bf6e16be",
+			Image:    "redis:7.0.5",
+			Env:      []string{"PATH=/usr/bin", "MODE=cluster"},
+			Cmd:      []string{"redis-server"},
+			Labels:   map[string]string{"maintainer": "redis", CreatedByProbe: "true"},
+		},
+		NetworkSettings: &types.NetworkSettings{Networks: map[string]*network.EndpointSettings{
+			"test": {
+				NetworkID:  "7be8e024bcb5",
+				Aliases:    []string{"cache", "5c28bf6e16be"},
+				IPAMConfig: &network.EndpointIPAMConfig{IPv4Address: "172.20.0.10"},
+				IPAddress:  "172.20.0.10",
+				MacAddress: "02:42:ac:14:00:0a",
+			},
+			"backend": {NetworkID: "a1b2c3d4e5f6"},
+		}},
+	}
+	imageConfig := &container.Config{
+		Env:    []string{"PATH=/usr/bin"},
+		Cmd:    []string{"redis-server"},
+		Labels: map[string]string{"maintainer": "redis"},
+	}
+
+	cfg := createConfigFromInspect(inspect, imageConfig, "1.43")
+	if cfg.Config.Hostname != "" || cfg.Config.Cmd != nil {
+		t.Errorf("generated hostname and image cmd should be cleared: %#v", cfg.Config)
+	}
+	if len(cfg.Config.Env) != 1 || cfg.Config.Env[0] != "MODE=cluster" {
+		t.Errorf("unexpected env: %v", cfg.Config.Env)
+	}
+	if _, ok := cfg.Config.Labels["maintainer"]; ok || cfg.Config.Labels[CreatedByProbe] != "true" {
+		t.Errorf("unexpected labels: %v", cfg.Config.Labels)
+	}
+	endpoint := cfg.NetworkingConfig.EndpointsConfig["test"]
+	if endpoint == nil || len(endpoint.Aliases) != 1 || endpoint.Aliases[0] != "cache" || endpoint.IPAddress != "" || endpoint.MacAddress != "" {
+		t.Errorf("unexpected primary endpoint: %#v", endpoint)
+	}
+	if endpoint.IPAMConfig.IPv4Address != "172.20.0.10" {
+		t.Errorf("static address not kept: %#v", endpoint.IPAMConfig)
+	}
+	if _, ok := cfg.ExtraNetworks["backend"]; !ok || len(cfg.NetworkingConfig.EndpointsConfig) != 1 {
+		t.Errorf("backend network should be connected after create on old api")
+	}
+
+	cfg = createConfigFromInspect(inspect, imageConfig, "1.45")
+	if len(cfg.NetworkingConfig.EndpointsConfig) != 2 || len(cfg.ExtraNetworks) != 0 {
+		t.Errorf("all networks should be attached at create on new api")
+	}
+}
+
+func TestReuseAnonymousVolumes(t *testing.T) {
+	cfg := &createConfig{HostConfig: &container.HostConfig{
+		Binds:  []string{"conf:/etc/redis:ro"},
+		Mounts: []mount.Mount{{Type: mount.TypeTmpfs, Target: "/tmp"}},
+	}}
+	reuseAnonymousVolumes(cfg, []types.MountPoint{
+		{Type: mount.TypeVolume, Name: "conf", Destination: "/etc/redis"},
+		{Type: mount.TypeVolume, Name: "3f2a9c", Destination: "/data", RW: true},
+		{Type: mount.TypeVolume, Name: "7b1e04", Destination: "/logs"},
+		{Type: mount.TypeBind, Source: "/srv", Destination: "/srv", RW: true},
+	})
+	want := []mount.Mount{
+		{Type: mount.TypeTmpfs, Target: "/tmp"},
+		{Type: mount.TypeVolume, Source: "3f2a9c", Target: "/data"},
+		{Type: mount.TypeVolume, Source: "7b1e04", Target: "/logs", ReadOnly: true},
+	}
+	if !reflect.DeepEqual(cfg.HostConfig.Mounts, want) {
+		t.Errorf("mounts = %+v, want %+v", cfg.HostConfig.Mounts, want)
+	}
+}
+
+// upgradeDaemon 模拟滚动升级用到的接口, 记录请求
+type upgradeDaemon struct {
+	oldID      string
+	removeErr  bool   // 删除旧容器失败
+	onStartNew func() // 启动新容器时调用
+	mu         sync.Mutex
+	requests   []string
+	created    container.HostConfig
+}
+
+func (d *upgradeDaemon) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Path[strings.Index(r.URL.Path[1:], "/")+1:]
+	d.mu.Lock()
+	d.requests = append(d.requests, r.Method+" "+path)
+	d.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	old := "/containers/" + d.oldID
+	switch r.Method + " " + path {
+	case "GET " + old + "/json":
+		_, _ = w.Write([]byte(`{"Id":"` + d.oldID + `","Name":"/redis","Image":"sha256:old","State":{"Running":true},
+			"Config":{"Image":"redis:7.0","Volumes":{"/data":{}}},"HostConfig":{"NetworkMode":"bridge"},
+			"Mounts":[{"Type":"volume","Name":"3f2a9c","Destination":"/data","RW":true}]}`))
+	case "GET /images/sha256:old/json":
+		_, _ = w.Write([]byte(`{"Id":"sha256:old","Config":{}}`))
+	case "POST /containers/create":
+		var body struct {
+			HostConfig container.HostConfig
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		d.mu.Lock()
+		d.created = body.HostConfig
+		d.mu.Unlock()
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"Id":"new"}`))
+	case "POST /containers/new/start":
+		if d.onStartNew != nil {
+			d.onStartNew()
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case "GET /containers/new/json":
+		_, _ = w.Write([]byte(`{"Id":"new","State":{"Running":true,"Health":{"Status":"healthy"}}}`))
+	case "DELETE " + old:
+		if d.removeErr {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte(`{"message":"removal in progress"}`))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case "POST " + old + "/stop", "POST " + old + "/start", "DELETE /containers/new", "POST /containers/new/rename":
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"message":"not found"}`))
+	}
+}
+
+func (d *upgradeDaemon) requested(req string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, r := range d.requests {
+		if r == req {
+			return true
+		}
+	}
+	return false
+}
+
+func TestUpgradeContainerWithOptions(t *testing.T) {
+	oldID := strings.Repeat("a", 64)
+	opts := UpgradeOptions{SkipPull: true}
+
+	daemon := &upgradeDaemon{oldID: oldID}
+	m := newFakeDaemonManager(t, daemon.ServeHTTP)
+	id, err := m.UpgradeContainerWithOptions(context.Background(), oldID, "redis:7.2", opts)
+	if err != nil || id != "new" || !daemon.requested("POST /containers/new/rename") {
+		t.Fatalf("id = %q, err = %v", id, err)
+	}
+	// 匿名卷由新容器继续使用
+	if want := []mount.Mount{{Type: mount.TypeVolume, Source: "3f2a9c", Target: "/data"}}; !reflect.DeepEqual(daemon.created.Mounts, want) {
+		t.Errorf("mounts = %+v, want %+v", daemon.created.Mounts, want)
+	}
+
+	// 调用方取消后仍然回滚
+	ctx, cancel := context.WithCancel(context.Background())
+	daemon = &upgradeDaemon{oldID: oldID, onStartNew: cancel}
+	m = newFakeDaemonManager(t, daemon.ServeHTTP)
+	if _, err := m.UpgradeContainerWithOptions(ctx, oldID, "redis:7.2", opts); !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v", err)
+	}
+	if !daemon.requested("DELETE /containers/new") || !daemon.requested("POST /containers/"+oldID+"/start") {
+		t.Errorf("not rolled back: %v", daemon.requests)
+	}
+
+	// 删除旧容器失败时返回两个容器的 ID
+	daemon = &upgradeDaemon{oldID: oldID, removeErr: true}
+	m = newFakeDaemonManager(t, daemon.ServeHTTP)
+	id, err = m.UpgradeContainerWithOptions(context.Background(), oldID, "redis:7.2", opts)
+	var incomplete *UpgradeIncompleteError
+	if !errors.As(err, &incomplete) || incomplete.OldID != oldID || incomplete.NewID != "new" || id != "new" {
+		t.Errorf("id = %q, err = %v", id, err)
+	}
+}
+
+func TestWaitHealthy(t *testing.T) {
+	var state string
+	m := newFakeDaemonManager(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"Id":"new","State":` + state + `}`))
+	})
+	startedAt := func(d time.Duration) string {
+		return time.Now().Add(-d).UTC().Format(time.RFC3339Nano)
+	}
+
+	// 按重启策略重启中的容器不健康
+	state = `{"Running":true,"Restarting":true,"ExitCode":1,"StartedAt":"` + startedAt(time.Hour) + `"}`
+	if err := m.waitHealthy(context.Background(), "new", time.Second, 10*time.Second); err == nil || !strings.Contains(err.Error(), "restarting") {
+		t.Errorf("restarting: err = %v", err)
+	}
+	// 运行时间从 StartedAt 起计算
+	state = `{"Running":true,"StartedAt":"` + startedAt(time.Minute) + `"}`
+	if err := m.waitHealthy(context.Background(), "new", time.Second, 10*time.Second); err != nil {
+		t.Errorf("started a minute ago: err = %v", err)
+	}
+	state = `{"Running":true,"StartedAt":"` + startedAt(0) + `"}`
+	if err := m.waitHealthy(context.Background(), "new", 100*time.Millisecond, 10*time.Second); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("just started: err = %v", err)
+	}
+}
@@ -0,0 +1,342 @@
+// Package docker
+// Date: 2024/08/19 10:05:44
+// Author: Amu
+// Description:
+package docker
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
+)
+
+// RetryPolicy 调用失败时的重试策略, 零值字段使用 DefaultRetryPolicy 中的值
+type RetryPolicy struct {
+	MaxAttempts    int                              // 最多尝试的次数, 包括第一次
+	InitialBackoff time.Duration                    // 第一次重试前的等待时间
+	MaxBackoff     time.Duration                    // 等待时间的上限
+	Multiplier     float64                          // 每次重试后等待时间的倍数
+	Jitter         float64                          // 等待时间随机浮动的比例, 0.2 表示在 ±20% 内浮动
+	Retryable      func(call *Call, err error) bool // 判断失败的调用是否可以重试, 默认为 RetryableCall
+}
+
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    4,
+		InitialBackoff: 200 * time.Millisecond,
+		MaxBackoff:     5 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.2,
+		Retryable:      RetryableCall,
+	}
+}
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	def := DefaultRetryPolicy()
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = def.MaxAttempts
+	}
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = def.InitialBackoff
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = def.MaxBackoff
+	}
+	if p.Multiplier < 1 {
+		p.Multiplier = def.Multiplier
+	}
+	if p.Jitter < 0 || p.Jitter > 1 {
+		p.Jitter = def.Jitter
+	}
+	if p.Retryable == nil {
+		p.Retryable = def.Retryable
+	}
+	return p
+}
+
+// backoff 返回第 retry 次重试(从 1 开始)前的等待时间, random 返回 [0, 1) 的随机数
+func (p RetryPolicy) backoff(retry int, random func() float64) time.Duration {
+	d := float64(p.InitialBackoff)
+	for i := 1; i < retry && d < float64(p.MaxBackoff); i++ {
+		d *= p.Multiplier
+	}
+	if d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+	d *= 1 + p.Jitter*(2*random()-1)
+	return time.Duration(d)
+}
+
+// IsRetryable 判断错误是否由 daemon 暂时不可用引起: 连接失败、连接中断、超时(含 context.DeadlineExceeded)和 5xx 响应可以重试;
+// 4xx 响应、本库的参数和状态错误、context 取消以及没有权限访问 daemon 不重试。
+// 调用方的 ctx 已经结束时不应重试, RetryInterceptor 和 CircuitBreaker 会先检查 ctx
+func IsRetryable(err error) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, context.Canceled):
+		return false
+	case errors.Is(err, context.DeadlineExceeded):
+		// 单次调用的超时, 如 TimeoutInterceptor 或 Pool 的主机超时; 调用方的 ctx 是否结束需由调用方判断
+		return true
+	case errors.Is(err, ErrNotFound), errors.Is(err, ErrAmbiguous), errors.Is(err, ErrInUse), errors.Is(err, ErrInvalid),
+		errors.Is(err, ErrCircuitOpen), errors.Is(err, ErrUnschedulable):
+		return false
+	case errors.Is(err, os.ErrPermission):
+		return false
+	case errdefs.IsNotFound(err), errdefs.IsInvalidParameter(err), errdefs.IsConflict(err), errdefs.IsUnauthorized(err),
+		errdefs.IsForbidden(err), errdefs.IsNotModified(err), errdefs.IsNotImplemented(err):
+		return false
+	case client.IsErrConnectionFailed(err):
+		return true
+	case errdefs.IsUnavailable(err), errdefs.IsSystem(err), errdefs.IsDeadline(err):
+		return true
+	case errors.Is(err, syscall.ECONNREFUSED), errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.EPIPE),
+		errors.Is(err, io.ErrUnexpectedEOF):
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// idempotentOperations 只读或重复执行结果相同的操作。创建、删除、复制到容器等操作超时或连接中断时
+// 可能已经在 daemon 上完成, 重试会因名称冲突失败、重新读取已被消费的 io.Reader 或再次重启容器, 因此不在其中
+var idempotentOperations = map[string]bool{
+	"Version": true, "SystemInfo": true, "DiskUsage": true, "Topology": true,
+	"ListContainer": true, "ListContainerStatus": true, "ResolveContainer": true, "GetContainerIDByContainerName": true,
+	"ContainerExists": true, "HasSameNameContainer": true, "GetContainerStatus": true, "GetContainerStats": true,
+	"GetContainerCpu": true, "GetContainerMem": true, "ContainerProcesses": true, "ContainerChanges": true,
+	"ContainerLogs": true, "ContainerLogsWithOptions": true, "ContainerToSpec": true, "GenerateCompose": true,
+	"StatContainerPath": true, "ReadFileFromContainer": true, "CopyFromContainer": true, "InspectExec": true,
+	"ListImage": true, "GetImageByID": true, "GetImageByName": true, "SearchImage": true,
+	"ListNetwork": true, "GetNetworkByID": true, "HasSameNameNetwork": true, "NextFreeSubnet": true,
+	"StartContainer": true, "StopContainer": true, "ResizeContainerTTY": true,
+	"ResizeExecTTY": true, "PullImage": true, "TagImage": true,
+}
+
+// IsIdempotent 判断操作是否只读或可以安全地重复执行
+func IsIdempotent(operation string) bool {
+	return idempotentOperations[operation]
+}
+
+// RetryableCall 只重试 IsIdempotent 的操作, 且错误满足 IsRetryable
+func RetryableCall(call *Call, err error) bool {
+	return IsIdempotent(call.Operation) && IsRetryable(err)
+}
+
+// RetryInterceptor 按 policy 重试失败的调用, 等待期间 ctx 结束时返回最后一次的错误。
+// 默认只重试只读或幂等的操作, 需要重试其他操作时在 policy.Retryable 中自行判断。
+// 与 CircuitBreaker 同时使用时应放在其外层, 断路器打开后返回的 ErrCircuitOpen 不会重试
+func RetryInterceptor(policy RetryPolicy) Interceptor {
+	policy = policy.withDefaults()
+	var mu sync.Mutex
+	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+	random := func() float64 {
+		mu.Lock()
+		defer mu.Unlock()
+		return rnd.Float64()
+	}
+	return func(ctx context.Context, call *Call, next Invoker) error {
+		var err error
+		for attempt := 1; ; attempt++ {
+			err = next(ctx, call)
+			if err == nil || ctx.Err() != nil || attempt >= policy.MaxAttempts || !policy.Retryable(call, err) {
+				return err
+			}
+			timer := time.NewTimer(policy.backoff(attempt, random))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return err
+			case <-timer.C:
+			}
+		}
+	}
+}
+
+// BreakerState 断路器的状态
+type BreakerState string
+
+const (
+	BreakerClosed   BreakerState = "closed"    // 正常放行
+	BreakerOpen     BreakerState = "open"      // 直接返回 ErrCircuitOpen
+	BreakerHalfOpen BreakerState = "half-open" // 放行一次探测调用, 成功后关闭, 失败后重新打开
+)
+
+// BreakerHealth 断路器的当前状态, 用于健康检查
+type BreakerHealth struct {
+	State     BreakerState `json:"state"`
+	Failures  int          `json:"failures"`             // 连续失败的次数
+	OpenedAt  *time.Time   `json:"opened_at,omitempty"`  // 最近一次打开的时间, 从未打开时为 nil
+	RetryAt   *time.Time   `json:"retry_at,omitempty"`   // 打开状态下允许探测调用的时间
+	LastError string       `json:"last_error,omitempty"` // 最近一次计为失败的错误
+}
+
+// CircuitBreaker 连续失败达到阈值后打开, 在 daemon 不可用期间让调用立即失败
+type CircuitBreaker struct {
+	threshold   int
+	openTimeout time.Duration
+	isFailure   func(error) bool
+	now         func() time.Time
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	lastErr  error
+	probing  bool
+}
+
+type BreakerOption func(*CircuitBreaker)
+
+// WithFailureThreshold 设置打开断路器所需的连续失败次数, 默认为 5
+func WithFailureThreshold(n int) BreakerOption {
+	return func(b *CircuitBreaker) {
+		if n > 0 {
+			b.threshold = n
+		}
+	}
+}
+
+// WithOpenTimeout 设置断路器打开后到允许探测调用的时间, 默认为 30 秒
+func WithOpenTimeout(timeout time.Duration) BreakerOption {
+	return func(b *CircuitBreaker) {
+		if timeout > 0 {
+			b.openTimeout = timeout
+		}
+	}
+}
+
+// WithFailureClassifier 设置哪些错误计为失败, 默认为 IsRetryable, 即 404 等调用方错误不会打开断路器
+func WithFailureClassifier(isFailure func(error) bool) BreakerOption {
+	return func(b *CircuitBreaker) {
+		if isFailure != nil {
+			b.isFailure = isFailure
+		}
+	}
+}
+
+func NewCircuitBreaker(opts ...BreakerOption) *CircuitBreaker {
+	b := &CircuitBreaker{
+		threshold:   5,
+		openTimeout: 30 * time.Second,
+		isFailure:   IsRetryable,
+		now:         time.Now,
+		state:       BreakerClosed,
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// Interceptor 返回使用该断路器的拦截器, 同一个断路器可以用于多个 IManager
+func (b *CircuitBreaker) Interceptor() Interceptor {
+	return func(ctx context.Context, call *Call, next Invoker) error {
+		probe, err := b.allow()
+		if err != nil {
+			return err
+		}
+		err = next(ctx, call)
+		b.record(ctx, probe, err)
+		return err
+	}
+}
+
+// allow 判断是否放行调用, 半开状态下只放行一次探测调用
+func (b *CircuitBreaker) allow() (probe bool, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == BreakerOpen && !b.now().Before(b.openedAt.Add(b.openTimeout)) {
+		b.state = BreakerHalfOpen
+	}
+	switch b.state {
+	case BreakerOpen:
+		return false, &CircuitOpenError{RetryAt: b.openedAt.Add(b.openTimeout), LastError: b.lastErr}
+	case BreakerHalfOpen:
+		if b.probing {
+			return false, &CircuitOpenError{RetryAt: b.now(), LastError: b.lastErr}
+		}
+		b.probing = true
+		return true, nil
+	}
+	return false, nil
+}
+
+// record 记录调用的结果; 调用方的 ctx 结束时无法判断 daemon 的状态, 单次调用超时而 ctx 仍有效时计为失败
+func (b *CircuitBreaker) record(ctx context.Context, probe bool, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if probe {
+		b.probing = false
+	}
+	if ctx.Err() != nil || errors.Is(err, context.Canceled) {
+		// 调用方放弃了调用
+		return
+	}
+	if err == nil || !b.isFailure(err) {
+		// 调用方错误同样说明 daemon 可以正常响应
+		b.state = BreakerClosed
+		b.failures = 0
+		return
+	}
+	b.failures++
+	b.lastErr = err
+	if probe || b.failures >= b.threshold {
+		b.state = BreakerOpen
+		b.openedAt = b.now()
+	}
+}
+
+// State 返回断路器的当前状态
+func (b *CircuitBreaker) State() BreakerState {
+	return b.Health().State
+}
+
+// Health 返回断路器的当前状态和最近一次失败的信息
+func (b *CircuitBreaker) Health() BreakerHealth {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	health := BreakerHealth{State: b.state, Failures: b.failures}
+	if b.state == BreakerOpen && !b.now().Before(b.openedAt.Add(b.openTimeout)) {
+		health.State = BreakerHalfOpen
+	}
+	if !b.openedAt.IsZero() {
+		openedAt := b.openedAt
+		health.OpenedAt = &openedAt
+	}
+	if health.State == BreakerOpen {
+		retryAt := b.openedAt.Add(b.openTimeout)
+		health.RetryAt = &retryAt
+	}
+	if b.lastErr != nil {
+		health.LastError = b.lastErr.Error()
+	}
+	return health
+}
+
+// CircuitOpenError 断路器打开时返回的错误, 可以用 errors.Is 匹配 ErrCircuitOpen
+type CircuitOpenError struct {
+	RetryAt   time.Time // 允许探测调用的时间
+	LastError error     // 打开断路器前最近一次失败的错误
+}
+
+func (e *CircuitOpenError) Error() string {
+	if e.LastError == nil {
+		return ErrCircuitOpen.Error()
+	}
+	return ErrCircuitOpen.Error() + ": " + e.LastError.Error()
+}
+
+func (e *CircuitOpenError) Unwrap() error {
+	return ErrCircuitOpen
+}
@@ -0,0 +1,272 @@
+// Package docker
+// Date: 2024/08/19 11:20:09
+// Author: Amu
+// Description:
+package docker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
+)
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{client.ErrorConnectionFailed("unix:///var/run/docker.sock"), true},
+		{errdefs.Unavailable(errors.New("daemon is shutting down")), true},
+		{errdefs.System(errors.New("internal server error")), true},
+		{errdefs.Deadline(errors.New("timeout")), true},
+		{&net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}, true},
+		{fmt.Errorf("read: %w", io.ErrUnexpectedEOF), true},
+		{&net.DNSError{Err: "timeout", IsTimeout: true}, true},
+		{errdefs.NotFound(errors.New("no such container")), false},
+		{errdefs.Conflict(errors.New("name in use")), false},
+		{errdefs.InvalidParameter(errors.New("bad request")), false},
+		{errdefs.Unauthorized(errors.New("unauthorized")), false},
+		{fmt.Errorf("container redis: %w", ErrNotFound), false},
+		{invalidArgument(errors.New("bad spec")), false},
+		{context.Canceled, false},
+		{fmt.Errorf("list containers: %w", context.DeadlineExceeded), true},
+		{fmt.Errorf("connect: %w", os.ErrPermission), false},
+		{&CircuitOpenError{}, false},
+		{errors.New("unknown"), false},
+	}
+	for _, tt := range tests {
+		if got := IsRetryable(tt.err); got != tt.want {
+			t.Errorf("IsRetryable(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	p := RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second, Multiplier: 2, Jitter: 0.5}.withDefaults()
+	half := func() float64 { return 0.5 }
+	want := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second}
+	for i, w := range want {
+		if got := p.backoff(i+1, half); got != w {
+			t.Errorf("backoff(%d) = %v, want %v", i+1, got, w)
+		}
+	}
+	if low, high := p.backoff(1, func() float64 { return 0 }), p.backoff(1, func() float64 { return 0.999 }); low != 50*time.Millisecond || high < 149*time.Millisecond {
+		t.Errorf("jitter range = [%v, %v]", low, high)
+	}
+}
+
+func TestRetryInterceptor(t *testing.T) {
+	unavailable := client.ErrorConnectionFailed("")
+	policy := RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+
+	stub := &stubManager{err: unavailable}
+	m := Intercept(stub, RetryInterceptor(policy))
+	if err := m.StartContainer(context.Background(), "redis"); !client.IsErrConnectionFailed(err) {
+		t.Errorf("err = %v", err)
+	}
+	if len(stub.started) != 3 {
+		t.Errorf("attempts = %d, want 3", len(stub.started))
+	}
+
+	stub = &stubManager{err: errdefs.NotFound(errors.New("no such container"))}
+	m = Intercept(stub, RetryInterceptor(policy))
+	_ = m.StartContainer(context.Background(), "redis")
+	if len(stub.started) != 1 {
+		t.Errorf("attempts = %d, want 1", len(stub.started))
+	}
+
+	// 第二次成功后不再重试
+	attempts := 0
+	flaky := func(ctx context.Context, call *Call, next Invoker) error {
+		attempts++
+		if attempts == 1 {
+			return unavailable
+		}
+		return next(ctx, call)
+	}
+	stub = &stubManager{}
+	m = Intercept(stub, RetryInterceptor(policy), flaky)
+	if err := m.StartContainer(context.Background(), "redis"); err != nil || attempts != 2 || len(stub.started) != 1 {
+		t.Errorf("err = %v, attempts = %d, started = %v", err, attempts, stub.started)
+	}
+
+	// 等待期间 ctx 结束时返回最后一次的错误
+	ctx, cancel := context.WithCancel(context.Background())
+	stub = &stubManager{err: unavailable}
+	m = Intercept(stub, RetryInterceptor(RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Hour}))
+	time.AfterFunc(10*time.Millisecond, cancel)
+	if err := m.StartContainer(ctx, "redis"); !client.IsErrConnectionFailed(err) || len(stub.started) != 1 {
+		t.Errorf("err = %v, attempts = %d", err, len(stub.started))
+	}
+}
+
+// lostResponseManager 模拟请求已在 daemon 上完成但响应丢失
+type lostResponseManager struct {
+	IManager
+	created int
+	copied  [][]byte
+}
+
+func (m *lostResponseManager) CreateContainerWithSpec(context.Context, ContainerSpec) (string, error) {
+	m.created++
+	return "", io.ErrUnexpectedEOF
+}
+
+func (m *lostResponseManager) CopyReaderToContainer(_ context.Context, _, _ string, r io.Reader, _ CopyOptions) error {
+	data, _ := io.ReadAll(r)
+	m.copied = append(m.copied, data)
+	return io.ErrUnexpectedEOF
+}
+
+func TestRetryNonIdempotent(t *testing.T) {
+	stub := &lostResponseManager{}
+	m := Intercept(stub, RetryInterceptor(RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}))
+	ctx := context.Background()
+
+	// 容器可能已经创建, 重试会因名称冲突失败
+	if _, err := m.CreateContainerWithSpec(ctx, ContainerSpec{Name: "redis"}); !errors.Is(err, io.ErrUnexpectedEOF) || stub.created != 1 {
+		t.Errorf("err = %v, attempts = %d", err, stub.created)
+	}
+	// reader 已被消费, 重试会写入空文件
+	err := m.CopyReaderToContainer(ctx, "redis", "/etc/redis.conf", strings.NewReader("port 6379"), CopyOptions{})
+	if !errors.Is(err, io.ErrUnexpectedEOF) || len(stub.copied) != 1 || string(stub.copied[0]) != "port 6379" {
+		t.Errorf("err = %v, copied = %q", err, stub.copied)
+	}
+
+	// 自定义 Retryable 可以按调用判断
+	stub = &lostResponseManager{}
+	retryAll := func(_ *Call, err error) bool { return IsRetryable(err) }
+	m = Intercept(stub, RetryInterceptor(RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, Retryable: retryAll}))
+	_, _ = m.CreateContainerWithSpec(ctx, ContainerSpec{Name: "redis"})
+	if stub.created != 3 {
+		t.Errorf("attempts = %d, want 3", stub.created)
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Date(2024, 8, 19, 12, 0, 0, 0, time.UTC)
+	breaker := NewCircuitBreaker(WithFailureThreshold(2), WithOpenTimeout(time.Minute))
+	breaker.now = func() time.Time { return now }
+	stub := &stubManager{err: client.ErrorConnectionFailed("")}
+	m := Intercept(stub, breaker.Interceptor())
+	ctx := context.Background()
+
+	// 调用方错误不计为失败
+	stub.err = errdefs.NotFound(errors.New("no such container"))
+	_ = m.StartContainer(ctx, "missing")
+	if h := breaker.Health(); h.State != BreakerClosed || h.Failures != 0 {
+		t.Fatalf("health = %+v", h)
+	}
+
+	stub.err = client.ErrorConnectionFailed("")
+	_ = m.StartContainer(ctx, "redis")
+	_ = m.StartContainer(ctx, "redis")
+	h := breaker.Health()
+	if h.State != BreakerOpen || h.Failures != 2 || h.LastError == "" || h.RetryAt == nil || !h.RetryAt.Equal(now.Add(time.Minute)) {
+		t.Fatalf("health = %+v", h)
+	}
+
+	// 打开期间直接失败, 不调用 daemon
+	err := m.StartContainer(ctx, "redis")
+	var openErr *CircuitOpenError
+	if !errors.Is(err, ErrCircuitOpen) || !errors.As(err, &openErr) || len(stub.started) != 3 {
+		t.Fatalf("err = %v, calls = %d", err, len(stub.started))
+	}
+
+	// 超时后进入半开, 探测失败重新打开
+	now = now.Add(time.Minute)
+	if breaker.State() != BreakerHalfOpen {
+		t.Fatalf("state = %s", breaker.State())
+	}
+	_ = m.StartContainer(ctx, "redis")
+	if breaker.State() != BreakerOpen || len(stub.started) != 4 {
+		t.Fatalf("state = %s, calls = %d", breaker.State(), len(stub.started))
+	}
+
+	// 探测成功后关闭
+	now = now.Add(time.Minute)
+	stub.err = nil
+	if err := m.StartContainer(ctx, "redis"); err != nil {
+		t.Fatal(err)
+	}
+	if h := breaker.Health(); h.State != BreakerClosed || h.Failures != 0 || h.OpenedAt == nil {
+		t.Fatalf("health = %+v", h)
+	}
+}
+
+// hang 模拟接受连接但不响应的 daemon, 直到 ctx 结束
+func hang(ctx context.Context, _ *Call, _ Invoker) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestRetryAttemptTimeout(t *testing.T) {
+	var attempts int
+	count := func(ctx context.Context, call *Call, next Invoker) error {
+		attempts++
+		return next(ctx, call)
+	}
+	policy := RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}
+	m := Intercept(&stubManager{}, RetryInterceptor(policy), count, TimeoutInterceptor(5*time.Millisecond), hang)
+	// 单次调用超时而调用方的 ctx 仍然有效时重试
+	if err := m.StartContainer(context.Background(), "redis"); !errors.Is(err, context.DeadlineExceeded) || attempts != 3 {
+		t.Errorf("err = %v, attempts = %d", err, attempts)
+	}
+	// 调用方的 ctx 超时后不再重试
+	attempts = 0
+	m = Intercept(&stubManager{}, RetryInterceptor(policy), count, hang)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	if err := m.StartContainer(ctx, "redis"); !errors.Is(err, context.DeadlineExceeded) || attempts != 1 {
+		t.Errorf("err = %v, attempts = %d", err, attempts)
+	}
+	// 重启超时后可能已经完成, 再次重试会重启两次
+	if IsIdempotent("RestartContainer") {
+		t.Error("RestartContainer should not be retried")
+	}
+
+	// 不响应的 daemon 使断路器打开
+	breaker := NewCircuitBreaker(WithFailureThreshold(2))
+	m = Intercept(&stubManager{}, breaker.Interceptor(), TimeoutInterceptor(5*time.Millisecond), hang)
+	for i := 0; i < 2; i++ {
+		_ = m.StartContainer(context.Background(), "redis")
+	}
+	if breaker.State() != BreakerOpen {
+		t.Errorf("state = %s", breaker.State())
+	}
+}
+
+func TestCircuitBreakerSingleProbe(t *testing.T) {
+	now := time.Now()
+	breaker := NewCircuitBreaker(WithFailureThreshold(1), WithOpenTimeout(time.Second))
+	breaker.now = func() time.Time { return now }
+	breaker.record(context.Background(), false, client.ErrorConnectionFailed(""))
+	now = now.Add(time.Second)
+
+	probe, err := breaker.allow()
+	if !probe || err != nil {
+		t.Fatalf("probe = %v, err = %v", probe, err)
+	}
+	// 探测进行中, 其余调用直接失败
+	if _, err := breaker.allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("err = %v", err)
+	}
+	// 探测被调用方取消, 不改变状态
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	breaker.record(canceled, true, context.DeadlineExceeded)
+	if probe, err := breaker.allow(); !probe || err != nil {
+		t.Fatalf("probe = %v, err = %v", probe, err)
+	}
+}
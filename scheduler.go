@@ -0,0 +1,264 @@
+// Package docker
+// Date: 2024/08/21 10:12:46
+// Author: Amu
+// Description:
+package docker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Strategy 选择主机的策略
+type Strategy string
+
+const (
+	StrategySpread  Strategy = "spread"  // 选择放置后资源使用率最低的主机, 使负载均匀
+	StrategyBinPack Strategy = "binpack" // 选择放置后资源使用率最高且仍能容纳的主机, 腾出空闲主机
+)
+
+// statsConcurrency 采集单台主机上容器资源使用时的并发数
+const statsConcurrency = 8
+
+// PlacementRequest 创建容器的请求和放置约束
+type PlacementRequest struct {
+	Spec         ContainerSpec
+	CPUs         float64           // 需要的 CPU 核数, 为 0 时使用 Spec.CPUs
+	Memory       int64             // 需要的内存(字节), 为 0 时使用 Spec.Memory
+	HostLabels   map[string]string // 主机必须具有的标签, 值为空时只要求存在该标签
+	AntiAffinity bool              // 不放置到已有相同 server.type 容器的主机上, Spec.Labels 中没有 server.type 时不生效
+}
+
+func (r PlacementRequest) cpus() float64 {
+	if r.CPUs > 0 {
+		return r.CPUs
+	}
+	return r.Spec.CPUs
+}
+
+func (r PlacementRequest) memory() int64 {
+	if r.Memory > 0 {
+		return r.Memory
+	}
+	return r.Spec.Memory
+}
+
+// Placement 容器被放置的主机
+type Placement struct {
+	Host        string `json:"host"`
+	ContainerID string `json:"container_id,omitempty"` // Select 只选择主机, 不创建容器, 此时为空
+}
+
+// HostUsage 主机的资源总量和当前使用量
+type HostUsage struct {
+	Host        string            `json:"host"`
+	Labels      map[string]string `json:"labels"` // daemon 标签与 Pool 中配置的标签, 后者优先
+	CPUs        float64           `json:"cpus"`
+	Memory      int64             `json:"memory"`
+	UsedCPUs    float64           `json:"used_cpus"`   // 运行中容器的 CPU 使用, 以核数计
+	UsedMemory  int64             `json:"used_memory"` // 运行中容器的内存使用, 不含页缓存
+	ServerTypes map[string]int    `json:"server_types"`
+}
+
+// score 返回放置 cpus 和 memory 后 CPU 与内存使用率的平均值
+func (u *HostUsage) score(cpus float64, memory int64) float64 {
+	var cpuRatio, memRatio float64
+	if u.CPUs > 0 {
+		cpuRatio = (u.UsedCPUs + cpus) / u.CPUs
+	}
+	if u.Memory > 0 {
+		memRatio = float64(u.UsedMemory+memory) / float64(u.Memory)
+	}
+	return (cpuRatio + memRatio) / 2
+}
+
+// fit 判断请求能否放置到主机上, 不能时返回原因
+func (u *HostUsage) fit(req PlacementRequest) string {
+	for key, value := range req.HostLabels {
+		if got, ok := u.Labels[key]; !ok || (value != "" && got != value) {
+			return fmt.Sprintf("label %s=%s not matched", key, value)
+		}
+	}
+	if serverType := req.Spec.Labels[ServerTypeLabel]; req.AntiAffinity && serverType != "" && u.ServerTypes[serverType] > 0 {
+		return fmt.Sprintf("%s %s already on host", ServerTypeLabel, serverType)
+	}
+	if free := u.CPUs - u.UsedCPUs; req.cpus() > free {
+		return fmt.Sprintf("insufficient cpu: %.2f free, %.2f requested", free, req.cpus())
+	}
+	if free := u.Memory - u.UsedMemory; req.memory() > free {
+		return fmt.Sprintf("insufficient memory: %d free, %d requested", free, req.memory())
+	}
+	return ""
+}
+
+// Scheduler 根据主机的资源使用和约束在 Pool 中选择主机创建容器
+type Scheduler struct {
+	pool     *Pool
+	strategy Strategy
+}
+
+type SchedulerOption func(*Scheduler)
+
+// WithStrategy 设置选择主机的策略, 默认为 StrategySpread
+func WithStrategy(strategy Strategy) SchedulerOption {
+	return func(s *Scheduler) {
+		s.strategy = strategy
+	}
+}
+
+func NewScheduler(pool *Pool, opts ...SchedulerOption) *Scheduler {
+	s := &Scheduler{pool: pool, strategy: StrategySpread}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Usage 并发地采集每台主机的资源使用, 容器的资源使用来自 GetContainerStats 约 1 秒的采样, 采集失败的容器不计入;
+// 部分主机不可达时返回其余主机的结果和 *PoolError
+func (s *Scheduler) Usage(ctx context.Context) ([]*HostUsage, error) {
+	var mu sync.Mutex
+	usages := make(map[string]*HostUsage)
+	ok, err := s.pool.each(ctx, func(ctx context.Context, host string, m IManager) error {
+		usage, err := hostUsage(ctx, m)
+		if err != nil {
+			return err
+		}
+		usage.Host = host
+		for key, value := range s.pool.HostLabels(host) {
+			usage.Labels[key] = value
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		usages[host] = usage
+		return nil
+	})
+	result := make([]*HostUsage, 0, len(ok))
+	for _, host := range ok {
+		result = append(result, usages[host])
+	}
+	return result, err
+}
+
+func hostUsage(ctx context.Context, m IManager) (*HostUsage, error) {
+	info, err := m.SystemInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	containers, err := m.ListContainer(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	usage := &HostUsage{
+		Labels:      make(map[string]string, len(info.Labels)),
+		CPUs:        float64(info.NCPU),
+		Memory:      info.MemTotal,
+		ServerTypes: make(map[string]int),
+	}
+	for key, value := range info.Labels {
+		usage.Labels[key] = value
+	}
+
+	var (
+		mu  sync.Mutex
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, statsConcurrency)
+	)
+	for _, c := range containers {
+		if serverType := c.Labels[ServerTypeLabel]; serverType != "" {
+			usage.ServerTypes[serverType]++
+		}
+		if c.State != "running" {
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(containerID string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			stats, err := m.GetContainerStats(ctx, containerID)
+			if err != nil {
+				// 容器在采集期间被删除或单个容器采集失败时不计入, 主机仍可调度
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			usage.UsedCPUs += stats.CPUPercent / 100
+			usage.UsedMemory += int64(stats.MemoryUsage)
+		}(c.ID)
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+// Select 按策略选择主机但不创建容器; 没有主机满足约束时返回的错误可以用 errors.Is 匹配 ErrUnschedulable,
+// 错误信息中包含每台主机不满足的原因
+func (s *Scheduler) Select(ctx context.Context, req PlacementRequest) (*Placement, error) {
+	if s.strategy != StrategySpread && s.strategy != StrategyBinPack {
+		return nil, invalidArgument(fmt.Errorf("unknown strategy %q", s.strategy))
+	}
+	usages, err := s.Usage(ctx)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return nil, ctxErr
+	}
+	var (
+		reasons []string
+		poolErr *PoolError
+	)
+	if errors.As(err, &poolErr) {
+		for _, hostErr := range poolErr.Errors {
+			reasons = append(reasons, hostErr.Error())
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	var candidates []*HostUsage
+	for _, usage := range usages {
+		if reason := usage.fit(req); reason != "" {
+			reasons = append(reasons, fmt.Sprintf("host %s: %s", usage.Host, reason))
+			continue
+		}
+		candidates = append(candidates, usage)
+	}
+	if len(candidates) == 0 {
+		sort.Strings(reasons)
+		return nil, fmt.Errorf("%w: %s", ErrUnschedulable, strings.Join(reasons, "; "))
+	}
+
+	cpus, memory := req.cpus(), req.memory()
+	sort.SliceStable(candidates, func(i, j int) bool {
+		si, sj := candidates[i].score(cpus, memory), candidates[j].score(cpus, memory)
+		if s.strategy == StrategyBinPack {
+			return si > sj
+		}
+		return si < sj
+	})
+	return &Placement{Host: candidates[0].Host}, nil
+}
+
+// Place 按策略选择主机并在其上创建容器, 返回主机名称和容器 ID。
+// 资源使用来自采集时的快照, 并发调用 Place 时可能选择同一台主机
+func (s *Scheduler) Place(ctx context.Context, req PlacementRequest) (*Placement, error) {
+	placement, err := s.Select(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	m, err := s.pool.Host(placement.Host)
+	if err != nil {
+		return nil, err
+	}
+	placement.ContainerID, err = m.CreateContainerWithSpec(ctx, req.Spec)
+	if err != nil {
+		return nil, &HostError{Host: placement.Host, Err: err}
+	}
+	return placement, nil
+}
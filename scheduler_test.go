@@ -0,0 +1,153 @@
+// Package docker
+// Date: 2024/08/21 14:36:05
+// Author: Amu
+// Description:
+package docker
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/client"
+)
+
+// schedHost 在 fakeHost 的基础上模拟主机资源和容器的资源使用
+type schedHost struct {
+	fakeHost
+	info    SystemInfo
+	stats   map[string]ContainerStats
+	created []ContainerSpec
+}
+
+func (h *schedHost) SystemInfo(context.Context) (*SystemInfo, error) {
+	if h.err != nil {
+		return nil, h.err
+	}
+	return &h.info, nil
+}
+
+func (h *schedHost) GetContainerStats(_ context.Context, containerID string) (*ContainerStats, error) {
+	stats, ok := h.stats[containerID]
+	if !ok {
+		return nil, errors.New("stats unavailable")
+	}
+	return &stats, nil
+}
+
+func (h *schedHost) CreateContainerWithSpec(_ context.Context, spec ContainerSpec) (string, error) {
+	h.created = append(h.created, spec)
+	return "new-" + spec.Name, nil
+}
+
+const gib = 1 << 30
+
+func newSchedPool(t *testing.T) (*Pool, map[string]*schedHost) {
+	t.Helper()
+	hosts := map[string]*schedHost{
+		// 4 核 8G, 已使用 2 核 4G
+		"busy": {
+			fakeHost: fakeHost{containers: []ContainerSummary{
+				{ID: "b1", State: "running", Labels: map[string]string{ServerTypeLabel: "redis"}},
+				{ID: "b2", State: "exited", Labels: map[string]string{ServerTypeLabel: "mysql"}},
+				{ID: "b3", State: "running"}, // 采集失败, 不计入资源使用
+			}},
+			info:  SystemInfo{NCPU: 4, MemTotal: 8 * gib, Labels: map[string]string{"zone": "a"}},
+			stats: map[string]ContainerStats{"b1": {CPUPercent: 200, MemoryUsage: 4 * gib}},
+		},
+		// 4 核 8G, 空闲
+		"idle": {
+			info: SystemInfo{NCPU: 4, MemTotal: 8 * gib, Labels: map[string]string{"zone": "b"}},
+		},
+	}
+	p, err := NewPool(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, host := range hosts {
+		if err := p.Add(name, host, map[string]string{"gpu": ""}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return p, hosts
+}
+
+func TestSchedulerStrategy(t *testing.T) {
+	p, hosts := newSchedPool(t)
+	req := PlacementRequest{Spec: ContainerSpec{Name: "web", Image: "nginx", CPUs: 1, Memory: gib}}
+	ctx := context.Background()
+
+	placement, err := NewScheduler(p).Place(ctx, req)
+	if err != nil || placement.Host != "idle" || placement.ContainerID != "new-web" || len(hosts["idle"].created) != 1 {
+		t.Fatalf("placement = %+v, err = %v", placement, err)
+	}
+	placement, err = NewScheduler(p, WithStrategy(StrategyBinPack)).Select(ctx, req)
+	if err != nil || placement.Host != "busy" || placement.ContainerID != "" {
+		t.Fatalf("placement = %+v, err = %v", placement, err)
+	}
+	if _, err := NewScheduler(p, WithStrategy("random")).Select(ctx, req); !errors.Is(err, ErrInvalid) {
+		t.Errorf("err = %v", err)
+	}
+
+	usages, err := NewScheduler(p).Usage(ctx)
+	if err != nil || len(usages) != 2 {
+		t.Fatalf("usages = %v, err = %v", usages, err)
+	}
+	busy := usages[0]
+	if busy.Host != "busy" || busy.UsedCPUs != 2 || busy.UsedMemory != 4*gib ||
+		!reflect.DeepEqual(busy.Labels, map[string]string{"zone": "a", "gpu": ""}) ||
+		!reflect.DeepEqual(busy.ServerTypes, map[string]int{"redis": 1, "mysql": 1}) {
+		t.Errorf("usage = %+v", busy)
+	}
+}
+
+func TestSchedulerConstraints(t *testing.T) {
+	p, _ := newSchedPool(t)
+	s := NewScheduler(p, WithStrategy(StrategyBinPack))
+	ctx := context.Background()
+	redis := ContainerSpec{Name: "redis-2", Image: "redis", Labels: map[string]string{ServerTypeLabel: "redis"}}
+
+	tests := []struct {
+		name string
+		req  PlacementRequest
+		want string // 为空时期望 ErrUnschedulable
+	}{
+		{"host label", PlacementRequest{Spec: redis, HostLabels: map[string]string{"zone": "b"}}, "idle"},
+		{"label exists", PlacementRequest{Spec: redis, HostLabels: map[string]string{"gpu": ""}}, "busy"},
+		{"label missing", PlacementRequest{Spec: redis, HostLabels: map[string]string{"ssd": ""}}, ""},
+		{"anti-affinity", PlacementRequest{Spec: redis, AntiAffinity: true}, "idle"},
+		{"memory", PlacementRequest{Spec: redis, Memory: 6 * gib}, "idle"},
+		{"cpu", PlacementRequest{Spec: redis, CPUs: 5}, ""},
+	}
+	for _, tt := range tests {
+		placement, err := s.Select(ctx, tt.req)
+		if tt.want == "" {
+			if !errors.Is(err, ErrUnschedulable) {
+				t.Errorf("%s: placement = %+v, err = %v", tt.name, placement, err)
+			}
+			continue
+		}
+		if err != nil || placement.Host != tt.want {
+			t.Errorf("%s: placement = %+v, err = %v, want %s", tt.name, placement, err, tt.want)
+		}
+	}
+}
+
+func TestSchedulerUnreachableHost(t *testing.T) {
+	p, hosts := newSchedPool(t)
+	hosts["idle"].err = client.ErrorConnectionFailed("tcp://10.0.0.3:2376")
+	s := NewScheduler(p)
+	ctx := context.Background()
+
+	placement, err := s.Select(ctx, PlacementRequest{Spec: ContainerSpec{Name: "web"}})
+	if err != nil || placement.Host != "busy" {
+		t.Fatalf("placement = %+v, err = %v", placement, err)
+	}
+	_, err = s.Select(ctx, PlacementRequest{Spec: ContainerSpec{Name: "web"}, Memory: 6 * gib})
+	if !errors.Is(err, ErrUnschedulable) || !strings.Contains(err.Error(), "host idle: Cannot connect") ||
+		!strings.Contains(err.Error(), "host busy: insufficient memory") {
+		t.Errorf("err = %v", err)
+	}
+}
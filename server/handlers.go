@@ -0,0 +1,558 @@
+// Package server
+// Date: 2024/08/12 10:31:02
+// Author: Amu
+// Description:
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/amuluze/docker"
+)
+
+func (s *Server) registerRoutes() {
+	s.handle(http.MethodGet, "/version", s.version)
+	s.handle(http.MethodGet, "/system/df", s.diskUsage)
+	s.handle(http.MethodGet, "/topology", s.topology)
+
+	s.handle(http.MethodGet, "/containers", s.listContainers)
+	s.handle(http.MethodPost, "/containers", s.createContainer)
+	s.handle(http.MethodGet, "/containers/:id", s.getContainer)
+	s.handle(http.MethodDelete, "/containers/:id", s.deleteContainer)
+	s.handle(http.MethodPost, "/containers/:id/start", s.startContainer)
+	s.handle(http.MethodPost, "/containers/:id/stop", s.stopContainer)
+	s.handle(http.MethodPost, "/containers/:id/restart", s.restartContainer)
+	s.handle(http.MethodPost, "/containers/:id/rename", s.renameContainer)
+	s.handle(http.MethodGet, "/containers/:id/logs", s.containerLogs)
+	s.handle(http.MethodGet, "/containers/:id/stats", s.containerStats)
+
+	s.handle(http.MethodGet, "/images", s.listImages)
+	s.handle(http.MethodPost, "/images/pull", s.pullImage)
+	s.handle(http.MethodPost, "/images/tag", s.tagImage)
+	s.handle(http.MethodPost, "/images/prune", s.pruneImages)
+	s.handle(http.MethodGet, "/images/*ref", s.getImage)
+	s.handle(http.MethodDelete, "/images/*ref", s.deleteImage)
+
+	s.handle(http.MethodGet, "/networks", s.listNetworks)
+	s.handle(http.MethodPost, "/networks", s.createNetwork)
+	s.handle(http.MethodPost, "/networks/prune", s.pruneNetworks)
+	s.handle(http.MethodGet, "/networks/:id", s.getNetwork)
+	s.handle(http.MethodDelete, "/networks/:id", s.deleteNetwork)
+	s.handle(http.MethodPost, "/networks/:id/connect", s.connectNetwork)
+	s.handle(http.MethodPost, "/networks/:id/disconnect", s.disconnectNetwork)
+}
+
+// validName 容器和网络名称的规则, 与 daemon 一致
+var validName = regexp.MustCompile(`^/?[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// IDResponse 创建类接口的响应
+type IDResponse struct {
+	ID string `json:"id"`
+}
+
+func (s *Server) version(w http.ResponseWriter, r *http.Request, _ map[string]string) error {
+	version, err := s.manager.Version(r.Context())
+	if err != nil {
+		return err
+	}
+	writeJSON(w, http.StatusOK, version)
+	return nil
+}
+
+func (s *Server) diskUsage(w http.ResponseWriter, r *http.Request, _ map[string]string) error {
+	du, err := s.manager.DiskUsage(r.Context())
+	if err != nil {
+		return err
+	}
+	writeJSON(w, http.StatusOK, du)
+	return nil
+}
+
+func (s *Server) topology(w http.ResponseWriter, r *http.Request, _ map[string]string) error {
+	topology, err := s.manager.Topology(r.Context())
+	if err != nil {
+		return err
+	}
+	writeJSON(w, http.StatusOK, topology)
+	return nil
+}
+
+// labelFilter 解析 label 查询参数, 形如 label=key 或 label=key=value, 可出现多次
+func labelFilter(r *http.Request) map[string]string {
+	filter := make(map[string]string)
+	for _, l := range r.URL.Query()["label"] {
+		key, value, _ := strings.Cut(l, "=")
+		filter[key] = value
+	}
+	return filter
+}
+
+func matchLabels(labels, filter map[string]string) bool {
+	for k, v := range filter {
+		actual, ok := labels[k]
+		if !ok || (v != "" && actual != v) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Server) listContainers(w http.ResponseWriter, r *http.Request, _ map[string]string) error {
+	containers, err := s.manager.ListContainer(r.Context())
+	if err != nil {
+		return err
+	}
+	filter := labelFilter(r)
+	result := make([]docker.ContainerSummary, 0, len(containers))
+	for _, c := range containers {
+		if matchLabels(c.Labels, filter) {
+			result = append(result, c)
+		}
+	}
+	writeJSON(w, http.StatusOK, result)
+	return nil
+}
+
+func validateContainerSpec(spec docker.ContainerSpec) error {
+	if spec.Name == "" || !validName.MatchString(spec.Name) {
+		return badRequest("invalid container name %q", spec.Name)
+	}
+	if strings.TrimSpace(spec.Image) == "" {
+		return badRequest("image is required")
+	}
+	for _, attachment := range spec.Networks {
+		if attachment.Network == "" {
+			return badRequest("network name is required")
+		}
+	}
+	for _, env := range spec.Env {
+		if key, _, _ := strings.Cut(env, "="); key == "" {
+			return badRequest("invalid environment variable %q", env)
+		}
+	}
+	if spec.Memory < 0 || spec.CPUs < 0 {
+		return badRequest("resource limits must not be negative")
+	}
+	return nil
+}
+
+// createContainer 请求体为 ContainerSpec, 查询参数 start=true 时创建后立即启动
+func (s *Server) createContainer(w http.ResponseWriter, r *http.Request, _ map[string]string) error {
+	var spec docker.ContainerSpec
+	if err := decodeJSON(r, &spec); err != nil {
+		return err
+	}
+	if err := validateContainerSpec(spec); err != nil {
+		return err
+	}
+	start, err := boolQuery(r, "start")
+	if err != nil {
+		return err
+	}
+	id, err := s.manager.CreateContainerWithSpec(r.Context(), spec)
+	if err != nil {
+		return err
+	}
+	if start {
+		if err := s.manager.StartContainer(r.Context(), id); err != nil {
+			return err
+		}
+	}
+	writeJSON(w, http.StatusCreated, IDResponse{ID: id})
+	return nil
+}
+
+func (s *Server) getContainer(w http.ResponseWriter, r *http.Request, params map[string]string) error {
+	status, err := s.manager.GetContainerStatus(r.Context(), params["id"])
+	if err != nil {
+		return err
+	}
+	writeJSON(w, http.StatusOK, status)
+	return nil
+}
+
+func (s *Server) deleteContainer(w http.ResponseWriter, r *http.Request, params map[string]string) error {
+	if err := s.manager.DeleteContainer(r.Context(), params["id"]); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (s *Server) startContainer(w http.ResponseWriter, r *http.Request, params map[string]string) error {
+	if err := s.manager.StartContainer(r.Context(), params["id"]); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (s *Server) stopContainer(w http.ResponseWriter, r *http.Request, params map[string]string) error {
+	if err := s.manager.StopContainer(r.Context(), params["id"]); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (s *Server) restartContainer(w http.ResponseWriter, r *http.Request, params map[string]string) error {
+	if err := s.manager.RestartContainer(r.Context(), params["id"]); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+type renameRequest struct {
+	Name string `json:"name"`
+}
+
+func (s *Server) renameContainer(w http.ResponseWriter, r *http.Request, params map[string]string) error {
+	var req renameRequest
+	if err := decodeJSON(r, &req); err != nil {
+		return err
+	}
+	if !validName.MatchString(req.Name) {
+		return badRequest("invalid container name %q", req.Name)
+	}
+	if err := s.manager.RenameContainer(r.Context(), params["id"], req.Name); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func boolQuery(r *http.Request, key string) (bool, error) {
+	value := r.URL.Query().Get(key)
+	if value == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, badRequest("invalid value %q for %s", value, key)
+	}
+	return b, nil
+}
+
+// containerLogs 查询参数: follow、tail、since、until、timestamps。
+// Accept 为 text/event-stream 时每行日志作为一个 log 事件输出, 否则以 text/plain 分块输出
+func (s *Server) containerLogs(w http.ResponseWriter, r *http.Request, params map[string]string) error {
+	query := r.URL.Query()
+	follow, err := boolQuery(r, "follow")
+	if err != nil {
+		return err
+	}
+	timestamps, err := boolQuery(r, "timestamps")
+	if err != nil {
+		return err
+	}
+	tail := query.Get("tail")
+	if tail != "" && tail != "all" {
+		if n, err := strconv.Atoi(tail); err != nil || n < 0 {
+			return badRequest("invalid value %q for tail", tail)
+		}
+	}
+
+	logs, err := s.manager.ContainerLogsWithOptions(r.Context(), params["id"], docker.LogsOptions{
+		Follow:     follow,
+		Tail:       tail,
+		Since:      query.Get("since"),
+		Until:      query.Get("until"),
+		Timestamps: timestamps,
+	})
+	if err != nil {
+		return err
+	}
+	defer logs.Close()
+
+	if !wantsEventStream(r) {
+		_, _ = io.Copy(newStreamWriter(w, "text/plain; charset=utf-8"), logs)
+		return nil
+	}
+	stream := newStreamWriter(w, "text/event-stream")
+	scanner := bufio.NewScanner(logs)
+	scanner.Buffer(make([]byte, 64*1024), maxBodySize)
+	for scanner.Scan() {
+		if err := stream.event("log", strings.TrimSuffix(scanner.Text(), "\r")); err != nil {
+			return nil
+		}
+	}
+	if err := scanner.Err(); err != nil && r.Context().Err() == nil {
+		_ = stream.event("error", err.Error())
+	}
+	return nil
+}
+
+// containerStats 默认返回一次采样; stream=true 时持续输出, Accept 为 text/event-stream 时
+// 每次采样作为一个 stats 事件, 否则以换行分隔的 JSON 分块输出
+func (s *Server) containerStats(w http.ResponseWriter, r *http.Request, params map[string]string) error {
+	streaming, err := boolQuery(r, "stream")
+	if err != nil {
+		return err
+	}
+	if !streaming {
+		stats, err := s.manager.GetContainerStats(r.Context(), params["id"])
+		if err != nil {
+			return err
+		}
+		writeJSON(w, http.StatusOK, stats)
+		return nil
+	}
+
+	// 容器不存在等错误需要在写入响应头之前返回
+	id, err := s.manager.ResolveContainer(r.Context(), params["id"])
+	if err != nil {
+		return err
+	}
+	sse := wantsEventStream(r)
+	var stream *streamWriter
+	if sse {
+		stream = newStreamWriter(w, "text/event-stream")
+	} else {
+		stream = newStreamWriter(w, "application/x-ndjson")
+	}
+	err = s.manager.StreamContainerStats(r.Context(), id, func(stats *docker.ContainerStats) error {
+		data, err := json.Marshal(stats)
+		if err != nil {
+			return err
+		}
+		if sse {
+			return stream.event("stats", string(data))
+		}
+		_, err = stream.Write(append(data, '\n'))
+		return err
+	})
+	if err != nil && r.Context().Err() == nil && sse {
+		_ = stream.event("error", err.Error())
+	}
+	return nil
+}
+
+func (s *Server) listImages(w http.ResponseWriter, r *http.Request, _ map[string]string) error {
+	images, err := s.manager.ListImage(r.Context())
+	if err != nil {
+		return err
+	}
+	if images == nil {
+		images = []docker.ImageSummary{}
+	}
+	writeJSON(w, http.StatusOK, images)
+	return nil
+}
+
+// getImage 按 ID 或 name:tag 查询镜像
+func (s *Server) getImage(w http.ResponseWriter, r *http.Request, params map[string]string) error {
+	ref := params["ref"]
+	var (
+		im  *docker.ImageSummary
+		err error
+	)
+	if strings.Contains(ref, ":") && !strings.HasPrefix(ref, "sha256:") {
+		im, err = s.manager.GetImageByName(r.Context(), ref)
+	} else {
+		im, err = s.manager.GetImageByID(r.Context(), ref)
+	}
+	if err != nil {
+		return err
+	}
+	writeJSON(w, http.StatusOK, im)
+	return nil
+}
+
+func (s *Server) deleteImage(w http.ResponseWriter, r *http.Request, params map[string]string) error {
+	if err := s.manager.DeleteImage(r.Context(), params["ref"]); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+type pullRequest struct {
+	Image string `json:"image"`
+}
+
+func (s *Server) pullImage(w http.ResponseWriter, r *http.Request, _ map[string]string) error {
+	var req pullRequest
+	if err := decodeJSON(r, &req); err != nil {
+		return err
+	}
+	if strings.TrimSpace(req.Image) == "" {
+		return badRequest("image is required")
+	}
+	if err := s.manager.PullImage(r.Context(), req.Image); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+type tagRequest struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+}
+
+func (s *Server) tagImage(w http.ResponseWriter, r *http.Request, _ map[string]string) error {
+	var req tagRequest
+	if err := decodeJSON(r, &req); err != nil {
+		return err
+	}
+	if req.Source == "" || req.Target == "" {
+		return badRequest("source and target are required")
+	}
+	if err := s.manager.TagImage(r.Context(), req.Source, req.Target); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (s *Server) pruneImages(w http.ResponseWriter, r *http.Request, _ map[string]string) error {
+	if err := s.manager.PruneImages(r.Context()); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (s *Server) listNetworks(w http.ResponseWriter, r *http.Request, _ map[string]string) error {
+	networks, err := s.manager.ListNetwork(r.Context())
+	if err != nil {
+		return err
+	}
+	filter := labelFilter(r)
+	result := make([]docker.NetworkSummary, 0, len(networks))
+	for _, nt := range networks {
+		if matchLabels(nt.Labels, filter) {
+			result = append(result, nt)
+		}
+	}
+	writeJSON(w, http.StatusOK, result)
+	return nil
+}
+
+// createNetwork 请求体为 NetworkSpec, 子网等参数由 CreateNetworkWithSpec 校验
+func (s *Server) createNetwork(w http.ResponseWriter, r *http.Request, _ map[string]string) error {
+	var spec docker.NetworkSpec
+	if err := decodeJSON(r, &spec); err != nil {
+		return err
+	}
+	if !validName.MatchString(spec.Name) {
+		return badRequest("invalid network name %q", spec.Name)
+	}
+	id, err := s.manager.CreateNetworkWithSpec(r.Context(), spec)
+	if err != nil {
+		return err
+	}
+	writeJSON(w, http.StatusCreated, IDResponse{ID: id})
+	return nil
+}
+
+func (s *Server) getNetwork(w http.ResponseWriter, r *http.Request, params map[string]string) error {
+	nt, err := s.manager.GetNetworkByID(r.Context(), params["id"])
+	if err != nil {
+		return err
+	}
+	writeJSON(w, http.StatusOK, nt)
+	return nil
+}
+
+// deleteNetwork 查询参数 disconnect=true 时先断开已连接的容器, force=true 时同时断开运行中的容器
+func (s *Server) deleteNetwork(w http.ResponseWriter, r *http.Request, params map[string]string) error {
+	disconnect, err := boolQuery(r, "disconnect")
+	if err != nil {
+		return err
+	}
+	force, err := boolQuery(r, "force")
+	if err != nil {
+		return err
+	}
+	opts := docker.DeleteNetworkOptions{Disconnect: disconnect, Force: force}
+	if err := s.manager.DeleteNetworkWithOptions(r.Context(), params["id"], opts); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// PruneResponse 清理接口的响应
+type PruneResponse struct {
+	Deleted []string `json:"deleted"`
+}
+
+// pruneNetworks 查询参数: label 同列表接口, until 为 Go 时长格式, 如 24h
+func (s *Server) pruneNetworks(w http.ResponseWriter, r *http.Request, _ map[string]string) error {
+	opts := docker.PruneNetworkOptions{Labels: labelFilter(r)}
+	if until := r.URL.Query().Get("until"); until != "" {
+		d, err := time.ParseDuration(until)
+		if err != nil || d < 0 {
+			return badRequest("invalid value %q for until", until)
+		}
+		opts.Until = d
+	}
+	deleted, err := s.manager.PruneNetworkWithOptions(r.Context(), opts)
+	if err != nil {
+		return err
+	}
+	if deleted == nil {
+		deleted = []string{}
+	}
+	writeJSON(w, http.StatusOK, PruneResponse{Deleted: deleted})
+	return nil
+}
+
+type connectRequest struct {
+	Container   string   `json:"container"`
+	Aliases     []string `json:"aliases"`
+	IPv4Address string   `json:"ipv4_address"`
+	IPv6Address string   `json:"ipv6_address"`
+	MacAddress  string   `json:"mac_address"`
+	Links       []string `json:"links"`
+}
+
+func (s *Server) connectNetwork(w http.ResponseWriter, r *http.Request, params map[string]string) error {
+	var req connectRequest
+	if err := decodeJSON(r, &req); err != nil {
+		return err
+	}
+	if req.Container == "" {
+		return badRequest("container is required")
+	}
+	opts := docker.EndpointOptions{
+		Aliases:     req.Aliases,
+		IPv4Address: req.IPv4Address,
+		IPv6Address: req.IPv6Address,
+		MacAddress:  req.MacAddress,
+		Links:       req.Links,
+	}
+	if err := s.manager.JoinNetworkWithOptions(r.Context(), req.Container, params["id"], opts); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+type disconnectRequest struct {
+	Container string `json:"container"`
+}
+
+func (s *Server) disconnectNetwork(w http.ResponseWriter, r *http.Request, params map[string]string) error {
+	var req disconnectRequest
+	if err := decodeJSON(r, &req); err != nil {
+		return err
+	}
+	if req.Container == "" {
+		return badRequest("container is required")
+	}
+	if err := s.manager.LeaveNetwork(r.Context(), req.Container, params["id"]); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
@@ -0,0 +1,233 @@
+// Package server
+// Date: 2024/08/12 10:05:36
+// Author: Amu
+// Description: 以 HTTP/JSON 接口提供 IManager 的功能
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/amuluze/docker"
+	"github.com/docker/docker/errdefs"
+)
+
+// maxBodySize 请求体的最大长度
+const maxBodySize = 1 << 20
+
+// Server 将 IManager 的方法映射为 REST 接口, 实现了 http.Handler
+type Server struct {
+	manager docker.IManager
+	routes  []route
+}
+
+type handlerFunc func(w http.ResponseWriter, r *http.Request, params map[string]string) error
+
+type route struct {
+	method   string
+	segments []string // 以 : 开头的段为路径参数, 以 * 开头的段匹配剩余全部路径
+	handler  handlerFunc
+}
+
+func New(manager docker.IManager) *Server {
+	s := &Server{manager: manager}
+	s.registerRoutes()
+	return s
+}
+
+func (s *Server) handle(method, pattern string, handler handlerFunc) {
+	s.routes = append(s.routes, route{
+		method:   method,
+		segments: splitPath(pattern),
+		handler:  handler,
+	})
+}
+
+func splitPath(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+func (r route) match(segments []string) (map[string]string, bool) {
+	params := make(map[string]string)
+	for i, segment := range r.segments {
+		if strings.HasPrefix(segment, "*") {
+			if i >= len(segments) {
+				return nil, false
+			}
+			params[segment[1:]] = strings.Join(segments[i:], "/")
+			return params, true
+		}
+		if i >= len(segments) {
+			return nil, false
+		}
+		switch {
+		case strings.HasPrefix(segment, ":"):
+			params[segment[1:]] = segments[i]
+		case segment != segments[i]:
+			return nil, false
+		}
+	}
+	return params, len(segments) == len(r.segments)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	segments := splitPath(r.URL.Path)
+	var allowed []string
+	for _, rt := range s.routes {
+		params, ok := rt.match(segments)
+		if !ok {
+			continue
+		}
+		if rt.method != r.Method {
+			allowed = append(allowed, rt.method)
+			continue
+		}
+		if err := rt.handler(w, r, params); err != nil {
+			writeError(w, err)
+		}
+		return
+	}
+	if len(allowed) > 0 {
+		sort.Strings(allowed)
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		writeError(w, &httpError{status: http.StatusMethodNotAllowed, message: fmt.Sprintf("method %s not allowed", r.Method)})
+		return
+	}
+	writeError(w, &httpError{status: http.StatusNotFound, message: fmt.Sprintf("no route for %s", r.URL.Path)})
+}
+
+// ErrorResponse 所有错误响应的格式
+type ErrorResponse struct {
+	Status  int    `json:"status"`  // HTTP 状态码
+	Error   string `json:"error"`   // 状态码对应的短语, 如 Not Found
+	Message string `json:"message"` // 具体的错误信息
+}
+
+// httpError 携带状态码的错误, 用于请求校验等由服务端直接判定的错误
+type httpError struct {
+	status  int
+	message string
+}
+
+func (e *httpError) Error() string {
+	return e.message
+}
+
+func badRequest(format string, args ...any) error {
+	return &httpError{status: http.StatusBadRequest, message: fmt.Sprintf(format, args...)}
+}
+
+// statusCode 将错误映射为 HTTP 状态码, 优先识别本库的哨兵错误, 其次是 daemon 返回的错误类型
+func statusCode(err error) int {
+	var he *httpError
+	switch {
+	case errors.As(err, &he):
+		return he.status
+	case errors.Is(err, docker.ErrNotFound), errdefs.IsNotFound(err):
+		return http.StatusNotFound
+	case errors.Is(err, docker.ErrAmbiguous), errors.Is(err, docker.ErrInUse), errdefs.IsConflict(err):
+		return http.StatusConflict
+	case errors.Is(err, docker.ErrInvalid), errdefs.IsInvalidParameter(err):
+		return http.StatusBadRequest
+	case errdefs.IsUnauthorized(err):
+		return http.StatusUnauthorized
+	case errdefs.IsForbidden(err):
+		return http.StatusForbidden
+	case errdefs.IsNotImplemented(err):
+		return http.StatusNotImplemented
+	case errors.Is(err, docker.ErrCircuitOpen), errdefs.IsUnavailable(err):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, context.DeadlineExceeded), errdefs.IsDeadline(err):
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusInternalServerError
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := statusCode(err)
+	writeJSON(w, status, ErrorResponse{
+		Status:  status,
+		Error:   http.StatusText(status),
+		Message: err.Error(),
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// decodeJSON 解析请求体, 拒绝未知字段和多余的内容
+func decodeJSON(r *http.Request, v any) error {
+	decoder := json.NewDecoder(io.LimitReader(r.Body, maxBodySize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		if errors.Is(err, io.EOF) {
+			return badRequest("request body is empty")
+		}
+		return badRequest("invalid request body: %v", err)
+	}
+	if decoder.More() {
+		return badRequest("invalid request body: unexpected data after JSON value")
+	}
+	return nil
+}
+
+// wantsEventStream 客户端通过 Accept 请求 Server-Sent Events 时返回 true, 否则使用分块传输
+func wantsEventStream(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+}
+
+// streamWriter 每次写入后立即刷新, 用于流式响应
+type streamWriter struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+}
+
+func newStreamWriter(w http.ResponseWriter, contentType string) *streamWriter {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	sw := &streamWriter{w: w, flusher: flusher}
+	sw.flush()
+	return sw
+}
+
+func (s *streamWriter) flush() {
+	if s.flusher != nil {
+		s.flusher.Flush()
+	}
+}
+
+func (s *streamWriter) Write(p []byte) (int, error) {
+	n, err := s.w.Write(p)
+	s.flush()
+	return n, err
+}
+
+// event 输出一个 SSE 事件, 多行数据拆分为多个 data 字段
+func (s *streamWriter) event(name, data string) error {
+	b := new(strings.Builder)
+	if name != "" {
+		b.WriteString("event: " + name + "\n")
+	}
+	for _, line := range strings.Split(data, "\n") {
+		b.WriteString("data: " + line + "\n")
+	}
+	b.WriteString("\n")
+	_, err := io.WriteString(s, b.String())
+	return err
+}
@@ -0,0 +1,255 @@
+// Package server
+// Date: 2024/08/12 11:02:45
+// Author: Amu
+// Description:
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/amuluze/docker"
+	"github.com/docker/docker/errdefs"
+)
+
+// fakeManager 只实现测试用到的方法, 其余方法调用时会 panic
+type fakeManager struct {
+	docker.IManager
+	containers []docker.ContainerSummary
+	created    *docker.ContainerSpec
+	started    []string
+	deleteErr  error
+	logs       string
+	stats      []docker.ContainerStats
+}
+
+func (f *fakeManager) Version(context.Context) (*docker.Version, error) {
+	return &docker.Version{DockerVersion: "27.0.3", APIVersion: "1.46"}, nil
+}
+
+func (f *fakeManager) ListContainer(context.Context) ([]docker.ContainerSummary, error) {
+	return f.containers, nil
+}
+
+func (f *fakeManager) CreateContainerWithSpec(_ context.Context, spec docker.ContainerSpec) (string, error) {
+	f.created = &spec
+	return "c0ffee", nil
+}
+
+func (f *fakeManager) StartContainer(_ context.Context, containerID string) error {
+	f.started = append(f.started, containerID)
+	return nil
+}
+
+func (f *fakeManager) DeleteContainer(context.Context, string) error {
+	return f.deleteErr
+}
+
+func (f *fakeManager) ResolveContainer(_ context.Context, containerID string) (string, error) {
+	if containerID == "missing" {
+		return "", fmt.Errorf("container %q: %w", containerID, docker.ErrNotFound)
+	}
+	return containerID, nil
+}
+
+func (f *fakeManager) ContainerLogsWithOptions(context.Context, string, docker.LogsOptions) (io.ReadCloser, error) {
+	return io.NopCloser(strings.NewReader(f.logs)), nil
+}
+
+func (f *fakeManager) StreamContainerStats(_ context.Context, _ string, fn func(*docker.ContainerStats) error) error {
+	for i := range f.stats {
+		if err := fn(&f.stats[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *fakeManager) DeleteNetworkWithOptions(context.Context, string, docker.DeleteNetworkOptions) error {
+	return &docker.NetworkInUseError{Network: "test", Containers: []string{"redis"}}
+}
+
+func do(t *testing.T, s *Server, method, target, body string, header ...string) *httptest.ResponseRecorder {
+	t.Helper()
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	req := httptest.NewRequest(method, target, reader)
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func decodeError(t *testing.T, recorder *httptest.ResponseRecorder) ErrorResponse {
+	t.Helper()
+	var resp ErrorResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid error body %q: %v", recorder.Body.String(), err)
+	}
+	if resp.Status != recorder.Code {
+		t.Errorf("status in body %d does not match response code %d", resp.Status, recorder.Code)
+	}
+	return resp
+}
+
+func TestRouting(t *testing.T) {
+	s := New(&fakeManager{})
+
+	recorder := do(t, s, http.MethodGet, "/version", "")
+	if recorder.Code != http.StatusOK || !strings.Contains(recorder.Body.String(), `"docker_version":"27.0.3"`) {
+		t.Errorf("version: %d %s", recorder.Code, recorder.Body.String())
+	}
+
+	recorder = do(t, s, http.MethodPut, "/containers", "")
+	if recorder.Code != http.StatusMethodNotAllowed || recorder.Header().Get("Allow") != "GET, POST" {
+		t.Errorf("method not allowed: %d %v", recorder.Code, recorder.Header())
+	}
+	decodeError(t, recorder)
+
+	recorder = do(t, s, http.MethodGet, "/nothing", "")
+	if recorder.Code != http.StatusNotFound {
+		t.Errorf("unknown route: %d", recorder.Code)
+	}
+	decodeError(t, recorder)
+}
+
+func TestRouteMatch(t *testing.T) {
+	r := route{segments: splitPath("/images/*ref")}
+	params, ok := r.match(splitPath("/images/library/redis:7.0.5"))
+	if !ok || params["ref"] != "library/redis:7.0.5" {
+		t.Errorf("wildcard match = %v %v", params, ok)
+	}
+	if _, ok := r.match(splitPath("/images")); ok {
+		t.Error("wildcard requires at least one segment")
+	}
+	r = route{segments: splitPath("/containers/:id/logs")}
+	if params, ok := r.match(splitPath("/containers/redis/logs/")); !ok || params["id"] != "redis" {
+		t.Errorf("param match = %v %v", params, ok)
+	}
+	if _, ok := r.match(splitPath("/containers/redis")); ok {
+		t.Error("shorter path should not match")
+	}
+}
+
+func TestListContainersLabelFilter(t *testing.T) {
+	s := New(&fakeManager{containers: []docker.ContainerSummary{
+		{Name: "redis", Labels: map[string]string{docker.CreatedByProbe: "true", docker.ServerTypeLabel: docker.DatabaseServer}},
+		{Name: "web", Labels: map[string]string{docker.ServerTypeLabel: docker.WebServer}},
+	}})
+	recorder := do(t, s, http.MethodGet, "/containers?label="+docker.CreatedByProbe+"=true", "")
+	var containers []docker.ContainerSummary
+	if err := json.Unmarshal(recorder.Body.Bytes(), &containers); err != nil {
+		t.Fatal(err)
+	}
+	if len(containers) != 1 || containers[0].Name != "redis" {
+		t.Errorf("filtered containers = %v", containers)
+	}
+}
+
+func TestCreateContainer(t *testing.T) {
+	manager := &fakeManager{}
+	s := New(manager)
+
+	body := `{"name":"redis","image":"redis:7.0.5","networks":[{"network":"test","aliases":["cache"],"ipv4_address":"172.20.0.10"}],` +
+		`"ports":["6379:6379"],"restart_policy":"unless-stopped"}`
+	recorder := do(t, s, http.MethodPost, "/containers?start=true", body)
+	if recorder.Code != http.StatusCreated || !strings.Contains(recorder.Body.String(), `"id":"c0ffee"`) {
+		t.Fatalf("create: %d %s", recorder.Code, recorder.Body.String())
+	}
+	if manager.created.Networks[0].Aliases[0] != "cache" || manager.created.Networks[0].IPv4Address != "172.20.0.10" ||
+		manager.created.RestartPolicy != "unless-stopped" || len(manager.started) != 1 {
+		t.Errorf("unexpected spec %#v started %v", manager.created, manager.started)
+	}
+
+	for _, body := range []string{
+		``,
+		`{"name":"redis"}`,
+		`{"name":"-bad","image":"redis"}`,
+		`{"name":"redis","image":"redis","unknown":1}`,
+		`{"name":"redis","image":"redis","env":["=x"]}`,
+		`{"name":"redis","image":"redis"} {}`,
+	} {
+		recorder := do(t, s, http.MethodPost, "/containers", body)
+		if recorder.Code != http.StatusBadRequest {
+			t.Errorf("body %q: status %d", body, recorder.Code)
+		}
+		decodeError(t, recorder)
+	}
+}
+
+func TestErrorMapping(t *testing.T) {
+	manager := &fakeManager{}
+	s := New(manager)
+	for err, status := range map[error]int{
+		fmt.Errorf("container %q: %w", "redis", docker.ErrNotFound):    http.StatusNotFound,
+		fmt.Errorf("container %q: %w", "r", docker.ErrAmbiguous):       http.StatusConflict,
+		errdefs.Conflict(errors.New("container is running")):           http.StatusConflict,
+		errdefs.InvalidParameter(errors.New("invalid restart policy")): http.StatusBadRequest,
+		&docker.CircuitOpenError{}:                                     http.StatusServiceUnavailable,
+		errors.New("boom"):                                             http.StatusInternalServerError,
+	} {
+		manager.deleteErr = err
+		recorder := do(t, s, http.MethodDelete, "/containers/redis", "")
+		if recorder.Code != status {
+			t.Errorf("%v: status %d, want %d", err, recorder.Code, status)
+		}
+		if resp := decodeError(t, recorder); resp.Message != err.Error() {
+			t.Errorf("message %q, want %q", resp.Message, err.Error())
+		}
+	}
+
+	recorder := do(t, s, http.MethodDelete, "/networks/test", "")
+	if recorder.Code != http.StatusConflict {
+		t.Errorf("network in use: status %d", recorder.Code)
+	}
+}
+
+func TestContainerLogsStream(t *testing.T) {
+	s := New(&fakeManager{logs: "first line\nsecond line\n"})
+
+	recorder := do(t, s, http.MethodGet, "/containers/redis/logs?follow=true&tail=10", "", "Accept", "text/event-stream")
+	want := "event: log\ndata: first line\n\nevent: log\ndata: second line\n\n"
+	if recorder.Header().Get("Content-Type") != "text/event-stream" || recorder.Body.String() != want {
+		t.Errorf("sse logs: %q", recorder.Body.String())
+	}
+
+	recorder = do(t, s, http.MethodGet, "/containers/redis/logs", "")
+	if !strings.HasPrefix(recorder.Header().Get("Content-Type"), "text/plain") || recorder.Body.String() != "first line\nsecond line\n" {
+		t.Errorf("plain logs: %q", recorder.Body.String())
+	}
+
+	if recorder := do(t, s, http.MethodGet, "/containers/redis/logs?tail=abc", ""); recorder.Code != http.StatusBadRequest {
+		t.Errorf("invalid tail: status %d", recorder.Code)
+	}
+}
+
+func TestContainerStatsStream(t *testing.T) {
+	s := New(&fakeManager{stats: []docker.ContainerStats{{Name: "redis", CPUPercent: 1}, {Name: "redis", CPUPercent: 2}}})
+
+	recorder := do(t, s, http.MethodGet, "/containers/redis/stats?stream=true", "")
+	lines := strings.Split(strings.TrimSpace(recorder.Body.String()), "\n")
+	if recorder.Header().Get("Content-Type") != "application/x-ndjson" || len(lines) != 2 || !strings.Contains(lines[1], `"cpu_percent":2`) {
+		t.Errorf("ndjson stats: %q", recorder.Body.String())
+	}
+
+	recorder = do(t, s, http.MethodGet, "/containers/redis/stats?stream=true", "", "Accept", "text/event-stream")
+	if strings.Count(recorder.Body.String(), "event: stats\n") != 2 {
+		t.Errorf("sse stats: %q", recorder.Body.String())
+	}
+
+	recorder = do(t, s, http.MethodGet, "/containers/missing/stats?stream=true", "")
+	if recorder.Code != http.StatusNotFound {
+		t.Errorf("missing container: status %d", recorder.Code)
+	}
+}
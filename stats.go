@@ -0,0 +1,245 @@
+// Package docker
+// Date: 2024/08/09 15:02:48
+// Author: Amu
+// Description:
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+)
+
+// ContainerStats 容器的一次资源使用采样, 计算方式与 docker stats 一致
+type ContainerStats struct {
+	ID              string    `json:"id"`
+	Name            string    `json:"name"`
+	Read            time.Time `json:"read"`
+	CPUPercent      float64   `json:"cpu_percent"`  // 相对单个 CPU 的百分比, 多核时可超过 100
+	MemoryUsage     uint64    `json:"memory_usage"` // 不含页缓存
+	MemoryLimit     uint64    `json:"memory_limit"`
+	MemoryPercent   float64   `json:"memory_percent"`
+	NetworkRxBytes  uint64    `json:"network_rx_bytes"`
+	NetworkTxBytes  uint64    `json:"network_tx_bytes"`
+	BlockReadBytes  uint64    `json:"block_read_bytes"`
+	BlockWriteBytes uint64    `json:"block_write_bytes"`
+	PIDs            uint64    `json:"pids"`
+}
+
+// ContainerStatus 容器的运行状态
+type ContainerStatus struct {
+	ID           string            `json:"id"`
+	Name         string            `json:"name"`
+	Image        string            `json:"image"`
+	State        string            `json:"state"`
+	Running      bool              `json:"running"`
+	ExitCode     int               `json:"exit_code"`
+	RestartCount int               `json:"restart_count"`
+	Health       string            `json:"health"` // starting healthy unhealthy, 没有健康检查时为空
+	StartedAt    time.Time         `json:"started_at"`
+	Labels       map[string]string `json:"labels"`
+}
+
+// DiskUsage daemon 的磁盘占用
+type DiskUsage struct {
+	LayersSize     int64 `json:"layers_size"`
+	Images         int   `json:"images"`
+	ImagesSize     int64 `json:"images_size"`
+	Containers     int   `json:"containers"`
+	ContainersSize int64 `json:"containers_size"` // 容器可写层的大小
+	Volumes        int   `json:"volumes"`
+	VolumesSize    int64 `json:"volumes_size"`
+	BuildCacheSize int64 `json:"build_cache_size"`
+}
+
+func (m *Manager) GetContainerStats(ctx context.Context, containerID string) (*ContainerStats, error) {
+	containerID, err := m.ResolveContainer(ctx, containerID)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := m.client.ContainerStats(ctx, containerID, false)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var stats container.StatsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		return nil, err
+	}
+	result := containerStatsFrom(stats)
+	result.ID = containerID
+	return result, nil
+}
+
+// StreamContainerStats 持续采集容器的资源使用, 每次采样调用一次 fn, fn 返回错误或 ctx 取消时结束
+func (m *Manager) StreamContainerStats(ctx context.Context, containerID string, fn func(*ContainerStats) error) error {
+	containerID, err := m.ResolveContainer(ctx, containerID)
+	if err != nil {
+		return err
+	}
+	resp, err := m.client.ContainerStats(ctx, containerID, true)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var stats container.StatsResponse
+		if err := decoder.Decode(&stats); err != nil {
+			if errors.Is(err, io.EOF) || ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		result := containerStatsFrom(stats)
+		result.ID = containerID
+		if err := fn(result); err != nil {
+			return err
+		}
+	}
+}
+
+func containerStatsFrom(stats container.StatsResponse) *ContainerStats {
+	result := &ContainerStats{
+		ID:          stats.ID,
+		Name:        strings.TrimPrefix(stats.Name, "/"),
+		Read:        stats.Read,
+		MemoryLimit: stats.MemoryStats.Limit,
+		PIDs:        stats.PidsStats.Current,
+	}
+
+	cpuDelta := float64(stats.CPUStats.CPUUsage.TotalUsage) - float64(stats.PreCPUStats.CPUUsage.TotalUsage)
+	systemDelta := float64(stats.CPUStats.SystemUsage) - float64(stats.PreCPUStats.SystemUsage)
+	onlineCPUs := float64(stats.CPUStats.OnlineCPUs)
+	if onlineCPUs == 0 {
+		onlineCPUs = float64(len(stats.CPUStats.CPUUsage.PercpuUsage))
+	}
+	if cpuDelta > 0 && systemDelta > 0 {
+		result.CPUPercent = cpuDelta / systemDelta * onlineCPUs * 100.0
+	}
+
+	// 与 docker stats 一致, 内存用量不计算非活跃的页缓存; cgroup v1 为 total_inactive_file, v2 为 inactive_file
+	result.MemoryUsage = stats.MemoryStats.Usage
+	if cache, ok := stats.MemoryStats.Stats["total_inactive_file"]; ok && cache < result.MemoryUsage {
+		result.MemoryUsage -= cache
+	} else if cache, ok := stats.MemoryStats.Stats["inactive_file"]; ok && cache < result.MemoryUsage {
+		result.MemoryUsage -= cache
+	}
+	if result.MemoryLimit > 0 {
+		result.MemoryPercent = float64(result.MemoryUsage) / float64(result.MemoryLimit) * 100.0
+	}
+
+	for _, nt := range stats.Networks {
+		result.NetworkRxBytes += nt.RxBytes
+		result.NetworkTxBytes += nt.TxBytes
+	}
+	for _, entry := range stats.BlkioStats.IoServiceBytesRecursive {
+		switch strings.ToLower(entry.Op) {
+		case "read":
+			result.BlockReadBytes += entry.Value
+		case "write":
+			result.BlockWriteBytes += entry.Value
+		}
+	}
+	return result
+}
+
+func (m *Manager) GetContainerStatus(ctx context.Context, containerID string) (*ContainerStatus, error) {
+	containerID, err := m.ResolveContainer(ctx, containerID)
+	if err != nil {
+		return nil, err
+	}
+	inspect, err := m.client.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return nil, err
+	}
+	return containerStatusFrom(inspect), nil
+}
+
+// ListContainerStatus 返回全部容器的运行状态
+func (m *Manager) ListContainerStatus(ctx context.Context) ([]ContainerStatus, error) {
+	containers, err := m.client.ContainerList(ctx, container.ListOptions{All: true})
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]ContainerStatus, 0, len(containers))
+	for _, c := range containers {
+		inspect, err := m.client.ContainerInspect(ctx, c.ID)
+		if err != nil {
+			// 容器在列出后被删除
+			continue
+		}
+		statuses = append(statuses, *containerStatusFrom(inspect))
+	}
+	return statuses, nil
+}
+
+func containerStatusFrom(inspect types.ContainerJSON) *ContainerStatus {
+	status := &ContainerStatus{}
+	if inspect.ContainerJSONBase != nil {
+		status.ID = inspect.ID
+		status.Name = strings.TrimPrefix(inspect.Name, "/")
+		status.RestartCount = inspect.RestartCount
+		if state := inspect.State; state != nil {
+			status.State = state.Status
+			status.Running = state.Running
+			status.ExitCode = state.ExitCode
+			status.StartedAt, _ = time.Parse(time.RFC3339Nano, state.StartedAt)
+			if state.Health != nil {
+				status.Health = state.Health.Status
+			}
+		}
+	}
+	if inspect.Config != nil {
+		status.Image = inspect.Config.Image
+		status.Labels = inspect.Config.Labels
+	}
+	return status
+}
+
+func (m *Manager) DiskUsage(ctx context.Context) (*DiskUsage, error) {
+	du, err := m.client.DiskUsage(ctx, types.DiskUsageOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return diskUsageFrom(du), nil
+}
+
+func diskUsageFrom(du types.DiskUsage) *DiskUsage {
+	result := &DiskUsage{
+		LayersSize: du.LayersSize,
+		Images:     len(du.Images),
+		Containers: len(du.Containers),
+		Volumes:    len(du.Volumes),
+	}
+	for _, im := range du.Images {
+		if im != nil {
+			result.ImagesSize += im.Size
+		}
+	}
+	for _, c := range du.Containers {
+		if c != nil {
+			result.ContainersSize += c.SizeRw
+		}
+	}
+	for _, v := range du.Volumes {
+		// 大小未知时为 -1
+		if v != nil && v.UsageData != nil && v.UsageData.Size > 0 {
+			result.VolumesSize += v.UsageData.Size
+		}
+	}
+	for _, cache := range du.BuildCache {
+		if cache != nil {
+			result.BuildCacheSize += cache.Size
+		}
+	}
+	return result
+}
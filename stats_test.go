@@ -0,0 +1,66 @@
+// Package docker
+// Date: 2024/08/09 15:10:33
+// Author: Amu
+// Description:
+package docker
+
+import (
+	"context"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/volume"
+)
+
+func TestGetContainerStats(t *testing.T) {
+	manager, _ := NewManager()
+	stats, err := manager.GetContainerStats(context.Background(), "redis")
+	if err != nil {
+		t.Fatalf("get container stats error: %v", err)
+	}
+	t.Logf("stats: %#v", stats)
+}
+
+func TestDiskUsage(t *testing.T) {
+	manager, _ := NewManager()
+	du, err := manager.DiskUsage(context.Background())
+	if err != nil {
+		t.Fatalf("disk usage error: %v", err)
+	}
+	t.Logf("disk usage: %#v", du)
+}
+
+func TestContainerStatsFrom(t *testing.T) {
+	var stats container.StatsResponse
+	stats.Name = "/redis"
+	stats.CPUStats = container.CPUStats{CPUUsage: container.CPUUsage{TotalUsage: 3000}, SystemUsage: 20000, OnlineCPUs: 4}
+	stats.PreCPUStats = container.CPUStats{CPUUsage: container.CPUUsage{TotalUsage: 1000}, SystemUsage: 10000}
+	stats.MemoryStats = container.MemoryStats{Usage: 2048, Limit: 4096, Stats: map[string]uint64{"inactive_file": 1024}}
+	stats.Networks = map[string]container.NetworkStats{"eth0": {RxBytes: 10, TxBytes: 20}, "eth1": {RxBytes: 1, TxBytes: 2}}
+	stats.BlkioStats.IoServiceBytesRecursive = []container.BlkioStatEntry{{Op: "read", Value: 100}, {Op: "Write", Value: 200}, {Op: "total", Value: 300}}
+
+	result := containerStatsFrom(stats)
+	if result.Name != "redis" || result.CPUPercent != 80 {
+		t.Errorf("unexpected cpu: %#v", result)
+	}
+	if result.MemoryUsage != 1024 || result.MemoryPercent != 25 {
+		t.Errorf("unexpected memory: %#v", result)
+	}
+	if result.NetworkRxBytes != 11 || result.NetworkTxBytes != 22 || result.BlockReadBytes != 100 || result.BlockWriteBytes != 200 {
+		t.Errorf("unexpected io: %#v", result)
+	}
+}
+
+func TestDiskUsageFrom(t *testing.T) {
+	du := diskUsageFrom(types.DiskUsage{
+		LayersSize: 500,
+		Images:     []*image.Summary{{Size: 100}, {Size: 200}},
+		Volumes:    []*volume.Volume{{UsageData: &volume.UsageData{Size: 30}}, {UsageData: &volume.UsageData{Size: -1}}},
+		BuildCache: []*types.BuildCache{{Size: 7}},
+	})
+	if du.Images != 2 || du.ImagesSize != 300 || du.Volumes != 2 || du.VolumesSize != 30 || du.BuildCacheSize != 7 || du.LayersSize != 500 {
+		t.Errorf("unexpected disk usage: %#v", du)
+	}
+}
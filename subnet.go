@@ -0,0 +1,238 @@
+// Package docker
+// Date: 2024/07/24 11:02:51
+// Author: Amu
+// Description:
+package docker
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math/bits"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var DefaultSubnetPools = []string{"172.16.0.0/12", "192.168.0.0/16"}
+
+const DefaultSubnetPrefixLen = 24
+
+// SubnetAllocator 从地址池中挑选与已有网络(以及宿主机路由)不重叠的子网
+type SubnetAllocator struct {
+	Pools      []string // 候选地址池, 为空时使用 DefaultSubnetPools
+	PrefixLen  int      // 默认子网掩码长度, 为 0 时使用 DefaultSubnetPrefixLen
+	HostRoutes bool     // 同时避开宿主机路由表中的网段
+
+	mu sync.Mutex
+}
+
+func NewSubnetAllocator(pools []string, prefixLen int, hostRoutes bool) *SubnetAllocator {
+	return &SubnetAllocator{Pools: pools, PrefixLen: prefixLen, HostRoutes: hostRoutes}
+}
+
+// Allocate 返回地址池中第一个长度为 prefixLen 且不与 used 重叠的子网
+func (a *SubnetAllocator) Allocate(used []netip.Prefix, prefixLen int) (netip.Prefix, error) {
+	if prefixLen == 0 {
+		prefixLen = a.PrefixLen
+	}
+	if prefixLen == 0 {
+		prefixLen = DefaultSubnetPrefixLen
+	}
+	pools := a.Pools
+	if len(pools) == 0 {
+		pools = DefaultSubnetPools
+	}
+
+	for _, p := range pools {
+		pool, err := netip.ParsePrefix(p)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("invalid subnet pool %s: %w", p, err)
+		}
+		pool = pool.Masked()
+		if prefixLen < pool.Bits() || prefixLen > pool.Addr().BitLen() {
+			continue
+		}
+		if subnet, ok := firstFreeSubnet(pool, prefixLen, used); ok {
+			return subnet, nil
+		}
+	}
+	return netip.Prefix{}, fmt.Errorf("no free /%d subnet in pools %v", prefixLen, pools)
+}
+
+// firstFreeSubnet 顺序扫描 pool, 遇到更大的已用网段时直接跳过整个网段
+func firstFreeSubnet(pool netip.Prefix, prefixLen int, used []netip.Prefix) (netip.Prefix, bool) {
+	candidate := netip.PrefixFrom(pool.Addr(), prefixLen)
+	for pool.Contains(candidate.Addr()) {
+		var conflict *netip.Prefix
+		for i := range used {
+			if used[i].Addr().Is4() == candidate.Addr().Is4() && used[i].Overlaps(candidate) {
+				conflict = &used[i]
+				break
+			}
+		}
+		if conflict == nil {
+			return candidate, true
+		}
+
+		next := candidate
+		if conflict.Bits() < prefixLen {
+			next = conflict.Masked()
+		}
+		addr, ok := nextPrefixAddr(next)
+		if !ok {
+			return netip.Prefix{}, false
+		}
+		candidate = netip.PrefixFrom(addr, prefixLen)
+	}
+	return netip.Prefix{}, false
+}
+
+// nextPrefixAddr 返回紧随 p 之后的地址, 地址空间溢出时 ok 为 false
+func nextPrefixAddr(p netip.Prefix) (netip.Addr, bool) {
+	addr := p.Masked().Addr()
+	b := addr.As16()
+	offset := 128 - addr.BitLen()
+	bit := offset + p.Bits() - 1
+	if bit < offset {
+		return netip.Addr{}, false
+	}
+
+	carry := byte(1 << (7 - bit%8))
+	for i := bit / 8; i >= offset/8; i-- {
+		sum := uint16(b[i]) + uint16(carry)
+		b[i] = byte(sum)
+		if sum < 0x100 {
+			carry = 0
+			break
+		}
+		carry = 1
+	}
+	if carry != 0 {
+		return netip.Addr{}, false
+	}
+	next := netip.AddrFrom16(b)
+	if addr.Is4() {
+		next = next.Unmap()
+	}
+	return next, true
+}
+
+// usedSubnets 汇总所有 docker 网络的子网, 以及按需读取的宿主机路由
+func (m *Manager) usedSubnets(ctx context.Context, hostRoutes bool) ([]netip.Prefix, error) {
+	networks, err := m.ListNetwork(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var used []netip.Prefix
+	for _, nt := range networks {
+		for _, sn := range nt.SubNet {
+			if prefix, err := netip.ParsePrefix(sn.Subnet); err == nil {
+				used = append(used, prefix.Masked())
+			}
+		}
+	}
+	if hostRoutes {
+		routes, err := hostRoutePrefixes()
+		if err != nil {
+			return nil, err
+		}
+		used = append(used, routes...)
+	}
+	return used, nil
+}
+
+func (m *Manager) NextFreeSubnet(ctx context.Context, prefixLen int) (string, error) {
+	allocator := m.subnetAllocator
+	if allocator == nil {
+		allocator = &SubnetAllocator{}
+	}
+	used, err := m.usedSubnets(ctx, allocator.HostRoutes)
+	if err != nil {
+		return "", err
+	}
+	subnet, err := allocator.Allocate(used, prefixLen)
+	if err != nil {
+		return "", err
+	}
+	return subnet.String(), nil
+}
+
+// hostRoutePrefixes 读取 Linux 的 IPv4/IPv6 路由表, 忽略默认路由; 非 Linux 系统返回空
+func hostRoutePrefixes() ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	v4, err := readRouteFile("/proc/net/route", parseIPv4Route)
+	if err != nil {
+		return nil, err
+	}
+	prefixes = append(prefixes, v4...)
+	v6, err := readRouteFile("/proc/net/ipv6_route", parseIPv6Route)
+	if err != nil {
+		return nil, err
+	}
+	return append(prefixes, v6...), nil
+}
+
+func readRouteFile(name string, parse func(fields []string) (netip.Prefix, bool)) ([]netip.Prefix, error) {
+	f, err := os.Open(name)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer func(f *os.File) {
+		err := f.Close()
+		if err != nil {
+			return
+		}
+	}(f)
+
+	var prefixes []netip.Prefix
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if prefix, ok := parse(strings.Fields(scanner.Text())); ok && prefix.Bits() > 0 {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	return prefixes, scanner.Err()
+}
+
+// parseIPv4Route 解析 /proc/net/route 的一行, 目的地址和掩码为小端序十六进制
+func parseIPv4Route(fields []string) (netip.Prefix, bool) {
+	if len(fields) < 8 {
+		return netip.Prefix{}, false
+	}
+	dst, err1 := strconv.ParseUint(fields[1], 16, 32)
+	mask, err2 := strconv.ParseUint(fields[7], 16, 32)
+	if err1 != nil || err2 != nil {
+		return netip.Prefix{}, false
+	}
+	var d [4]byte
+	binary.LittleEndian.PutUint32(d[:], uint32(dst))
+	return netip.PrefixFrom(netip.AddrFrom4(d), bits.OnesCount32(uint32(mask))).Masked(), true
+}
+
+// parseIPv6Route 解析 /proc/net/ipv6_route 的一行
+func parseIPv6Route(fields []string) (netip.Prefix, bool) {
+	if len(fields) < 2 {
+		return netip.Prefix{}, false
+	}
+	raw, err := hex.DecodeString(fields[0])
+	if err != nil || len(raw) != 16 {
+		return netip.Prefix{}, false
+	}
+	prefixLen, err := strconv.ParseUint(fields[1], 16, 8)
+	if err != nil || prefixLen > 128 {
+		return netip.Prefix{}, false
+	}
+	addr := netip.AddrFrom16([16]byte(raw))
+	if addr.IsLinkLocalUnicast() || addr.IsMulticast() {
+		return netip.Prefix{}, false
+	}
+	return netip.PrefixFrom(addr, int(prefixLen)).Masked(), true
+}
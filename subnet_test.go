@@ -0,0 +1,89 @@
+// Package docker
+// Date: 2024/07/24 11:03:27
+// Author: Amu
+// Description:
+package docker
+
+import (
+	"context"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+func TestNextFreeSubnet(t *testing.T) {
+	manager, _ := NewManager()
+	subnet, err := manager.NextFreeSubnet(context.Background(), 24)
+	if err != nil {
+		t.Fatalf("next free subnet error: %v", err)
+	}
+	t.Logf("subnet: %s", subnet)
+}
+
+func TestSubnetAllocate(t *testing.T) {
+	used := []netip.Prefix{
+		netip.MustParsePrefix("172.16.0.0/16"),
+		netip.MustParsePrefix("172.17.0.0/24"),
+		netip.MustParsePrefix("172.17.1.128/25"),
+	}
+	allocator := NewSubnetAllocator([]string{"172.16.0.0/12"}, 24, false)
+	subnet, err := allocator.Allocate(used, 0)
+	if err != nil {
+		t.Fatalf("allocate error: %v", err)
+	}
+	if subnet.String() != "172.17.2.0/24" {
+		t.Errorf("unexpected subnet: %s", subnet)
+	}
+
+	subnet, err = allocator.Allocate(used, 20)
+	if err != nil {
+		t.Fatalf("allocate error: %v", err)
+	}
+	if subnet.String() != "172.17.16.0/20" {
+		t.Errorf("unexpected subnet: %s", subnet)
+	}
+}
+
+func TestSubnetAllocateExhausted(t *testing.T) {
+	allocator := NewSubnetAllocator([]string{"10.0.0.0/23", "192.168.0.0/24"}, 24, false)
+	used := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/24"), netip.MustParsePrefix("10.0.1.0/24")}
+	subnet, err := allocator.Allocate(used, 0)
+	if err != nil || subnet.String() != "192.168.0.0/24" {
+		t.Errorf("expected fallback pool, got %s (%v)", subnet, err)
+	}
+	used = append(used, netip.MustParsePrefix("192.168.0.0/16"))
+	if _, err := allocator.Allocate(used, 0); err == nil || !strings.Contains(err.Error(), "no free") {
+		t.Errorf("expected exhausted error, got %v", err)
+	}
+}
+
+func TestSubnetAllocateIPv6(t *testing.T) {
+	allocator := NewSubnetAllocator([]string{"fd00::/48"}, 64, false)
+	used := []netip.Prefix{netip.MustParsePrefix("fd00::/64"), netip.MustParsePrefix("172.16.0.0/12")}
+	subnet, err := allocator.Allocate(used, 0)
+	if err != nil || subnet.String() != "fd00:0:0:1::/64" {
+		t.Errorf("unexpected subnet: %s (%v)", subnet, err)
+	}
+}
+
+func TestParseRoutes(t *testing.T) {
+	prefix, ok := parseIPv4Route(strings.Fields("eth0	0011A8C0	00000000	0001	0	0	0	00FFFFFF	0	0	0"))
+	if !ok || prefix.String() != "192.168.17.0/24" {
+		t.Errorf("unexpected ipv4 route: %s", prefix)
+	}
+	prefix, ok = parseIPv6Route(strings.Fields("fd000000000000000000000000000000 40 00000000000000000000000000000000 00 00000000000000000000000000000000 00000100 00000001 00000000 00000001 eth0"))
+	if !ok || prefix.String() != "fd00::/64" {
+		t.Errorf("unexpected ipv6 route: %s", prefix)
+	}
+}
+
+func TestWithAllocatedSubnet(t *testing.T) {
+	pools := withAllocatedSubnet([]IPAMPool{{Subnet: "fd00::/64"}, {}}, "172.20.0.0/24")
+	if len(pools) != 2 || pools[1].Subnet != "172.20.0.0/24" {
+		t.Errorf("unexpected pools: %#v", pools)
+	}
+	pools = withAllocatedSubnet(nil, "172.20.0.0/24")
+	if len(pools) != 1 || pools[0].Subnet != "172.20.0.0/24" {
+		t.Errorf("unexpected pools: %#v", pools)
+	}
+}
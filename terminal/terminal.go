@@ -0,0 +1,343 @@
+// Package terminal
+// Date: 2024/08/13 14:40:52
+// Author: Amu
+// Description: 通过 WebSocket 将浏览器终端连接到容器内的交互式 exec 会话
+package terminal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/amuluze/docker"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	DefaultIdleTimeout = 10 * time.Minute
+
+	writeTimeout = 10 * time.Second
+	bufferSize   = 32 * 1024
+)
+
+// DefaultCommands 未设置允许的命令时可以启动的 shell
+var DefaultCommands = []string{"/bin/bash", "/bin/sh"}
+
+// 客户端发送的文本消息为 JSON 格式的控制消息, 二进制消息直接作为标准输入。
+// 服务端以二进制消息发送终端输出, 命令结束时发送 exit 消息后关闭连接
+const (
+	MessageStdin  = "stdin"  // 客户端: 标准输入, 内容在 data 中
+	MessageResize = "resize" // 客户端: 调整终端大小
+	MessageExit   = "exit"   // 服务端: 命令结束, 退出码在 code 中
+	MessageError  = "error"  // 服务端: 出错, 随后关闭连接
+)
+
+// Message 文本消息的格式
+type Message struct {
+	Type    string `json:"type"`
+	Data    string `json:"data,omitempty"`
+	Rows    uint   `json:"rows,omitempty"`
+	Cols    uint   `json:"cols,omitempty"`
+	Code    *int   `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// Session 终端连接的 exec 会话
+type Session interface {
+	Input() io.WriteCloser
+	Output() io.Reader
+	Resize(ctx context.Context, rows, cols uint) error
+	Wait(ctx context.Context) (int, error)
+	Close() error
+}
+
+type execFunc func(ctx context.Context, containerID string, opts docker.ExecOptions) (Session, error)
+
+// Handler 将 HTTP 请求升级为 WebSocket 并启动 exec 会话, 实现了 http.Handler。
+// 查询参数: container 为容器 ID 或名称, cmd 为命令的各个参数(可出现多次, 为空时使用第一个允许的命令),
+// rows 和 cols 为初始终端大小
+type Handler struct {
+	exec        execFunc
+	commands    [][]string
+	idleTimeout time.Duration
+	upgrader    websocket.Upgrader
+}
+
+type Option func(*Handler)
+
+// WithAllowedCommands 设置允许启动的命令, 每项为一条完整的命令行, 如 "/bin/sh -l"; 请求的命令必须与其中一项完全一致
+func WithAllowedCommands(commands ...string) Option {
+	return func(h *Handler) {
+		h.commands = nil
+		for _, command := range commands {
+			if argv := strings.Fields(command); len(argv) > 0 {
+				h.commands = append(h.commands, argv)
+			}
+		}
+	}
+}
+
+// WithIdleTimeout 设置空闲超时, 超时时间内没有输入和输出时断开连接, 为 0 时不限制
+func WithIdleTimeout(timeout time.Duration) Option {
+	return func(h *Handler) {
+		h.idleTimeout = timeout
+	}
+}
+
+// WithCheckOrigin 设置 WebSocket 握手时的来源检查, 默认只允许同源请求
+func WithCheckOrigin(check func(r *http.Request) bool) Option {
+	return func(h *Handler) {
+		h.upgrader.CheckOrigin = check
+	}
+}
+
+func New(manager docker.IManager, opts ...Option) *Handler {
+	h := &Handler{
+		exec: func(ctx context.Context, containerID string, opts docker.ExecOptions) (Session, error) {
+			session, err := manager.ExecContainer(ctx, containerID, opts)
+			if err != nil {
+				return nil, err
+			}
+			return execSession{session}, nil
+		},
+		idleTimeout: DefaultIdleTimeout,
+		upgrader: websocket.Upgrader{
+			ReadBufferSize:  bufferSize,
+			WriteBufferSize: bufferSize,
+		},
+	}
+	WithAllowedCommands(DefaultCommands...)(h)
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// execSession 将 *docker.ExecSession 适配为 Session
+type execSession struct {
+	*docker.ExecSession
+}
+
+func (s execSession) Input() io.WriteCloser {
+	return s.Stdin
+}
+
+func (s execSession) Output() io.Reader {
+	return s.Stdout
+}
+
+// command 返回请求的命令, 不在允许列表中时返回 false
+func (h *Handler) command(requested []string) ([]string, bool) {
+	if len(h.commands) == 0 {
+		return nil, false
+	}
+	if len(requested) == 0 {
+		return h.commands[0], true
+	}
+	for _, allowed := range h.commands {
+		if equalArgs(allowed, requested) {
+			return allowed, true
+		}
+	}
+	return nil, false
+}
+
+func equalArgs(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func parseSize(value string) (uint, error) {
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.ParseUint(value, 10, 16)
+	return uint(n), err
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	containerID := query.Get("container")
+	if containerID == "" {
+		http.Error(w, "container is required", http.StatusBadRequest)
+		return
+	}
+	cmd, ok := h.command(query["cmd"])
+	if !ok {
+		http.Error(w, "command is not allowed", http.StatusForbidden)
+		return
+	}
+	rows, err := parseSize(query.Get("rows"))
+	if err != nil {
+		http.Error(w, "invalid rows", http.StatusBadRequest)
+		return
+	}
+	cols, err := parseSize(query.Get("cols"))
+	if err != nil {
+		http.Error(w, "invalid cols", http.StatusBadRequest)
+		return
+	}
+
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade 已经写入了错误响应
+		return
+	}
+	defer conn.Close()
+
+	// 请求的 context 在连接被劫持后不再反映客户端状态, 由 bridge 负责取消; 保留其中的值, 如审计用的调用方
+	ctx, cancel := context.WithCancel(context.WithoutCancel(r.Context()))
+	defer cancel()
+
+	t := &terminal{conn: conn}
+	session, err := h.exec(ctx, containerID, docker.ExecOptions{
+		Cmd:    cmd,
+		Tty:    true,
+		Stdin:  true,
+		Height: rows,
+		Width:  cols,
+	})
+	if err != nil {
+		t.close(err.Error())
+		return
+	}
+	defer session.Close()
+	t.bridge(ctx, cancel, session, h.idleTimeout)
+}
+
+// terminal 一条 WebSocket 连接, 写入需要串行
+type terminal struct {
+	conn *websocket.Conn
+	mu   sync.Mutex
+}
+
+func (t *terminal) write(messageType int, data []byte) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_ = t.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	return t.conn.WriteMessage(messageType, data)
+}
+
+func (t *terminal) writeJSON(msg Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return t.write(websocket.TextMessage, data)
+}
+
+// close 发送错误消息(reason 不为空时)和关闭帧
+func (t *terminal) close(reason string) {
+	code := websocket.CloseNormalClosure
+	if reason != "" {
+		_ = t.writeJSON(Message{Type: MessageError, Message: reason})
+		code = websocket.CloseInternalServerErr
+	}
+	if len(reason) > 120 {
+		// 关闭帧的内容不能超过 125 字节
+		reason = reason[:120]
+	}
+	_ = t.write(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason))
+	// 等待客户端回应关闭帧, 客户端不回应时读取超时结束
+	_ = t.conn.SetReadDeadline(time.Now().Add(time.Second))
+}
+
+func (t *terminal) bridge(ctx context.Context, cancel context.CancelFunc, session Session, idleTimeout time.Duration) {
+	touch := func() {}
+	if idleTimeout > 0 {
+		timer := time.AfterFunc(idleTimeout, func() {
+			t.close("idle timeout")
+			cancel()
+			_ = t.conn.Close()
+		})
+		defer timer.Stop()
+		touch = func() { timer.Reset(idleTimeout) }
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer cancel()
+		buf := make([]byte, bufferSize)
+		for {
+			n, err := session.Output().Read(buf)
+			if n > 0 {
+				touch()
+				if werr := t.write(websocket.BinaryMessage, buf[:n]); werr != nil {
+					return
+				}
+			}
+			if err != nil {
+				break
+			}
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		code, err := session.Wait(ctx)
+		if err != nil {
+			t.close(err.Error())
+			return
+		}
+		_ = t.writeJSON(Message{Type: MessageExit, Code: &code})
+		t.close("")
+	}()
+
+	t.readInput(ctx, session, touch)
+	// 客户端断开时关闭会话, 使输出协程退出
+	cancel()
+	_ = session.Close()
+	<-done
+}
+
+func (t *terminal) readInput(ctx context.Context, session Session, touch func()) {
+	for {
+		messageType, data, err := t.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		touch()
+		switch messageType {
+		case websocket.BinaryMessage:
+			if _, err := session.Input().Write(data); err != nil {
+				return
+			}
+		case websocket.TextMessage:
+			var msg Message
+			if err := json.Unmarshal(data, &msg); err != nil {
+				t.close("invalid message")
+				return
+			}
+			switch msg.Type {
+			case MessageStdin:
+				if _, err := io.WriteString(session.Input(), msg.Data); err != nil {
+					return
+				}
+			case MessageResize:
+				if msg.Rows == 0 || msg.Cols == 0 {
+					continue
+				}
+				if err := session.Resize(ctx, msg.Rows, msg.Cols); err != nil && !errors.Is(err, context.Canceled) {
+					t.close(err.Error())
+					return
+				}
+			default:
+				t.close("unknown message type " + strconv.Quote(msg.Type))
+				return
+			}
+		}
+	}
+}
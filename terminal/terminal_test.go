@@ -0,0 +1,239 @@
+// Package terminal
+// Date: 2024/08/13 15:12:09
+// Author: Amu
+// Description:
+package terminal
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/amuluze/docker"
+	"github.com/gorilla/websocket"
+)
+
+// echoSession 将输入原样输出, 收到 exit 行时以退出码 3 结束
+type echoSession struct {
+	inR  *io.PipeReader
+	inW  *io.PipeWriter
+	outR *io.PipeReader
+	outW *io.PipeWriter
+
+	mu      sync.Mutex
+	resized [][2]uint
+}
+
+func newEchoSession() *echoSession {
+	s := &echoSession{}
+	s.inR, s.inW = io.Pipe()
+	s.outR, s.outW = io.Pipe()
+	go func() {
+		scanner := bufio.NewScanner(s.inR)
+		for scanner.Scan() {
+			if scanner.Text() == "exit" {
+				break
+			}
+			_, _ = io.WriteString(s.outW, scanner.Text()+"\r\n")
+		}
+		_ = s.outW.Close()
+	}()
+	return s
+}
+
+func (s *echoSession) Input() io.WriteCloser { return s.inW }
+func (s *echoSession) Output() io.Reader     { return s.outR }
+func (s *echoSession) Wait(context.Context) (int, error) {
+	return 3, nil
+}
+func (s *echoSession) Resize(_ context.Context, rows, cols uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.resized = append(s.resized, [2]uint{rows, cols})
+	return nil
+}
+func (s *echoSession) Close() error {
+	_ = s.inW.Close()
+	return s.outR.Close()
+}
+
+// newTestServer 返回的 channel 中为每次启动的命令
+func newTestServer(t *testing.T, session *echoSession, opts ...Option) (*httptest.Server, chan string) {
+	t.Helper()
+	cmds := make(chan string, 10)
+	h := New(nil, opts...)
+	h.exec = func(_ context.Context, containerID string, opts docker.ExecOptions) (Session, error) {
+		if containerID == "missing" {
+			return nil, errors.New("no such container")
+		}
+		cmds <- strings.Join(opts.Cmd, " ")
+		return session, nil
+	}
+	server := httptest.NewServer(h)
+	t.Cleanup(server.Close)
+	return server, cmds
+}
+
+func receive(t *testing.T, cmds chan string) string {
+	t.Helper()
+	select {
+	case cmd := <-cmds:
+		return cmd
+	case <-time.After(5 * time.Second):
+		t.Fatal("exec was not called")
+		return ""
+	}
+}
+
+func dial(t *testing.T, server *httptest.Server, query string) (*websocket.Conn, *http.Response, error) {
+	t.Helper()
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/?" + query
+	return websocket.DefaultDialer.Dial(url, nil)
+}
+
+func TestTerminalSession(t *testing.T) {
+	session := newEchoSession()
+	server, cmds := newTestServer(t, session)
+	conn, _, err := dial(t, server, "container=redis&rows=24&cols=80")
+	if err != nil {
+		t.Fatalf("dial error: %v", err)
+	}
+	defer conn.Close()
+
+	if err := conn.WriteJSON(Message{Type: MessageResize, Rows: 40, Cols: 120}); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.WriteJSON(Message{Type: MessageStdin, Data: "hello\n"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.WriteMessage(websocket.BinaryMessage, []byte("exit\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var output strings.Builder
+	var exit *Message
+	for exit == nil {
+		messageType, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("read error: %v (output %q)", err, output.String())
+		}
+		if messageType == websocket.BinaryMessage {
+			output.Write(data)
+			continue
+		}
+		var msg Message
+		if err := json.Unmarshal(data, &msg); err != nil {
+			t.Fatal(err)
+		}
+		if msg.Type == MessageExit {
+			exit = &msg
+		}
+	}
+	if output.String() != "hello\r\n" {
+		t.Errorf("output = %q", output.String())
+	}
+	if exit.Code == nil || *exit.Code != 3 {
+		t.Errorf("exit message = %#v", exit)
+	}
+	if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+		t.Errorf("expected normal close, got %v", err)
+	}
+	if cmd := receive(t, cmds); cmd != "/bin/bash" {
+		t.Errorf("command = %s", cmd)
+	}
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	if len(session.resized) != 1 || session.resized[0] != [2]uint{40, 120} {
+		t.Errorf("resized = %v", session.resized)
+	}
+}
+
+func TestTerminalCaller(t *testing.T) {
+	callers := make(chan string, 1)
+	h := New(nil)
+	h.exec = func(ctx context.Context, _ string, _ docker.ExecOptions) (Session, error) {
+		callers <- docker.CallerFromContext(ctx)
+		return nil, errors.New("no such container")
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(w, r.WithContext(docker.WithCaller(r.Context(), "alice")))
+	}))
+	t.Cleanup(server.Close)
+
+	conn, _, err := dial(t, server, "container=redis")
+	if err != nil {
+		t.Fatalf("dial error: %v", err)
+	}
+	defer conn.Close()
+	select {
+	case caller := <-callers:
+		if caller != "alice" {
+			t.Errorf("caller = %q", caller)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("exec was not called")
+	}
+}
+
+func TestTerminalAllowList(t *testing.T) {
+	server, cmds := newTestServer(t, newEchoSession(), WithAllowedCommands("/bin/sh -l", "redis-cli"))
+
+	_, resp, err := dial(t, server, "container=redis&cmd=/bin/bash")
+	if err == nil || resp == nil || resp.StatusCode != http.StatusForbidden {
+		t.Errorf("disallowed command should be rejected before upgrade: %v", err)
+	}
+	_, resp, err = dial(t, server, "cmd=/bin/sh")
+	if err == nil || resp == nil || resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("missing container should be rejected: %v", err)
+	}
+
+	conn, _, err := dial(t, server, "container=redis&cmd=/bin/sh&cmd=-l")
+	if err != nil {
+		t.Fatalf("allowed command rejected: %v", err)
+	}
+	defer conn.Close()
+	if cmd := receive(t, cmds); cmd != "/bin/sh -l" {
+		t.Errorf("command = %s", cmd)
+	}
+}
+
+func TestTerminalIdleTimeout(t *testing.T) {
+	server, _ := newTestServer(t, newEchoSession(), WithIdleTimeout(100*time.Millisecond))
+	conn, _, err := dial(t, server, "container=redis")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, data, err := conn.ReadMessage()
+	if err != nil || !strings.Contains(string(data), "idle timeout") {
+		t.Fatalf("expected idle timeout message, got %q %v", data, err)
+	}
+	if _, _, err := conn.ReadMessage(); err == nil {
+		t.Error("connection should be closed after idle timeout")
+	}
+}
+
+func TestTerminalExecError(t *testing.T) {
+	server, _ := newTestServer(t, newEchoSession())
+	conn, _, err := dial(t, server, "container=missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, data, err := conn.ReadMessage()
+	if err != nil || !strings.Contains(string(data), `"type":"error"`) || !strings.Contains(string(data), "no such container") {
+		t.Errorf("expected error message, got %q %v", data, err)
+	}
+}
@@ -0,0 +1,249 @@
+// Package docker
+// Date: 2024/07/26 16:40:12
+// Author: Amu
+// Description:
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+)
+
+// Topology 宿主机上网络与容器的连接关系图
+type Topology struct {
+	Networks   []TopologyNetwork   `json:"networks"`
+	Containers []TopologyContainer `json:"containers"`
+	Links      []TopologyLink      `json:"links"`
+}
+
+type TopologyNetwork struct {
+	ID       string   `json:"id"`
+	Name     string   `json:"name"`
+	Driver   string   `json:"driver"`
+	Internal bool     `json:"internal"`
+	Subnets  []string `json:"subnets"`
+}
+
+type TopologyContainer struct {
+	ID         string   `json:"id"`
+	Name       string   `json:"name"`
+	Image      string   `json:"image"`
+	State      string   `json:"state"`
+	ServerType string   `json:"server_type"`
+	Ports      []string `json:"ports"` // 形如 0.0.0.0:8080->80/tcp
+}
+
+// TopologyLink 容器在某个网络中的端点
+type TopologyLink struct {
+	ContainerID string `json:"container_id"`
+	NetworkID   string `json:"network_id"`
+	IPv4        string `json:"ipv4"`
+	IPv6        string `json:"ipv6"`
+}
+
+func (m *Manager) Topology(ctx context.Context) (*Topology, error) {
+	nets, err := m.client.NetworkList(ctx, network.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	containers, err := m.client.ContainerList(ctx, container.ListOptions{All: true})
+	if err != nil {
+		return nil, err
+	}
+	return buildTopology(nets, containers), nil
+}
+
+func buildTopology(nets []network.Summary, containers []types.Container) *Topology {
+	topology := &Topology{
+		Networks:   make([]TopologyNetwork, 0, len(nets)),
+		Containers: make([]TopologyContainer, 0, len(containers)),
+		Links:      make([]TopologyLink, 0),
+	}
+	for _, nt := range nets {
+		var subnets []string
+		for _, cfg := range nt.IPAM.Config {
+			subnets = append(subnets, cfg.Subnet)
+		}
+		topology.Networks = append(topology.Networks, TopologyNetwork{
+			ID:       nt.ID,
+			Name:     nt.Name,
+			Driver:   nt.Driver,
+			Internal: nt.Internal,
+			Subnets:  subnets,
+		})
+	}
+
+	for _, c := range containers {
+		serverType := c.Labels[ServerTypeLabel]
+		if serverType == "" {
+			serverType = UnknownServer
+		}
+		var ports []string
+		for _, p := range c.Ports {
+			if p.PublicPort == 0 {
+				ports = append(ports, fmt.Sprintf("%d/%s", p.PrivatePort, p.Type))
+				continue
+			}
+			ports = append(ports, fmt.Sprintf("%s:%d->%d/%s", p.IP, p.PublicPort, p.PrivatePort, p.Type))
+		}
+		sort.Strings(ports)
+		var name string
+		if len(c.Names) > 0 {
+			name = strings.TrimPrefix(c.Names[0], "/")
+		}
+		topology.Containers = append(topology.Containers, TopologyContainer{
+			ID:         c.ID,
+			Name:       name,
+			Image:      c.Image,
+			State:      c.State,
+			ServerType: serverType,
+			Ports:      ports,
+		})
+
+		if c.NetworkSettings == nil {
+			continue
+		}
+		for _, endpoint := range c.NetworkSettings.Networks {
+			if endpoint == nil || endpoint.NetworkID == "" {
+				continue
+			}
+			topology.Links = append(topology.Links, TopologyLink{
+				ContainerID: c.ID,
+				NetworkID:   endpoint.NetworkID,
+				IPv4:        endpoint.IPAddress,
+				IPv6:        endpoint.GlobalIPv6Address,
+			})
+		}
+	}
+
+	sort.Slice(topology.Networks, func(i, j int) bool { return topology.Networks[i].Name < topology.Networks[j].Name })
+	sort.Slice(topology.Containers, func(i, j int) bool { return topology.Containers[i].Name < topology.Containers[j].Name })
+	sort.Slice(topology.Links, func(i, j int) bool {
+		if topology.Links[i].ContainerID != topology.Links[j].ContainerID {
+			return topology.Links[i].ContainerID < topology.Links[j].ContainerID
+		}
+		return topology.Links[i].NetworkID < topology.Links[j].NetworkID
+	})
+	return topology
+}
+
+func (t *Topology) JSON() ([]byte, error) {
+	return json.MarshalIndent(t, "", "  ")
+}
+
+// serverTypeColors 渲染时按 server.type 区分容器节点的颜色
+var serverTypeColors = map[string]string{
+	WebServer:      "#a6cee3",
+	HttpServer:     "#b2df8a",
+	DatabaseServer: "#fdbf6f",
+	UnknownServer:  "#dddddd",
+}
+
+func serverTypeColor(serverType string) string {
+	if color, ok := serverTypeColors[serverType]; ok {
+		return color
+	}
+	return serverTypeColors[UnknownServer]
+}
+
+func topologyNodeID(prefix, id string) string {
+	if len(id) > 12 {
+		id = id[:12]
+	}
+	return prefix + "_" + id
+}
+
+func containerNodeLabel(c TopologyContainer) []string {
+	lines := []string{c.Name, c.Image, c.ServerType + " / " + c.State}
+	return append(lines, c.Ports...)
+}
+
+func networkNodeLabel(n TopologyNetwork) []string {
+	return append([]string{n.Name + " (" + n.Driver + ")"}, n.Subnets...)
+}
+
+func linkLabel(l TopologyLink) string {
+	return strings.Trim(l.IPv4+" "+l.IPv6, " ")
+}
+
+// DOT 以 Graphviz DOT 格式输出拓扑图
+func (t *Topology) DOT() string {
+	escape := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+	join := func(lines []string) string {
+		for i := range lines {
+			lines[i] = escape.Replace(lines[i])
+		}
+		return strings.Join(lines, `\n`)
+	}
+
+	b := new(strings.Builder)
+	b.WriteString("graph topology {\n")
+	b.WriteString("  rankdir=LR;\n")
+	for _, n := range t.Networks {
+		style := ""
+		if n.Internal {
+			style = `, style="dashed"`
+		}
+		fmt.Fprintf(b, "  %q [shape=ellipse, label=\"%s\"%s];\n", topologyNodeID("net", n.ID), join(networkNodeLabel(n)), style)
+	}
+	for _, c := range t.Containers {
+		fmt.Fprintf(b, "  %q [shape=box, style=filled, fillcolor=%q, label=\"%s\"];\n", topologyNodeID("ctr", c.ID), serverTypeColor(c.ServerType), join(containerNodeLabel(c)))
+	}
+	for _, l := range t.Links {
+		fmt.Fprintf(b, "  %q -- %q [label=\"%s\"];\n", topologyNodeID("ctr", l.ContainerID), topologyNodeID("net", l.NetworkID), escape.Replace(linkLabel(l)))
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// Mermaid 以 Mermaid flowchart 格式输出拓扑图
+func (t *Topology) Mermaid() string {
+	escape := strings.NewReplacer(`"`, "#quot;", "|", "#124;")
+	join := func(lines []string) string {
+		for i := range lines {
+			lines[i] = escape.Replace(lines[i])
+		}
+		return strings.Join(lines, "<br/>")
+	}
+
+	b := new(strings.Builder)
+	b.WriteString("graph LR\n")
+	for _, n := range t.Networks {
+		fmt.Fprintf(b, "  %s((\"%s\"))\n", topologyNodeID("net", n.ID), join(networkNodeLabel(n)))
+	}
+	for _, c := range t.Containers {
+		fmt.Fprintf(b, "  %s[\"%s\"]:::%s\n", topologyNodeID("ctr", c.ID), join(containerNodeLabel(c)), mermaidClass(c.ServerType))
+	}
+	for _, l := range t.Links {
+		label := linkLabel(l)
+		if label == "" {
+			fmt.Fprintf(b, "  %s --- %s\n", topologyNodeID("ctr", l.ContainerID), topologyNodeID("net", l.NetworkID))
+			continue
+		}
+		fmt.Fprintf(b, "  %s ---|%s| %s\n", topologyNodeID("ctr", l.ContainerID), escape.Replace(label), topologyNodeID("net", l.NetworkID))
+	}
+
+	serverTypes := make([]string, 0, len(serverTypeColors))
+	for serverType := range serverTypeColors {
+		serverTypes = append(serverTypes, serverType)
+	}
+	sort.Strings(serverTypes)
+	for _, serverType := range serverTypes {
+		fmt.Fprintf(b, "  classDef %s fill:%s\n", mermaidClass(serverType), serverTypeColors[serverType])
+	}
+	return b.String()
+}
+
+func mermaidClass(serverType string) string {
+	if _, ok := serverTypeColors[serverType]; !ok {
+		serverType = UnknownServer
+	}
+	return "st_" + serverType
+}
@@ -0,0 +1,83 @@
+// Package docker
+// Date: 2024/07/26 16:41:03
+// Author: Amu
+// Description:
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/network"
+)
+
+func TestTopology(t *testing.T) {
+	manager, _ := NewManager()
+	topology, err := manager.Topology(context.Background())
+	if err != nil {
+		t.Fatalf("topology error: %v", err)
+	}
+	t.Log(topology.Mermaid())
+}
+
+func testTopology() *Topology {
+	nets := []network.Summary{
+		{ID: "7be8e024bcb58caff65d", Name: "test", Driver: "bridge", IPAM: network.IPAM{Config: []network.IPAMConfig{{Subnet: "172.20.0.0/24"}}}},
+	}
+	containers := []types.Container{
+		{
+			ID:     "5c28bf6e16be0123",
+			Names:  []string{"/redis"},
+			Image:  "redis:7.0.5",
+			State:  "running",
+			Labels: map[string]string{ServerTypeLabel: DatabaseServer},
+			Ports:  []types.Port{{IP: "0.0.0.0", PrivatePort: 6379, PublicPort: 6379, Type: "tcp"}},
+			NetworkSettings: &types.SummaryNetworkSettings{Networks: map[string]*network.EndpointSettings{
+				"test": {NetworkID: "7be8e024bcb58caff65d", IPAddress: "172.20.0.2"},
+			}},
+		},
+	}
+	return buildTopology(nets, containers)
+}
+
+func TestBuildTopology(t *testing.T) {
+	topology := testTopology()
+	if len(topology.Networks) != 1 || len(topology.Containers) != 1 || len(topology.Links) != 1 {
+		t.Fatalf("unexpected topology: %#v", topology)
+	}
+	c := topology.Containers[0]
+	if c.Name != "redis" || c.ServerType != DatabaseServer || c.Ports[0] != "0.0.0.0:6379->6379/tcp" {
+		t.Errorf("unexpected container: %#v", c)
+	}
+	if topology.Links[0].IPv4 != "172.20.0.2" {
+		t.Errorf("unexpected link: %#v", topology.Links[0])
+	}
+
+	data, err := topology.JSON()
+	if err != nil {
+		t.Fatalf("json error: %v", err)
+	}
+	decoded := &Topology{}
+	if err := json.Unmarshal(data, decoded); err != nil || decoded.Containers[0].ID != c.ID {
+		t.Errorf("json round trip failed: %v", err)
+	}
+}
+
+func TestTopologyRender(t *testing.T) {
+	topology := testTopology()
+	dot := topology.DOT()
+	for _, s := range []string{`graph topology {`, `"ctr_5c28bf6e16be" -- "net_7be8e024bcb5" [label="172.20.0.2"]`, `fillcolor="#fdbf6f"`} {
+		if !strings.Contains(dot, s) {
+			t.Errorf("dot output missing %q:\n%s", s, dot)
+		}
+	}
+	mermaid := topology.Mermaid()
+	for _, s := range []string{"graph LR", "ctr_5c28bf6e16be ---|172.20.0.2| net_7be8e024bcb5", ":::st_database", "classDef st_database fill:#fdbf6f"} {
+		if !strings.Contains(mermaid, s) {
+			t.Errorf("mermaid output missing %q:\n%s", s, mermaid)
+		}
+	}
+}
@@ -4,7 +4,10 @@
 // Description:
 package docker
 
-import "context"
+import (
+	"context"
+	"strings"
+)
 
 type Version struct {
 	DockerVersion string `json:"docker_version"`
@@ -32,3 +35,42 @@ func (m *Manager) Version(ctx context.Context) (*Version, error) {
 		Arch:          serverVersion.Arch,
 	}, nil
 }
+
+// SystemInfo daemon 所在主机的资源和容器数量
+type SystemInfo struct {
+	Name              string            `json:"name"` // 主机名
+	NCPU              int               `json:"ncpu"`
+	MemTotal          int64             `json:"mem_total"`
+	Containers        int               `json:"containers"`
+	ContainersRunning int               `json:"containers_running"`
+	Images            int               `json:"images"`
+	OperatingSystem   string            `json:"operating_system"`
+	KernelVersion     string            `json:"kernel_version"`
+	DockerVersion     string            `json:"docker_version"`
+	Labels            map[string]string `json:"labels"` // daemon 配置的标签, 如 zone=a
+}
+
+func (m *Manager) SystemInfo(ctx context.Context) (*SystemInfo, error) {
+	info, err := m.client.Info(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	labels := make(map[string]string, len(info.Labels))
+	for _, label := range info.Labels {
+		key, value, _ := strings.Cut(label, "=")
+		labels[key] = value
+	}
+	return &SystemInfo{
+		Name:              info.Name,
+		NCPU:              info.NCPU,
+		MemTotal:          info.MemTotal,
+		Containers:        info.Containers,
+		ContainersRunning: info.ContainersRunning,
+		Images:            info.Images,
+		OperatingSystem:   info.OperatingSystem,
+		KernelVersion:     info.KernelVersion,
+		DockerVersion:     info.ServerVersion,
+		Labels:            labels,
+	}, nil
+}
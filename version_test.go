@@ -14,3 +14,9 @@ func TestVersion(t *testing.T) {
 	version, _ := manager.Version(context.TODO())
 	t.Logf("version: %#v", version)
 }
+
+func TestSystemInfo(t *testing.T) {
+	manager, _ := NewManager()
+	info, _ := manager.SystemInfo(context.TODO())
+	t.Logf("info: %#v", info)
+}